@@ -0,0 +1,643 @@
+// Package client is a typed Go client for the crux control API (see GET /openapi.yaml).
+//
+//	c := client.NewFromEnv()
+//	services, err := c.Services(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glorko/crux/internal/api"
+)
+
+// DefaultURL is where crux serves its API unless api.port/api.host say otherwise
+const DefaultURL = "http://127.0.0.1:9876"
+
+// Response types shared with the server
+type (
+	TabInfo              = api.TabInfo
+	TabsResponse         = api.TabsResponse
+	ServiceState         = api.ServiceState
+	ServiceStatus        = api.ServiceStatus
+	ServicesResponse     = api.ServicesResponse
+	StatusResponse       = api.StatusResponse
+	WorkerInfo           = api.WorkerInfo
+	CommandResponse      = api.CommandResponse
+	RestartResponse      = api.RestartResponse
+	ActionsRequest       = api.ActionsRequest
+	Action               = api.Action
+	ActionResult         = api.ActionResult
+	ActionsResponse      = api.ActionsResponse
+	TaskInfo             = api.TaskInfo
+	TasksResponse        = api.TasksResponse
+	TaskResult           = api.TaskResult
+	MetricsSample        = api.MetricsSample
+	ServiceMetrics       = api.ServiceMetrics
+	MetricsResponse      = api.MetricsResponse
+	RunInfo              = api.RunInfo
+	RunsResponse         = api.RunsResponse
+	WaitRequest          = api.WaitRequest
+	WaitResponse         = api.WaitResponse
+	ExecRequest          = api.ExecRequest
+	ExecResponse         = api.ExecResponse
+	ServiceActionInfo    = api.ServiceActionInfo
+	ServiceActionResult  = api.ServiceActionResult
+	ConfigChangeResponse = api.ConfigChangeResponse
+	SessionInfo          = api.SessionInfo
+	HealthResponse       = api.HealthResponse
+	Event                = api.Event
+)
+
+// Service states reported by Services
+const (
+	StatePending  = api.StatePending
+	StateStarting = api.StateStarting
+	StateReady    = api.StateReady
+	StateCrashed  = api.StateCrashed
+	StateExited   = api.StateExited
+	StateStopped  = api.StateStopped
+)
+
+// Kinds of service action (ServiceActionInfo.Kind)
+const (
+	ActionKindSend = api.ActionKindSend
+	ActionKindExec = api.ActionKindExec
+	ActionKindTask = api.ActionKindTask
+)
+
+// Event types streamed by Events
+const (
+	EventServiceSpawned   = api.EventServiceSpawned
+	EventServiceReady     = api.EventServiceReady
+	EventServiceExited    = api.EventServiceExited
+	EventServiceNotReady  = api.EventServiceNotReady
+	EventServiceRestarted = api.EventServiceRestarted
+	EventServiceStopped   = api.EventServiceStopped
+	EventDependencyUp     = api.EventDependencyUp
+	EventDependencyDown   = api.EventDependencyDown
+	EventTaskFinished     = api.EventTaskFinished
+	EventExecFinished     = api.EventExecFinished
+	EventConfigReloaded   = api.EventConfigReloaded
+)
+
+// Operations for Action.Op
+const (
+	OpStart   = api.OpStart
+	OpStop    = api.OpStop
+	OpRestart = api.OpRestart
+	OpSend    = api.OpSend
+	GroupAll  = api.GroupAll
+)
+
+// Log formats for LogOptions.Format
+const (
+	FormatRaw   = api.FormatRaw
+	FormatPlain = api.FormatPlain
+	FormatHTML  = api.FormatHTML
+)
+
+// ErrUnavailable wraps connection failures (crux not running, wrong URL or socket).
+var ErrUnavailable = errors.New("crux API not available")
+
+// APIError is a non-2xx response.
+type APIError struct {
+	StatusCode int
+	Message    string // response body, trimmed
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// CommandError is an action endpoint that answered with success=false.
+type CommandError struct {
+	Service string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	if e.Service == "" {
+		return e.Message
+	}
+	return e.Service + ": " + e.Message
+}
+
+// IsNotFound reports whether err is a 404 (unknown service, run or log file).
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client talks to one crux session.
+type Client struct {
+	baseURL string
+	token   string
+	unix    bool // Unix socket: no token needed
+	http    *http.Client
+}
+
+// New creates a client for baseURL (http://host:port or unix:///path/to.sock). token may be
+// empty for Unix sockets.
+func New(baseURL, token string) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, http: http.DefaultClient}
+	if socketPath, ok := strings.CutPrefix(baseURL, "unix://"); ok {
+		c.baseURL = "http://crux"
+		c.unix = true
+		c.http = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		}}
+	}
+	return c
+}
+
+// NewFromEnv creates a client from CRUX_API_URL (default DefaultURL) and CRUX_API_TOKEN,
+// falling back to the session token crux writes for the port (~/.crux/api-<port>.token).
+// The token file is re-read on every request, so the client keeps working across crux restarts.
+func NewFromEnv() *Client {
+	baseURL := os.Getenv("CRUX_API_URL")
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	return New(baseURL, os.Getenv("CRUX_API_TOKEN"))
+}
+
+// NewForSession creates a client for a registered session (see Sessions).
+func NewForSession(s SessionInfo) *Client {
+	return New(s.URL, s.Token)
+}
+
+// Sessions lists the user's running crux sessions, newest first. Entries left behind by
+// sessions that died are pruned.
+func Sessions() ([]SessionInfo, error) {
+	return api.ListSessions(api.SessionRegistryDir())
+}
+
+// SessionFor picks the session for a working directory from sessions: the one whose project
+// (config file directory) contains dir, or the only session running.
+func SessionFor(sessions []SessionInfo, dir string) (SessionInfo, bool) {
+	return api.MatchSession(sessions, dir)
+}
+
+func (c *Client) currentToken() string {
+	if c.token != "" || c.unix {
+		return c.token
+	}
+	port := 9876
+	if u, err := url.Parse(c.baseURL); err == nil && u.Port() != "" {
+		port, _ = strconv.Atoi(u.Port())
+	}
+	token, _ := api.ReadTokenFile(api.TokenPath(port))
+	return token
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.currentToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// do sends a request and returns the body of a 2xx response.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) ([]byte, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	return data, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, out interface{}) error {
+	data, err := c.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Client) getText(ctx context.Context, path string, query url.Values) (string, error) {
+	data, err := c.do(ctx, http.MethodGet, path, query, nil)
+	return string(data), err
+}
+
+// command posts to an action endpoint; success=false becomes a *CommandError.
+func (c *Client) command(ctx context.Context, path string, body interface{}) (*CommandResponse, error) {
+	data, err := c.do(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var resp CommandResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if !resp.Success {
+		return &resp, &CommandError{Service: resp.Service, Message: resp.Message}
+	}
+	return &resp, nil
+}
+
+func servicePath(prefix, service string) string {
+	return prefix + url.PathEscape(service)
+}
+
+// Health checks that crux is running.
+func (c *Client) Health(ctx context.Context) error {
+	var out HealthResponse
+	return c.getJSON(ctx, "/health", nil, &out)
+}
+
+// Services returns the lifecycle state of every configured service.
+func (c *Client) Services(ctx context.Context) (*ServicesResponse, error) {
+	var out ServicesResponse
+	if err := c.getJSON(ctx, "/services", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Tabs lists the service tabs.
+func (c *Client) Tabs(ctx context.Context) (*TabsResponse, error) {
+	var out TabsResponse
+	if err := c.getJSON(ctx, "/tabs", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Status returns worker-mode orchestrator status.
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	var out StatusResponse
+	if err := c.getJSON(ctx, "/status", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Send types text into a service's tab (e.g. "r" for hot reload).
+func (c *Client) Send(ctx context.Context, service, text string) (*CommandResponse, error) {
+	return c.command(ctx, servicePath("/send/", service), map[string]string{"text": text})
+}
+
+// Focus activates a service's tab.
+func (c *Client) Focus(ctx context.Context, service string) (*CommandResponse, error) {
+	return c.command(ctx, servicePath("/focus/", service), nil)
+}
+
+// StartOne starts a service in a new tab.
+func (c *Client) StartOne(ctx context.Context, service string) (*CommandResponse, error) {
+	return c.command(ctx, servicePath("/start-one/", service), nil)
+}
+
+// Stop stops one service gracefully (stop_command/stop_signal, SIGKILL after stop_timeout)
+// and closes its tab. It returns once the service has exited.
+func (c *Client) Stop(ctx context.Context, service string) (*CommandResponse, error) {
+	return c.command(ctx, servicePath("/stop/", service), nil)
+}
+
+// Shutdown stops crux and all its services.
+func (c *Client) Shutdown(ctx context.Context) (*CommandResponse, error) {
+	return c.command(ctx, "/stop", nil)
+}
+
+// Reload sends r to a worker, or to all workers when service is empty (worker mode).
+func (c *Client) Reload(ctx context.Context, service string) (*CommandResponse, error) {
+	if service == "" {
+		return c.command(ctx, "/reload", nil)
+	}
+	return c.command(ctx, servicePath("/reload/", service), nil)
+}
+
+// Restart restarts one service, or sends R to all workers when service is empty. In tab mode
+// crux stops the service gracefully, starts it again and waits up to readyTimeout for the new
+// run to become ready (0 = server default of 60s); a new run that crashes is a *CommandError.
+func (c *Client) Restart(ctx context.Context, service string, readyTimeout time.Duration) (*RestartResponse, error) {
+	path := "/restart"
+	if service != "" {
+		path = servicePath("/restart/", service)
+	}
+	var query url.Values
+	if readyTimeout > 0 {
+		query = url.Values{"timeout": {readyTimeout.String()}}
+	}
+	data, err := c.do(ctx, http.MethodPost, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp RestartResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if !resp.Success {
+		return &resp, &CommandError{Service: resp.Service, Message: resp.Message}
+	}
+	return &resp, nil
+}
+
+// Actions runs a batch of operations and, with req.Wait, blocks until the affected services
+// settle. Per-service failures are reported in the results (and Success=false), not as an error.
+func (c *Client) Actions(ctx context.Context, req ActionsRequest) (*ActionsResponse, error) {
+	data, err := c.do(ctx, http.MethodPost, "/actions", nil, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp ActionsResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decode /actions: %w", err)
+	}
+	return &resp, nil
+}
+
+// Tasks lists the tasks from the config's tasks: section with their last run.
+func (c *Client) Tasks(ctx context.Context) (*TasksResponse, error) {
+	var out TasksResponse
+	if err := c.getJSON(ctx, "/tasks", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunTask runs a task and returns when it finishes. A task that ran and failed is reported in
+// the result (Success=false, ExitCode, Output), not as an error; a task that is already running
+// is a 409 *APIError.
+func (c *Client) RunTask(ctx context.Context, name string) (*TaskResult, error) {
+	path := servicePath("/tasks/", name)
+	data, err := c.do(ctx, http.MethodPost, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res TaskResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return &res, nil
+}
+
+// Exec runs a command allowed by exec.allow in the service's workdir and env and returns its
+// output and exit code. A command that ran and failed is not an error; check Success.
+func (c *Client) Exec(ctx context.Context, service string, req ExecRequest) (*ExecResponse, error) {
+	path := servicePath("/exec/", service)
+	data, err := c.do(ctx, http.MethodPost, path, nil, req)
+	if err != nil {
+		return nil, err
+	}
+	var res ExecResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return &res, nil
+}
+
+// ServiceActions lists the actions services declare under actions: in config.yaml.
+func (c *Client) ServiceActions(ctx context.Context) ([]ServiceActionInfo, error) {
+	var out api.ServiceActionsResponse
+	if err := c.getJSON(ctx, "/service-actions", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Actions, nil
+}
+
+// RunServiceAction runs one of a service's actions and returns when it is done. An exec or
+// task action that ran and failed is not an error; check Success.
+func (c *Client) RunServiceAction(ctx context.Context, service, action string) (*ServiceActionResult, error) {
+	path := servicePath("/service-actions/", service) + "/" + url.PathEscape(action)
+	data, err := c.do(ctx, http.MethodPost, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var res ServiceActionResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return &res, nil
+}
+
+// Runs lists a service's logged runs, newest first, with log size and exit code.
+func (c *Client) Runs(ctx context.Context, service string) (*RunsResponse, error) {
+	var out RunsResponse
+	if err := c.getJSON(ctx, servicePath("/runs/", service), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Wait blocks until a log line matches, the service reaches a state or a URL answers (see
+// WaitRequest). An unmet condition at the timeout is reported in the response, not as an error.
+// service may be empty when only URL is set. ctx must outlive req.Timeout.
+func (c *Client) Wait(ctx context.Context, service string, req WaitRequest) (*WaitResponse, error) {
+	path := "/wait"
+	if service != "" {
+		path = servicePath("/wait/", service)
+	}
+	data, err := c.do(ctx, http.MethodPost, path, nil, req)
+	if err != nil {
+		return nil, err
+	}
+	var res WaitResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return &res, nil
+}
+
+// Metrics returns the latest CPU/memory sample of every running service, biggest RSS first.
+func (c *Client) Metrics(ctx context.Context) (*MetricsResponse, error) {
+	var out MetricsResponse
+	if err := c.getJSON(ctx, "/metrics", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ServiceMetrics returns a service's sample history; since limits it to the last part (0 = all kept).
+func (c *Client) ServiceMetrics(ctx context.Context, service string, since time.Duration) (*ServiceMetrics, error) {
+	var query url.Values
+	if since > 0 {
+		query = url.Values{"since": {since.String()}}
+	}
+	var out ServiceMetrics
+	if err := c.getJSON(ctx, servicePath("/metrics/", service), query, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LogOptions are the query options shared by Logs and Logfile. Zero values use server defaults.
+type LogOptions struct {
+	Lines   int
+	Format  string   // FormatRaw (server default), FormatPlain or FormatHTML
+	Filters []string // JSON log filters, e.g. "level>=warn", "msg~timeout"
+	Compact bool     // render JSON lines as "time LEVEL msg key=value"
+	Raw     bool     // skip secret redaction (needs redact.allow_raw; loopback only)
+}
+
+func (o LogOptions) query() url.Values {
+	q := url.Values{}
+	if o.Lines > 0 {
+		q.Set("lines", strconv.Itoa(o.Lines))
+	}
+	if o.Format != "" {
+		q.Set("format", o.Format)
+	}
+	for _, f := range o.Filters {
+		q.Add("filter", f)
+	}
+	if o.Compact {
+		q.Set("compact", "1")
+	}
+	if o.Raw {
+		q.Set("raw", "1")
+	}
+	return q
+}
+
+// Logs returns live scrollback from a service's tab.
+func (c *Client) Logs(ctx context.Context, service string, opts LogOptions) (string, error) {
+	return c.getText(ctx, servicePath("/logs/", service), opts.query())
+}
+
+// Logfile reads a persisted run log. run is "latest" (default), "list", or a run id;
+// service "list" lists all services with logs.
+func (c *Client) Logfile(ctx context.Context, service, run string, opts LogOptions) (string, error) {
+	q := opts.query()
+	if run != "" {
+		q.Set("run", run)
+	}
+	return c.getText(ctx, servicePath("/logfile/", service), q)
+}
+
+// TimelineOptions are the query options for Timeline.
+type TimelineOptions struct {
+	Services []string // default: all services with logs
+	Since    string   // duration ("2m") or RFC3339 time; default 5m
+	Lines    int      // default 200
+	Format   string   // default FormatPlain
+}
+
+// Timeline returns log lines of several services merged in time order.
+func (c *Client) Timeline(ctx context.Context, opts TimelineOptions) (string, error) {
+	q := url.Values{}
+	if len(opts.Services) > 0 {
+		q.Set("services", strings.Join(opts.Services, ","))
+	}
+	if opts.Since != "" {
+		q.Set("since", opts.Since)
+	}
+	if opts.Lines > 0 {
+		q.Set("lines", strconv.Itoa(opts.Lines))
+	}
+	if opts.Format != "" {
+		q.Set("format", opts.Format)
+	}
+	return c.getText(ctx, "/timeline", q)
+}
+
+// CompareRuns diffs two runs of a service (defaults: a=previous, b=latest; limit 50 lines per section).
+func (c *Client) CompareRuns(ctx context.Context, service, a, b string, limit int) (string, error) {
+	q := url.Values{}
+	if a != "" {
+		q.Set("a", a)
+	}
+	if b != "" {
+		q.Set("b", b)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	return c.getText(ctx, servicePath("/logdiff/", service), q)
+}
+
+// Config returns the session's config file as YAML (comments kept, secrets masked).
+func (c *Client) Config(ctx context.Context) (string, error) {
+	return c.getText(ctx, "/config", nil)
+}
+
+// ServiceConfig returns one service's entry of the config as a one-item YAML list.
+func (c *Client) ServiceConfig(ctx context.Context, service string) (string, error) {
+	return c.getText(ctx, servicePath("/config/services/", service), nil)
+}
+
+// SetServiceConfig adds or replaces a service's entry in the session's config file. fields is
+// the whole entry (command, args, env...); masked values copied from ServiceConfig are kept as
+// they are in the file. With apply the session reloads the config and restarts the service.
+func (c *Client) SetServiceConfig(ctx context.Context, service string, fields map[string]interface{}, apply bool) (*ConfigChangeResponse, error) {
+	return c.configChange(ctx, http.MethodPut, service, fields, apply)
+}
+
+// RemoveServiceConfig deletes a service's entry from the config file. With apply the service
+// is stopped first.
+func (c *Client) RemoveServiceConfig(ctx context.Context, service string, apply bool) (*ConfigChangeResponse, error) {
+	return c.configChange(ctx, http.MethodDelete, service, nil, apply)
+}
+
+func (c *Client) configChange(ctx context.Context, method, service string, body interface{}, apply bool) (*ConfigChangeResponse, error) {
+	path := servicePath("/config/services/", service)
+	var q url.Values
+	if apply {
+		q = url.Values{"apply": {"true"}}
+	}
+	data, err := c.do(ctx, method, path, q, body)
+	if err != nil {
+		return nil, err
+	}
+	var res ConfigChangeResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return &res, nil
+}
+
+// OpenAPI returns the server's OpenAPI document.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, "/openapi.yaml", nil, nil)
+}
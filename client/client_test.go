@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glorko/crux/internal/api"
+)
+
+// fakeTabs is an in-memory api.TabController
+type fakeTabs struct {
+	sent []string
+}
+
+func (f *fakeTabs) ListTabs() ([]api.TabInfo, error) {
+	return []api.TabInfo{{Name: "backend", PaneID: "1"}, {Name: "web", PaneID: "2"}}, nil
+}
+func (f *fakeTabs) Send(service, text string) error {
+	if service != "backend" && service != "web" {
+		return errors.New("no tab named " + service)
+	}
+	f.sent = append(f.sent, service+":"+text)
+	return nil
+}
+func (f *fakeTabs) GetLogs(service string, lines int) (string, error) {
+	return "\x1b[32mlistening\x1b[0m on :8080\n", nil
+}
+func (f *fakeTabs) Focus(service string) error { return nil }
+func (f *fakeTabs) SpawnTab(title, workDir, command string, args []string) error {
+	return nil
+}
+func (f *fakeTabs) KillTab(service string) error { return nil }
+
+func newTestClient(t *testing.T) (*Client, *fakeTabs, *api.Server) {
+	t.Helper()
+	s := api.NewServer(0)
+	tabs := &fakeTabs{}
+	s.SetTabController(tabs)
+	s.SetToken("test-token")
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return New(ts.URL, "test-token"), tabs, s
+}
+
+func TestClient_TabsAndSend(t *testing.T) {
+	c, tabs, _ := newTestClient(t)
+	ctx := context.Background()
+
+	resp, err := c.Tabs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Tabs) != 2 || resp.Tabs[0].Name != "backend" {
+		t.Fatalf("Tabs = %+v", resp.Tabs)
+	}
+	if _, err := c.Send(ctx, "backend", "r"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tabs.sent) != 1 || tabs.sent[0] != "backend:r" {
+		t.Fatalf("sent = %v", tabs.sent)
+	}
+
+	_, err = c.Send(ctx, "nope", "r")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Service != "nope" {
+		t.Fatalf("Send to unknown tab: err = %v, want *CommandError", err)
+	}
+}
+
+func TestClient_LogsPlain(t *testing.T) {
+	c, _, _ := newTestClient(t)
+	got, err := c.Logs(context.Background(), "backend", LogOptions{Format: FormatPlain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "listening on :8080\n" {
+		t.Fatalf("Logs = %q", got)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	c, _, _ := newTestClient(t)
+	ctx := context.Background()
+
+	bad := New(c.baseURL, "wrong")
+	var apiErr *APIError
+	if _, err := bad.Tabs(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Fatalf("wrong token: err = %v, want 401 *APIError", err)
+	}
+	if _, err := c.Logfile(ctx, "backend", "1999-01-01_000000", LogOptions{}); !IsNotFound(err) {
+		t.Fatalf("missing run: err = %v, want not found", err)
+	}
+	down := New("http://127.0.0.1:1", "")
+	if err := down.Health(ctx); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("closed port: err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	c, _, s := newTestClient(t)
+	s.Events().Publish(api.EventServiceReady, "backend", nil)
+	s.Events().Publish(api.EventInputSent, "backend", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	since := uint64(0)
+	var got []Event
+	err := c.Events(ctx, EventOptions{Since: &since, Types: []string{"service.*"}}, func(ev Event) error {
+		got = append(got, ev)
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Events returned %v, want context.Canceled", err)
+	}
+	if len(got) != 1 || got[0].Type != api.EventServiceReady || got[0].ID != 1 {
+		t.Fatalf("events = %+v", got)
+	}
+}
+
+func TestClient_RunTask(t *testing.T) {
+	c, _, s := newTestClient(t)
+	s.SetTasks([]api.TaskSpec{{Name: "crux-client-test", Command: "echo", Args: []string{"migrated"}}})
+	t.Cleanup(func() { os.RemoveAll(filepath.Join("/tmp/crux-logs", api.TaskLogName("crux-client-test"))) })
+	ctx := context.Background()
+
+	res, err := c.RunTask(ctx, "crux-client-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success || res.ExitCode != 0 || res.Output != "migrated\n" {
+		t.Fatalf("RunTask = %+v", res)
+	}
+	tasks, err := c.Tasks(ctx)
+	if err != nil || len(tasks.Tasks) != 1 || tasks.Tasks[0].LastRunID != res.RunID {
+		t.Fatalf("Tasks = %+v, %v", tasks, err)
+	}
+	if _, err := c.RunTask(ctx, "nope"); !IsNotFound(err) {
+		t.Fatalf("unknown task: err = %v, want not found", err)
+	}
+	runs, err := c.Runs(ctx, api.TaskLogName("crux-client-test"))
+	if err != nil || len(runs.Runs) != 1 {
+		t.Fatalf("Runs = %+v, %v", runs, err)
+	}
+	if run := runs.Runs[0]; run.ID != res.RunID || !run.Latest || run.ExitCode == nil || *run.ExitCode != 0 || run.Size == 0 {
+		t.Errorf("run = %+v", run)
+	}
+}
+
+func TestClient_ServiceActions(t *testing.T) {
+	c, tabs, s := newTestClient(t)
+	s.SetServices([]api.ServiceSpec{{Name: "web", Actions: []api.ServiceAction{{Name: "reload", Send: "r"}}}})
+	ctx := context.Background()
+
+	actions, err := c.ServiceActions(ctx)
+	if err != nil || len(actions) != 1 || actions[0].Kind != api.ActionKindSend {
+		t.Fatalf("ServiceActions = %+v, %v", actions, err)
+	}
+	res, err := c.RunServiceAction(ctx, "web", "reload")
+	if err != nil || !res.Success {
+		t.Fatalf("RunServiceAction = %+v, %v", res, err)
+	}
+	if len(tabs.sent) != 1 || tabs.sent[0] != "web:r" {
+		t.Errorf("sent = %v", tabs.sent)
+	}
+	if _, err := c.RunServiceAction(ctx, "web", "nope"); !IsNotFound(err) {
+		t.Errorf("unknown action: err = %v, want not found", err)
+	}
+}
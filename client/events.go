@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// EventOptions select which events Events streams.
+type EventOptions struct {
+	Since    *uint64  // replay buffered events after this id (nil: only new events; 0: whole buffer)
+	Types    []string // e.g. "service.exited", "dependency.*"
+	Services []string
+}
+
+// Events streams server-sent events, calling fn for each, until ctx is cancelled, fn returns
+// an error, or the stream ends. To resume after a disconnect, pass the last seen ID as Since.
+func (c *Client) Events(ctx context.Context, opts EventOptions, fn func(Event) error) error {
+	q := url.Values{}
+	if opts.Since != nil {
+		q["since"] = []string{strconv.FormatUint(*opts.Since, 10)}
+	}
+	if len(opts.Types) > 0 {
+		q["types"] = []string{strings.Join(opts.Types, ",")}
+	}
+	if len(opts.Services) > 0 {
+		q["service"] = []string{strings.Join(opts.Services, ",")}
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", q, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+				return fmt.Errorf("decode event: %w", err)
+			}
+			data.Reset()
+			if err := fn(ev); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// id:, event: and ": comment" lines carry nothing the JSON payload doesn't
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glorko/crux/client"
+)
+
+// Service actions as tools: each action a service declares under actions: in config.yaml
+// (reload: {send: r}, clear_cache: {exec: ...}, reseed: {task: seed}) is advertised as a tool
+// without arguments, so the agent doesn't have to guess which keystroke or command a stack
+// understands. The list follows the config: the event watcher re-reads it when it connects to
+// crux or sees config.reloaded and sends notifications/tools/list_changed when it differs.
+
+// actionToolPrefix starts the name of every action tool: crux_action_<service>_<action>
+const actionToolPrefix = "crux_action_"
+
+// maxToolName is the longest tool name clients accept
+const maxToolName = 64
+
+// actionToolName returns the tool name for an action, keeping to [A-Za-z0-9_-]. A name too long
+// for clients is cut and ends in a hash of the service and action (see hashedToolName).
+func actionToolName(a client.ServiceActionInfo) string {
+	name := []byte(actionToolPrefix + a.Service + "_" + a.Name)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			name[i] = '_'
+		}
+	}
+	if len(name) > maxToolName {
+		return hashedToolName(string(name), a)
+	}
+	return string(name)
+}
+
+// hashedToolName cuts name to make room for "_" and 8 hex digits of a hash of the service and
+// action, so actions whose names differ only past the cut or in replaced characters stay apart.
+func hashedToolName(name string, a client.ServiceActionInfo) string {
+	sum := sha256.Sum256([]byte(a.Service + "\x00" + a.Name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	return name[:min(len(name), maxToolName-len(suffix))] + suffix
+}
+
+func actionDescription(a client.ServiceActionInfo) string {
+	var how string
+	switch a.Kind {
+	case client.ActionKindSend:
+		how = fmt.Sprintf("types %q into %s's tab", a.Target, a.Service)
+	case client.ActionKindExec:
+		how = fmt.Sprintf("runs `%s` in %s's workdir and env", a.Target, a.Service)
+	case client.ActionKindTask:
+		how = fmt.Sprintf("runs task %s", a.Target)
+	}
+	if a.Description == "" {
+		return fmt.Sprintf("%s action %s: %s.", a.Service, a.Name, how)
+	}
+	return fmt.Sprintf("%s action %s: %s (%s).", a.Service, a.Name, strings.TrimRight(a.Description, "."), how)
+}
+
+// actionTools returns the tools for the configured actions by name, in config order. When two
+// actions sanitize to the same name, the later one gets a hashed name.
+func actionTools(c *client.Client) ([]Tool, map[string]client.ServiceActionInfo, error) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	actions, err := c.ServiceActions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tools := make([]Tool, 0, len(actions))
+	byName := make(map[string]client.ServiceActionInfo, len(actions))
+	for _, a := range actions {
+		name := actionToolName(a)
+		if _, dup := byName[name]; dup {
+			name = hashedToolName(name, a)
+		}
+		if _, dup := byName[name]; dup {
+			fmt.Fprintf(os.Stderr, "crux-mcp: skipping action %s of %s: tool name %s is taken\n", a.Name, a.Service, name)
+			continue
+		}
+		byName[name] = a
+		tools = append(tools, Tool{
+			Name:        name,
+			Description: actionDescription(a),
+			InputSchema: InputSchema{Type: "object", Properties: map[string]Property{}},
+		})
+	}
+	return tools, byName, nil
+}
+
+// toolsFingerprint identifies a list of action tools, to tell when it changed.
+func toolsFingerprint(tools []Tool) string {
+	var sb strings.Builder
+	for _, t := range tools {
+		sb.WriteString(t.Name + "\x00" + t.Description + "\n")
+	}
+	return sb.String()
+}
+
+func apiServiceAction(c *client.Client, tool string) (string, bool) {
+	_, byName, err := actionTools(c)
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	a, ok := byName[tool]
+	if !ok {
+		return fmt.Sprintf("Unknown tool: %s (the action is no longer in config.yaml)", tool), true
+	}
+	// Exec and task actions are bounded by their own timeouts on the crux side
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	res, err := c.RunServiceAction(ctx, a.Service, a.Name)
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	if res.Kind == client.ActionKindSend {
+		if !res.Success {
+			return "Failed: " + res.Message, true
+		}
+		return fmt.Sprintf("Sent %q to %s", a.Target, a.Service), false
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s (%s %s): ", a.Service, a.Name, a.Kind, a.Target)
+	exitCode := -1
+	if res.ExitCode != nil {
+		exitCode = *res.ExitCode
+	}
+	switch {
+	case res.Success:
+		fmt.Fprintf(&sb, "exit 0 after %s\n", res.Duration)
+	case res.Message != "":
+		fmt.Fprintf(&sb, "%s (exit %d after %s)\n", res.Message, exitCode, res.Duration)
+	default:
+		fmt.Fprintf(&sb, "exit %d after %s\n", exitCode, res.Duration)
+	}
+	if res.LogPath != "" {
+		fmt.Fprintf(&sb, "log: %s\n", res.LogPath)
+	}
+	if res.Output != "" {
+		if res.Truncated {
+			sb.WriteString("\n(output truncated, last 32KB)")
+		}
+		sb.WriteString("\n" + res.Output)
+	}
+	return strings.TrimRight(sb.String(), "\n"), !res.Success
+}
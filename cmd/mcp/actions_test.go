@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glorko/crux/client"
+	"github.com/glorko/crux/internal/api"
+)
+
+func TestActionToolNames(t *testing.T) {
+	long := strings.Repeat("x", 60)
+	if got := actionToolName(client.ServiceActionInfo{Service: "app-ios", Name: "reload"}); got != "crux_action_app-ios_reload" {
+		t.Errorf("short name = %q", got)
+	}
+	a := actionToolName(client.ServiceActionInfo{Service: long, Name: "reload"})
+	b := actionToolName(client.ServiceActionInfo{Service: long, Name: "restart"})
+	if len(a) != maxToolName || len(b) != maxToolName || a == b {
+		t.Errorf("long names %q and %q", a, b)
+	}
+
+	s := newTestAPI(t)
+	s.SetServices([]api.ServiceSpec{
+		{Name: "web", Actions: []api.ServiceAction{{Name: "clear.cache", Send: "c"}, {Name: "clear_cache", Send: "C"}}},
+		{Name: long, Actions: []api.ServiceAction{{Name: "reload", Send: "r"}, {Name: "restart", Send: "R"}}},
+	})
+	tools, byName, err := actionTools(envAPI)
+	if err != nil || len(tools) != 4 || len(byName) != 4 {
+		t.Fatalf("actionTools = %d tools, %v", len(tools), err)
+	}
+	if tools[0].Name != "crux_action_web_clear_cache" || !strings.HasPrefix(tools[1].Name, "crux_action_web_clear_cache_") {
+		t.Errorf("sanitized duplicates = %q, %q", tools[0].Name, tools[1].Name)
+	}
+	if byName[tools[1].Name].Name != "clear_cache" {
+		t.Errorf("%s runs %+v", tools[1].Name, byName[tools[1].Name])
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glorko/crux/internal/api"
+)
+
+// Streamable HTTP transport: several agents/IDEs share one crux-mcp (crux-mcp --http 127.0.0.1:9878).
+// Everything goes through one endpoint, /mcp:
+//
+//	POST   one JSON-RPC message or a batch; responses come back as application/json (202 when
+//	       the body held only notifications). initialize starts a session whose id is returned in
+//	       Mcp-Session-Id; later requests must send it.
+//	GET    (Accept: text/event-stream) the session's stream of server-initiated messages, such as
+//	       notifications/resources/updated. Notifications sent while no stream is open are dropped.
+//	DELETE ends the session.
+//
+// Clients on 2025-06-18 or later also send MCP-Protocol-Version; an unsupported one gets 400.
+// Every request needs "Authorization: Bearer <token>" with the token from ~/.crux/mcp-<port>.token
+// (mode 0600, kept across restarts), since crux-mcp acts with the crux API token on its behalf.
+
+const (
+	mcpPath            = "/mcp"
+	sessionHeader      = "Mcp-Session-Id"
+	protocolHeader     = "MCP-Protocol-Version"
+	sessionIdleTimeout = 30 * time.Minute
+	maxRequestBody     = 4 << 20
+)
+
+// httpSession is a session plus its (at most one) open event stream.
+type httpSession struct {
+	*session
+	mu       sync.Mutex
+	stream   chan interface{} // nil while no GET stream is open
+	lastSeen time.Time
+}
+
+func (h *httpSession) push(msg interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stream == nil {
+		return
+	}
+	select {
+	case h.stream <- msg:
+	default: // client isn't reading; drop rather than block the watcher
+	}
+}
+
+func (h *httpSession) touch() {
+	h.mu.Lock()
+	h.lastSeen = time.Now()
+	h.mu.Unlock()
+}
+
+type httpTransport struct {
+	mu        sync.Mutex
+	sessions  map[string]*httpSession
+	token     string // bearer token every request must send
+	tokenPath string // where clients read it (for the 401 message)
+}
+
+// mcpTokenPath returns the token file for crux-mcp listening on port, next to the crux API tokens.
+func mcpTokenPath(port string) string {
+	return filepath.Join(filepath.Dir(api.TokenPath(0)), "mcp-"+port+".token")
+}
+
+// loadOrCreateToken returns the token stored at path, generating and storing one (0600) if
+// there is none, so client configs stay valid across restarts of crux-mcp.
+func loadOrCreateToken(path string) (string, error) {
+	if token, err := api.ReadTokenFile(path); err == nil && token != "" {
+		return token, nil
+	}
+	token, err := api.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	return token, api.WriteTokenFile(path, token)
+}
+
+// serveHTTP serves MCP over streamable HTTP until the listener fails. Only loopback addresses are
+// accepted, and only with the token: crux-mcp holds the crux API token and can run commands.
+func serveHTTP(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --http address %q: %w", addr, err)
+	}
+	if !loopbackHost(host) {
+		return fmt.Errorf("--http must listen on a loopback address (e.g. 127.0.0.1:9878), not %q", addr)
+	}
+	t := &httpTransport{sessions: make(map[string]*httpSession), tokenPath: mcpTokenPath(port)}
+	if t.token, err = loadOrCreateToken(t.tokenPath); err != nil {
+		return fmt.Errorf("token %s: %w", t.tokenPath, err)
+	}
+	go t.expireSessions()
+	mux := http.NewServeMux()
+	mux.Handle(mcpPath, t)
+	fmt.Fprintf(os.Stderr, "crux-mcp: streamable HTTP on http://%s%s (token in %s)\n", addr, mcpPath, t.tokenPath)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (t *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !localOrigin(r.Header.Get("Origin")) {
+		// Browsers send Origin; a page on another site must not drive the session (DNS rebinding)
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	if !localHost(r.Host) {
+		// A rebound DNS name reaches the loopback listener with its own name as Host
+		http.Error(w, "Host not allowed", http.StatusForbidden)
+		return
+	}
+	got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(t.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="crux-mcp"`)
+		http.Error(w, fmt.Sprintf("Unauthorized: send the token from %s as 'Authorization: Bearer <token>'", t.tokenPath), http.StatusUnauthorized)
+		return
+	}
+	if v := r.Header.Get(protocolHeader); v != "" && !supportedVersion(v) {
+		http.Error(w, "Unsupported "+protocolHeader+": "+v, http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r)
+	case http.MethodGet:
+		t.handleStream(w, r)
+	case http.MethodDelete:
+		t.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *httpTransport) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	var raw []json.RawMessage
+	if batch {
+		err = json.Unmarshal(body, &raw)
+	} else {
+		raw = []json.RawMessage{body}
+	}
+	reqs := make([]Request, len(raw))
+	for i := range raw {
+		if err == nil {
+			err = json.Unmarshal(raw[i], &reqs[i])
+		}
+	}
+	if err != nil || len(reqs) == 0 {
+		writeJSON(w, http.StatusBadRequest, newError(nil, -32700, "Parse error"))
+		return
+	}
+
+	var sess *httpSession
+	if reqs[0].Method == "initialize" {
+		if len(reqs) > 1 {
+			writeJSON(w, http.StatusBadRequest, newError(reqs[0].ID, -32600, "initialize must be sent on its own"))
+			return
+		}
+		sess = t.newSession()
+		w.Header().Set(sessionHeader, sess.id)
+	} else {
+		id := r.Header.Get(sessionHeader)
+		if id == "" {
+			writeJSON(w, http.StatusBadRequest, newError(nil, -32600, "Missing "+sessionHeader+" header (send initialize first)"))
+			return
+		}
+		if sess = t.lookup(id); sess == nil {
+			// 404 tells the client to start a new session
+			writeJSON(w, http.StatusNotFound, newError(nil, -32600, "Unknown or expired session"))
+			return
+		}
+	}
+
+	var responses []*Response
+	for _, req := range reqs {
+		if resp := handleRequest(sess.session, req); resp != nil && req.ID != nil {
+			responses = append(responses, resp)
+		}
+	}
+	sess.touch()
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeJSON(w, http.StatusOK, responses)
+	default:
+		writeJSON(w, http.StatusOK, responses[0])
+	}
+}
+
+// handleStream holds a GET open as an SSE stream of the session's notifications.
+func (t *httpTransport) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "Accept: text/event-stream required", http.StatusNotAcceptable)
+		return
+	}
+	sess := t.lookup(r.Header.Get(sessionHeader))
+	if sess == nil {
+		http.Error(w, "Unknown or missing session", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan interface{}, 64)
+	sess.mu.Lock()
+	if sess.stream != nil {
+		sess.mu.Unlock()
+		http.Error(w, "A stream is already open for this session", http.StatusConflict)
+		return
+	}
+	sess.stream = ch
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		sess.stream = nil
+		sess.lastSeen = time.Now()
+		sess.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sess.done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case msg := <-ch:
+			data, _ := json.Marshal(msg)
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+func (t *httpTransport) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(sessionHeader)
+	t.mu.Lock()
+	sess := t.sessions[id]
+	delete(t.sessions, id)
+	t.mu.Unlock()
+	if sess == nil {
+		http.Error(w, "Unknown or missing session", http.StatusNotFound)
+		return
+	}
+	sess.close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *httpTransport) newSession() *httpSession {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	hs := &httpSession{lastSeen: time.Now()}
+	hs.session = newSession(hex.EncodeToString(buf), hs.push)
+	t.mu.Lock()
+	t.sessions[hs.id] = hs
+	t.mu.Unlock()
+	return hs
+}
+
+func (t *httpTransport) lookup(id string) *httpSession {
+	if id == "" {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessions[id]
+}
+
+// expireSessions ends sessions idle for sessionIdleTimeout (clients that went away without DELETE).
+func (t *httpTransport) expireSessions() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		t.expireIdle(now)
+	}
+}
+
+// expireIdle ends the sessions without an open stream that were last seen sessionIdleTimeout before now.
+func (t *httpTransport) expireIdle(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, sess := range t.sessions {
+		sess.mu.Lock()
+		idle := sess.stream == nil && now.Sub(sess.lastSeen) > sessionIdleTimeout
+		sess.mu.Unlock()
+		if idle {
+			delete(t.sessions, id)
+			sess.close()
+		}
+	}
+}
+
+// localOrigin accepts requests without Origin (non-browser clients) or from a loopback page.
+func localOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return loopbackHost(u.Hostname())
+}
+
+// localHost reports whether a Host header names this machine's loopback interface.
+func localHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport // no port
+	}
+	return loopbackHost(strings.Trim(host, "[]"))
+}
+
+// loopbackHost reports whether host is localhost or a loopback IP.
+func loopbackHost(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalOrigin(t *testing.T) {
+	for origin, want := range map[string]bool{
+		"":                         true,
+		"http://localhost:3000":    true,
+		"http://127.0.0.1":         true,
+		"https://[::1]:8443":       true,
+		"http://evil.example":      false,
+		"http://localhost.evil.io": false,
+		"http://10.0.0.5:9878":     false,
+		"null":                     false,
+		"%zz":                      false,
+	} {
+		if got := localOrigin(origin); got != want {
+			t.Errorf("localOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestLocalHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"127.0.0.1:9878":       true,
+		"localhost:9878":       true,
+		"localhost":            true,
+		"[::1]:9878":           true,
+		"evil.example:9878":    false,
+		"localhost.evil.io:80": false,
+		"192.168.1.10:9878":    false,
+		"":                     false,
+	} {
+		if got := localHost(host); got != want {
+			t.Errorf("localHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+const testToken = "test-token"
+
+func newTestTransport(t *testing.T) (*httpTransport, *httptest.Server) {
+	t.Helper()
+	tr := &httpTransport{sessions: make(map[string]*httpSession), token: testToken}
+	ts := httptest.NewServer(tr)
+	t.Cleanup(func() {
+		ts.Close()
+		for _, sess := range tr.sessions {
+			sess.close()
+		}
+	})
+	return tr, ts
+}
+
+// newRequest returns a request to the transport carrying the test token.
+func newRequest(method, url string, body io.Reader) *http.Request {
+	req, _ := http.NewRequest(method, url, body)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	return req
+}
+
+// post sends body to the transport and returns the response and its body. header pairs
+// override the defaults; "Host" sets the request's host.
+func post(t *testing.T, url, session, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req := newRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set(sessionHeader, session)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i] == "Host" {
+			req.Host = header[i+1]
+		} else {
+			req.Header.Set(header[i], header[i+1])
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var sb strings.Builder
+	bufio.NewReader(resp.Body).WriteTo(&sb)
+	return resp, sb.String()
+}
+
+func TestHTTPTransport(t *testing.T) {
+	tr, ts := newTestTransport(t)
+	const templates = `{"jsonrpc":"2.0","id":2,"method":"resources/templates/list"}`
+
+	resp, body := post(t, ts.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	id := resp.Header.Get(sessionHeader)
+	if resp.StatusCode != http.StatusOK || id == "" || !strings.Contains(body, `"protocolVersion":"2025-06-18"`) {
+		t.Fatalf("initialize: %d %q %s", resp.StatusCode, id, body)
+	}
+	if tr.lookup(id) == nil {
+		t.Fatal("session not registered")
+	}
+
+	tests := []struct {
+		name    string
+		session string
+		body    string
+		header  []string
+		code    int
+		want    string // substring of the body
+	}{
+		{"request", id, templates, nil, http.StatusOK, `"id":2,"result":{"resourceTemplates"`},
+		{"notification only", id, `{"jsonrpc":"2.0","method":"notifications/cancelled"}`, nil, http.StatusAccepted, ""},
+		{"batch", id, `[` + templates + `,{"jsonrpc":"2.0","method":"notifications/cancelled"},{"jsonrpc":"2.0","id":3,"method":"nope"}]`, nil, http.StatusOK, `[{"jsonrpc":"2.0","id":2,"result"`},
+		{"batch with initialize", id, `[{"jsonrpc":"2.0","id":1,"method":"initialize"},` + templates + `]`, nil, http.StatusBadRequest, "initialize must be sent on its own"},
+		{"empty batch", id, `[]`, nil, http.StatusBadRequest, "Parse error"},
+		{"parse error", id, `{"jsonrpc":`, nil, http.StatusBadRequest, "Parse error"},
+		{"no session", "", templates, nil, http.StatusBadRequest, "Missing " + sessionHeader},
+		{"unknown session", "0123", templates, nil, http.StatusNotFound, "Unknown or expired session"},
+		{"foreign origin", id, templates, []string{"Origin", "http://evil.example"}, http.StatusForbidden, "Origin not allowed"},
+		{"local origin", id, templates, []string{"Origin", "http://localhost:5173"}, http.StatusOK, "resourceTemplates"},
+		{"foreign host", id, templates, []string{"Host", "evil.example:9878"}, http.StatusForbidden, "Host not allowed"},
+		{"localhost host", id, templates, []string{"Host", "localhost:9878"}, http.StatusOK, "resourceTemplates"},
+		{"no token", id, templates, []string{"Authorization", ""}, http.StatusUnauthorized, "Unauthorized"},
+		{"wrong token", id, templates, []string{"Authorization", "Bearer guess"}, http.StatusUnauthorized, "Unauthorized"},
+		{"unsupported version", id, templates, []string{protocolHeader, "1999-01-01"}, http.StatusBadRequest, "Unsupported"},
+		{"supported version", id, templates, []string{protocolHeader, "2025-03-26"}, http.StatusOK, "resourceTemplates"},
+	}
+	for _, tt := range tests {
+		resp, body := post(t, ts.URL, tt.session, tt.body, tt.header...)
+		if resp.StatusCode != tt.code || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: %d %s, want %d with %q", tt.name, resp.StatusCode, body, tt.code, tt.want)
+		}
+	}
+	_, body = post(t, ts.URL, id, `[`+templates+`,{"jsonrpc":"2.0","id":3,"method":"nope"}]`)
+	var batch []Response
+	if err := json.Unmarshal([]byte(body), &batch); err != nil || len(batch) != 2 || batch[1].Error == nil || batch[1].Error.Code != -32601 {
+		t.Errorf("batch responses = %s", body)
+	}
+
+	req := newRequest(http.MethodDelete, ts.URL, nil)
+	req.Header.Set(sessionHeader, id)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: %v %v", resp, err)
+	}
+	if resp, _ := post(t, ts.URL, id, templates); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("after DELETE: %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPStream(t *testing.T) {
+	tr, ts := newTestTransport(t)
+	sess := tr.newSession()
+
+	req := newRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set(sessionHeader, sess.id)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("GET without Accept: %v %v", resp, err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET: %v %v", resp, err)
+	}
+	defer resp.Body.Close()
+	if second, err := http.DefaultClient.Do(req); err != nil || second.StatusCode != http.StatusConflict {
+		t.Errorf("second stream: %v %v", second, err)
+	}
+
+	sess.sendNotification("notifications/resources/list_changed", nil)
+	lines := bufio.NewScanner(resp.Body)
+	var got []string
+	for len(got) < 2 && lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if len(got) != 2 || got[0] != "event: message" || got[1] != `data: {"jsonrpc":"2.0","method":"notifications/resources/list_changed"}` {
+		t.Errorf("stream = %q", got)
+	}
+}
+
+func TestExpireIdle(t *testing.T) {
+	tr := &httpTransport{sessions: make(map[string]*httpSession)}
+	idle, streaming, active := tr.newSession(), tr.newSession(), tr.newSession()
+	defer streaming.close()
+	defer active.close()
+	old := time.Now().Add(-sessionIdleTimeout - time.Minute)
+	idle.lastSeen, streaming.lastSeen = old, old
+	streaming.stream = make(chan interface{}, 1)
+
+	tr.expireIdle(time.Now())
+	if tr.lookup(idle.id) != nil || tr.lookup(streaming.id) == nil || tr.lookup(active.id) == nil {
+		t.Errorf("sessions left: %v", tr.sessions)
+	}
+	select {
+	case <-idle.done():
+	default:
+		t.Error("expired session not closed")
+	}
+	tr.expireIdle(time.Now().Add(sessionIdleTimeout + time.Second))
+	if tr.lookup(active.id) != nil {
+		t.Error("session idle past the timeout kept")
+	}
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp-9878.token")
+	token, err := loadOrCreateToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("new token = %q, %v", token, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("token file: %v %v", info, err)
+	}
+	if again, err := loadOrCreateToken(path); err != nil || again != token {
+		t.Errorf("token not kept across restarts: %q, %v", again, err)
+	}
+}
@@ -2,21 +2,23 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/glorko/crux/client"
+	"gopkg.in/yaml.v3"
 )
 
 // MCP Server for Crux - controls services via Crux API only.
 // MCP has no knowledge of wezterm or terminal - all control goes through crux.
 
-const defaultAPIURL = "http://localhost:9876"
-
 // JSON-RPC types
 type Request struct {
 	JSONRPC string          `json:"jsonrpc"`
@@ -32,6 +34,13 @@ type Response struct {
 	Error   *RPCError   `json:"error,omitempty"`
 }
 
+// Notification is a JSON-RPC message without id (server -> client here)
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 type RPCError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -49,7 +58,10 @@ type InitializeResult struct {
 }
 
 type ServerCapabilities struct {
-	Tools *ToolsCapability `json:"tools,omitempty"`
+	Tools     *ToolsCapability     `json:"tools,omitempty"`
+	Resources *ResourcesCapability `json:"resources,omitempty"`
+	Prompts   *PromptsCapability   `json:"prompts,omitempty"`
+	Logging   *LoggingCapability   `json:"logging,omitempty"`
 }
 
 type ToolsCapability struct {
@@ -57,9 +69,10 @@ type ToolsCapability struct {
 }
 
 type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema InputSchema `json:"inputSchema"`
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	InputSchema  InputSchema   `json:"inputSchema"`
+	OutputSchema *OutputSchema `json:"outputSchema,omitempty"`
 }
 
 type InputSchema struct {
@@ -69,9 +82,13 @@ type InputSchema struct {
 }
 
 type Property struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"`
+	Type        string              `json:"type"`
+	Description string              `json:"description,omitempty"`
+	Enum        []string            `json:"enum,omitempty"`
+	Format      string              `json:"format,omitempty"`
+	Items       *Property           `json:"items,omitempty"`      // type array
+	Properties  map[string]Property `json:"properties,omitempty"` // type object
+	Required    []string            `json:"required,omitempty"`
 }
 
 type ToolsListResult struct {
@@ -84,8 +101,9 @@ type CallToolParams struct {
 }
 
 type ToolResult struct {
-	Content []ContentItem `json:"content"`
-	IsError bool          `json:"isError,omitempty"`
+	Content           []ContentItem `json:"content"`
+	StructuredContent interface{}   `json:"structuredContent,omitempty"`
+	IsError           bool          `json:"isError,omitempty"`
 }
 
 type ContentItem struct {
@@ -94,6 +112,17 @@ type ContentItem struct {
 }
 
 func main() {
+	httpAddr := flag.String("http", "", "serve the MCP streamable HTTP transport on this address (e.g. 127.0.0.1:9878) instead of stdio")
+	flag.Parse()
+	if *httpAddr != "" {
+		if err := serveHTTP(*httpAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "crux-mcp:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	sess := newSession("", writeMessage)
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
 
@@ -105,44 +134,61 @@ func main() {
 
 		var req Request
 		if err := json.Unmarshal([]byte(line), &req); err != nil {
-			sendError(nil, -32700, "Parse error")
+			writeMessage(newError(nil, -32700, "Parse error"))
 			continue
 		}
 
-		handleRequest(req)
-	}
-}
-
-func getAPIURL() string {
-	if u := os.Getenv("CRUX_API_URL"); u != "" {
-		return u
+		if resp := handleRequest(sess, req); resp != nil {
+			writeMessage(resp)
+		}
 	}
-	return defaultAPIURL
 }
 
-func handleRequest(req Request) {
+// handleRequest handles one JSON-RPC message from sess and returns the response to send
+// (nil for notifications).
+func handleRequest(sess *session, req Request) *Response {
 	switch req.Method {
 	case "initialize":
+		var params InitializeParams
+		json.Unmarshal(req.Params, &params)
+		sess.protocol = negotiateVersion(params.ProtocolVersion)
 		result := InitializeResult{
-			ProtocolVersion: "2024-11-05",
-			Capabilities:    ServerCapabilities{Tools: &ToolsCapability{}},
-			ServerInfo:      ServerInfo{Name: "crux-mcp", Version: "0.10.0"},
+			ProtocolVersion: sess.protocol,
+			Capabilities: ServerCapabilities{
+				Tools:     &ToolsCapability{ListChanged: true},
+				Resources: &ResourcesCapability{Subscribe: true, ListChanged: true},
+				Prompts:   &PromptsCapability{},
+				Logging:   &LoggingCapability{},
+			},
+			ServerInfo: ServerInfo{Name: "crux-mcp", Version: "0.10.0"},
 		}
-		sendResult(req.ID, result)
+		return newResult(req.ID, result)
 
 	case "notifications/initialized":
-		// No response
+		sess.events.start()
+		return nil // No response
+
+	case "logging/setLevel":
+		var params SetLevelParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return newError(req.ID, -32602, "Invalid params")
+		}
+		if err := sess.events.setLevel(params.Level); err != nil {
+			return newError(req.ID, -32602, err.Error())
+		}
+		return newResult(req.ID, struct{}{})
 
 	case "tools/list":
 		tools := []Tool{
 			{
-				Name:        "crux_status",
-				Description: "List running service tabs. Requires crux to be running.",
-				InputSchema: InputSchema{Type: "object", Properties: map[string]Property{}},
+				Name:         "crux_status",
+				Description:  "Service status: lifecycle state (pending/starting/ready/crashed/exited/stopped), PID, uptime, ports, restarts, exit code and last error line. Requires crux to be running.",
+				InputSchema:  InputSchema{Type: "object", Properties: map[string]Property{}},
+				OutputSchema: servicesOutputSchema,
 			},
 			{
 				Name:        "crux_send",
-				Description: "Send text/keystroke to a tab (e.g. r/R for Flutter hot reload, q=quit). Technology-dependent: Flutter supports r/R; other stacks may not.",
+				Description: "Send text/keystroke to a tab, as if typed. What keys do depends on the program: r/R (hot reload/restart) and q (quit) only work for Flutter (flutter run); other stacks ignore them or treat them as input. Prefer a crux_action_<service>_<action> tool when the service declares one, and crux_reload for a full restart.",
 				InputSchema: InputSchema{
 					Type: "object",
 					Properties: map[string]Property{
@@ -158,11 +204,15 @@ func handleRequest(req Request) {
 				InputSchema: InputSchema{
 					Type: "object",
 					Properties: map[string]Property{
-						"tab":   {Type: "string", Description: "Service name or tab number"},
-						"lines": {Type: "string", Description: "Number of lines (default 50)"},
+						"tab":     {Type: "string", Description: "Service name or tab number"},
+						"lines":   {Type: "integer", Description: "Number of lines (default 50)"},
+						"format":  {Type: "string", Description: "plain (default: colors/progress bars cleaned up) or raw", Enum: []string{"plain", "raw"}},
+						"filter":  {Type: "string", Description: "JSON log filters separated by ';', e.g. 'level>=warn; user_id=42; msg~timeout'. Non-JSON lines always pass through."},
+						"compact": {Type: "boolean", Description: "Render JSON log lines compactly as 'time LEVEL msg key=value'"},
 					},
 					Required: []string{"tab"},
 				},
+				OutputSchema: logOutputSchema,
 			},
 			{
 				Name:        "crux_focus",
@@ -193,11 +243,38 @@ func handleRequest(req Request) {
 			},
 			{
 				Name:        "crux_reload",
-				Description: "Full reload: kill the tab and start the service again (kill + start_one). Use for applying migrations, config changes, or when hot reload is not supported (e.g. Go backend). For Flutter hot reload use crux_send with text 'r'.",
+				Description: "Full restart: stop the service gracefully, start it again with the same config and wait until the new run is ready (or crashes). Reports the new run id and readiness. Use for applying migrations, config changes, or when hot reload is not supported (e.g. Go backend). For Flutter hot reload use the service's reload action tool if it has one, else crux_send with text 'r'.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service": {Type: "string", Description: "Service name from config (e.g. backend, app1_ios)"},
+						"timeout": {Type: "integer", Description: "Seconds to wait for the new run to become ready (default 60)"},
+					},
+					Required: []string{"service"},
+				},
+			},
+			{
+				Name:        "crux_batch",
+				Description: "Apply one operation (start, stop, restart, send) to several services or a config group in one call, and by default wait until they are ready (or stopped). Reports per-service outcome, run id, state and timings. Prefer this over one crux_reload/crux_start_one call per service followed by polling logs.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"op":       {Type: "string", Description: "Operation", Enum: []string{"start", "stop", "restart", "send"}},
+						"services": {Type: "string", Description: "Comma-separated service names"},
+						"group":    {Type: "string", Description: "Config group name (services' groups:), or 'all'"},
+						"text":     {Type: "string", Description: "Text to send (op=send)"},
+						"wait":     {Type: "boolean", Description: "Wait until services are ready (start/restart) or stopped (stop); default true"},
+						"timeout":  {Type: "integer", Description: "Seconds to wait (default 60)"},
+					},
+					Required: []string{"op"},
+				},
+			},
+			{
+				Name:        "crux_run_task",
+				Description: "Run a one-off task from the config's tasks: section (migrate, seed, codegen, lint) and wait for it to finish. Returns exit code and output; the run is logged under /tmp/crux-logs/task-<name>/. Use instead of typing commands into a service tab. Without task, lists the available tasks.",
 				InputSchema: InputSchema{
 					Type:       "object",
-					Properties: map[string]Property{"service": {Type: "string", Description: "Service name from config (e.g. backend, app1_ios)"}},
-					Required:   []string{"service"},
+					Properties: map[string]Property{"task": {Type: "string", Description: "Task name from config (e.g. migrate)"}},
 				},
 			},
 			{
@@ -208,29 +285,163 @@ func handleRequest(req Request) {
 					Properties: map[string]Property{
 						"service": {Type: "string", Description: "Service name or 'list' for all"},
 						"run":     {Type: "string", Description: "'latest', 'list', or timestamp"},
-						"lines":   {Type: "string", Description: "Lines to read (default 100)"},
+						"lines":   {Type: "integer", Description: "Lines to read (default 100)"},
+						"format":  {Type: "string", Description: "plain (default: colors/progress bars cleaned up) or raw", Enum: []string{"plain", "raw"}},
+						"filter":  {Type: "string", Description: "JSON log filters separated by ';', e.g. 'level>=warn; user_id=42; msg~timeout'. Non-JSON lines always pass through."},
+						"compact": {Type: "boolean", Description: "Render JSON log lines compactly as 'time LEVEL msg key=value'"},
+					},
+					Required: []string{"service"},
+				},
+				OutputSchema: logOutputSchema,
+			},
+			{
+				Name:        "crux_timeline",
+				Description: "Interleave recent log lines from several services in time order, each prefixed with the service name. Reads persisted log files, so crashed services are included. Use to follow a request across frontend -> backend -> worker.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"services": {Type: "string", Description: "Comma-separated service names (default: all services with logs)"},
+						"since":    {Type: "string", Description: "How far back to look, e.g. 30s, 2m, 1h (default 5m)"},
+						"lines":    {Type: "integer", Description: "Max lines to return (default 200)"},
+					},
+				},
+			},
+			{
+				Name:        "crux_compare_runs",
+				Description: "Compare two runs of a service: shows which lines, warnings and errors are new in run B versus run A, with timestamps/PIDs/ports normalized. Default compares the previous run (A) with the latest (B). Use when a service that used to work now fails.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service": {Type: "string", Description: "Service name"},
+						"a":       {Type: "string", Description: "Older run timestamp, 'previous' (default) or 'latest' (see crux_logfile run=list)"},
+						"b":       {Type: "string", Description: "Newer run timestamp or 'latest' (default)"},
+					},
+					Required: []string{"service"},
+				},
+			},
+			{
+				Name:        "crux_metrics",
+				Description: "CPU, memory (RSS), threads and open files of each service's process tree (the service and everything it spawned). Without service: all running services, biggest memory user first - use to find which tab is eating RAM or CPU. With service: its history over the last minutes.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service": {Type: "string", Description: "Service name (default: all running services)"},
+						"since":   {Type: "string", Description: "History window for a service, e.g. 5m, 1h (default: all samples kept)"},
+					},
+				},
+			},
+			{
+				Name:        "crux_wait_for",
+				Description: "Block until a line matching a regex appears in a service's log, the service reaches a state, or a URL answers - instead of polling crux_logs in a loop. Returns the matching line and how long it took. Use after triggering a hot reload, rebuild or migration (e.g. pattern 'Reloaded \\d+ of'). Gives up early if the service crashes while waiting.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service":    {Type: "string", Description: "Service name (optional when only url is given)"},
+						"pattern":    {Type: "string", Description: "Regex matched against each new log line (colors stripped)"},
+						"state":      {Type: "string", Description: "Wait until the service is in this state", Enum: []string{"pending", "starting", "ready", "crashed", "exited", "stopped"}},
+						"url":        {Type: "string", Description: "Wait until a GET to this URL answers with a status below 400"},
+						"timeout":    {Type: "integer", Description: "Seconds to wait (default 60, max 600)"},
+						"from_start": {Type: "boolean", Description: "Also match lines already in the current run's log (default: only output after the call)"},
+					},
+				},
+			},
+			{
+				Name:        "crux_config_get",
+				Description: "Read the crux config.yaml of the running session (comments kept, secrets masked as ****). With service: just that service's entry. Use before crux_config_set_service.",
+				InputSchema: InputSchema{
+					Type:       "object",
+					Properties: map[string]Property{"service": {Type: "string", Description: "Service name (default: the whole file)"}},
+				},
+			},
+			{
+				Name:        "crux_config_set_service",
+				Description: "Add or replace a service in config.yaml without hand-editing YAML: pass the whole entry (command, args, workdir, env, ports, groups...) as an object. crux validates it, writes the file atomically and keeps comments; values left as **** keep their real value. With apply=true the session reloads the config and restarts the service (or starts it, if new). A command that is new or changed (command and args, exec actions) must match exec.allow; a new or changed stop_command, workdir or env value needs exec.allow \"*\".",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service": {Type: "string", Description: "Service name"},
+						"config":  {Type: "object", Description: "The service's fields, e.g. {\"command\": \"npm\", \"args\": [\"run\", \"dev\"], \"workdir\": \"./web\", \"ports\": [3000]}"},
+						"apply":   {Type: "boolean", Description: "Restart the service with the new config now (default false: takes effect on the next start)"},
+					},
+					Required: []string{"service", "config"},
+				},
+			},
+			{
+				Name:        "crux_config_remove_service",
+				Description: "Remove a service from config.yaml (comments elsewhere kept). With apply=true the service is stopped and its tab closed first.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service": {Type: "string", Description: "Service name"},
+						"apply":   {Type: "boolean", Description: "Stop the service now (default false)"},
 					},
 					Required: []string{"service"},
 				},
 			},
+			{
+				Name:        "crux_exec",
+				Description: "Run a one-off command (tests, a migration check, a CLI query) in a service's workdir with its env, without typing into the service's tab. Returns output and exit code. Only commands matching exec.allow in config.yaml may run; there is no shell, so pipes and ; are not interpreted.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"service": {Type: "string", Description: "Service whose workdir and env to use"},
+						"command": {Type: "string", Description: "Command line, e.g. 'go test ./internal/...' (quotes are honoured)"},
+						"timeout": {Type: "integer", Description: "Seconds before the command is killed (default: exec.timeout or 60, max 600)"},
+					},
+					Required: []string{"service", "command"},
+				},
+			},
+			{
+				Name:        "crux_sessions",
+				Description: "List the running crux sessions (one per project) and which one crux-mcp talks to. By default that is the session whose project contains the working directory; pass use to pick another.",
+				InputSchema: InputSchema{
+					Type: "object",
+					Properties: map[string]Property{
+						"use": {Type: "string", Description: "Session to use from now on: its pid, project directory or project name; 'auto' to select by working directory again"},
+					},
+				},
+			},
 		}
-		sendResult(req.ID, ToolsListResult{Tools: tools})
+		// Actions services declare in config.yaml, as tools without arguments
+		actions, _, _ := actionTools(sess.crux.api())
+		sess.events.listedTools(toolsFingerprint(actions))
+		tools = append(tools, actions...)
+		if !sess.structured() {
+			for i := range tools {
+				tools[i].OutputSchema = nil
+			}
+		}
+		return newResult(req.ID, ToolsListResult{Tools: tools})
+
+	case "resources/list", "resources/templates/list", "resources/read", "resources/subscribe", "resources/unsubscribe":
+		return handleResourceRequest(sess, req)
+
+	case "prompts/list", "prompts/get":
+		return handlePromptRequest(sess, req)
 
 	case "tools/call":
 		var params CallToolParams
 		if err := json.Unmarshal(req.Params, &params); err != nil {
-			sendError(req.ID, -32602, "Invalid params")
-			return
+			return newError(req.ID, -32602, "Invalid params")
+		}
+		result := handleToolCall(sess, params)
+		if !sess.structured() {
+			result.StructuredContent = nil
 		}
-		handleToolCall(req.ID, params)
+		return newResult(req.ID, result)
 
 	default:
-		sendError(req.ID, -32601, fmt.Sprintf("Method not found: %s", req.Method))
+		if req.ID == nil && strings.HasPrefix(req.Method, "notifications/") {
+			return nil // notifications we don't act on (cancelled, roots changed...) get no response
+		}
+		return newError(req.ID, -32601, fmt.Sprintf("Method not found: %s", req.Method))
 	}
 }
 
-func handleToolCall(id interface{}, params CallToolParams) {
+func handleToolCall(sess *session, params CallToolParams) ToolResult {
+	c := sess.crux.api()
 	var result string
+	var structured interface{}
 	var isError bool
 
 	args := params.Arguments
@@ -240,133 +451,178 @@ func handleToolCall(id interface{}, params CallToolParams) {
 
 	switch params.Name {
 	case "crux_status":
-		result, isError = apiGetTabs()
+		var out *client.ServicesResponse
+		result, out, isError = apiGetServices(c)
+		if out != nil {
+			structured = out
+		}
 	case "crux_send":
 		tab, _ := args["tab"].(string)
 		text, _ := args["text"].(string)
-		result, isError = apiSend(tab, text)
+		result, isError = apiSend(c, tab, text)
 	case "crux_logs":
 		tab, _ := args["tab"].(string)
-		lines, _ := args["lines"].(string)
-		result, isError = apiLogs(tab, lines)
+		var out *LogOutput
+		result, out, isError = apiLogs(c, tab, logOptions(args))
+		if out != nil {
+			structured = out
+		}
 	case "crux_focus":
 		tab, _ := args["tab"].(string)
-		result, isError = apiFocus(tab)
+		result, isError = apiFocus(c, tab)
 	case "crux_start_one":
 		service, _ := args["service"].(string)
-		result, isError = apiStartOne(service)
+		result, isError = apiStartOne(c, service)
 	case "crux_kill":
 		service, _ := args["service"].(string)
-		result, isError = apiKill(service)
+		result, isError = apiKill(c, service)
 	case "crux_reload":
 		service, _ := args["service"].(string)
-		result, isError = apiReload(service)
+		result, isError = apiReload(c, service, intArg(args, "timeout"))
+	case "crux_batch":
+		result, isError = apiBatch(c, args)
+	case "crux_run_task":
+		task, _ := args["task"].(string)
+		result, isError = apiRunTask(c, task)
 	case "crux_logfile":
 		service, _ := args["service"].(string)
 		run, _ := args["run"].(string)
-		lines, _ := args["lines"].(string)
-		result, isError = apiLogfile(service, run, lines)
+		var out *LogOutput
+		result, out, isError = apiLogfile(c, service, run, logOptions(args))
+		if out != nil {
+			structured = out
+		}
+	case "crux_timeline":
+		services, _ := args["services"].(string)
+		since, _ := args["since"].(string)
+		result, isError = apiTimeline(c, services, since, intArg(args, "lines"))
+	case "crux_compare_runs":
+		service, _ := args["service"].(string)
+		a, _ := args["a"].(string)
+		b, _ := args["b"].(string)
+		result, isError = apiCompareRuns(c, service, a, b)
+	case "crux_metrics":
+		service, _ := args["service"].(string)
+		since, _ := args["since"].(string)
+		result, isError = apiMetrics(c, service, since)
+	case "crux_wait_for":
+		result, isError = apiWaitFor(c, args)
+	case "crux_config_get":
+		service, _ := args["service"].(string)
+		result, isError = apiConfigGet(c, service)
+	case "crux_config_set_service":
+		result, isError = apiConfigSet(c, args)
+	case "crux_config_remove_service":
+		service, _ := args["service"].(string)
+		apply, _ := args["apply"].(bool)
+		result, isError = apiConfigRemove(c, service, apply)
+	case "crux_exec":
+		service, _ := args["service"].(string)
+		command, _ := args["command"].(string)
+		result, isError = apiExec(c, service, command, intArg(args, "timeout"))
+	case "crux_sessions":
+		use, _ := args["use"].(string)
+		result, isError = apiSessions(sess.crux, use)
 	default:
+		if strings.HasPrefix(params.Name, actionToolPrefix) {
+			result, isError = apiServiceAction(c, params.Name)
+			break
+		}
 		result = "Unknown tool: " + params.Name
 		isError = true
 	}
 
-	sendResult(id, ToolResult{
-		Content: []ContentItem{{Type: "text", Text: result}},
-		IsError: isError,
-	})
-}
-
-func apiRequest(method, path string, body []byte) (*http.Response, error) {
-	url := getAPIURL() + path
-	var req *http.Request
-	var err error
-	if body != nil {
-		req, err = http.NewRequest(method, url, bytes.NewReader(body))
-	} else {
-		req, err = http.NewRequest(method, url, nil)
-	}
-	if err != nil {
-		return nil, err
-	}
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-	return http.DefaultClient.Do(req)
-}
-
-func apiGet(path string) (string, error) {
-	resp, err := apiRequest(http.MethodGet, path, nil)
-	if err != nil {
-		return "", err
+	return ToolResult{
+		Content:           []ContentItem{{Type: "text", Text: result}},
+		StructuredContent: structured,
+		IsError:           isError,
 	}
-	defer resp.Body.Close()
-	data, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API %s: %s", resp.Status, strings.TrimSpace(string(data)))
-	}
-	return string(data), nil
 }
 
-func apiPost(path string, body interface{}) (string, error) {
-	var b []byte
-	if body != nil {
-		b, _ = json.Marshal(body)
-	}
-	resp, err := apiRequest(http.MethodPost, path, b)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	data, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
-		return "", fmt.Errorf("API %s: %s", resp.Status, strings.TrimSpace(string(data)))
-	}
-	return string(data), nil
+// apiContext bounds a single API call
+func apiContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 30*time.Second)
 }
 
-func apiGetTabs() (string, bool) {
-	data, err := apiGet("/tabs")
+func apiGetServices(c *client.Client) (string, *client.ServicesResponse, bool) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	out, err := c.Services(ctx)
 	if err != nil {
-		return "Crux API not available. Is crux running? " + err.Error(), true
+		return "Crux API not available. Is crux running? " + err.Error(), nil, true
 	}
-	var out struct {
-		Tabs   []struct {
-			Name    string `json:"name"`
-			LogPath string `json:"log_path"`
-		} `json:"tabs"`
-		Uptime string `json:"uptime"`
+	if out.Services == nil {
+		out.Services = []client.ServiceStatus{} // the output schema wants an array
 	}
-	if err := json.Unmarshal([]byte(data), &out); err != nil {
-		return "Failed to parse API response: " + data, true
+	if len(out.Services) == 0 {
+		return "No services. Run 'crux' to start services.", out, false
 	}
-	if len(out.Tabs) == 0 {
-		return "No tabs. Run 'crux' to start services.", false
+	// Actions are listed under their service; a crux without them just lists none
+	actions := map[string][]string{}
+	if tools, byName, err := actionTools(c); err == nil {
+		for _, tool := range tools {
+			a := byName[tool.Name]
+			actions[a.Service] = append(actions[a.Service], fmt.Sprintf("%s (%s)", a.Name, tool.Name))
+		}
 	}
 	var b strings.Builder
-	b.WriteString("Crux Tabs\n")
-	b.WriteString("=========\n\n")
-	for i, t := range out.Tabs {
-		b.WriteString(fmt.Sprintf("Tab %d: %s\n", i+1, t.Name))
-		b.WriteString(fmt.Sprintf("  Log: %s\n\n", t.LogPath))
+	b.WriteString(fmt.Sprintf("Crux Services (session uptime %s)\n", out.Uptime))
+	b.WriteString("==============\n\n")
+	for i, svc := range out.Services {
+		b.WriteString(fmt.Sprintf("%d. %s: %s\n", i+1, svc.Name, strings.ToUpper(string(svc.State))))
+		if svc.PID > 0 {
+			b.WriteString(fmt.Sprintf("  PID: %d, uptime %s\n", svc.PID, svc.Uptime))
+		}
+		if svc.ExitCode != nil {
+			b.WriteString(fmt.Sprintf("  Exit code: %d\n", *svc.ExitCode))
+		}
+		if len(svc.Ports) > 0 {
+			ports := make([]string, len(svc.Ports))
+			for j, p := range svc.Ports {
+				ports[j] = strconv.Itoa(p)
+			}
+			b.WriteString(fmt.Sprintf("  Ports: %s\n", strings.Join(ports, ", ")))
+		}
+		for _, h := range svc.PortHolders {
+			if !h.Own {
+				b.WriteString(fmt.Sprintf("  Port %d held by %s\n", h.Port, h))
+			}
+		}
+		if m := svc.Metrics; m != nil {
+			b.WriteString(fmt.Sprintf("  CPU: %.1f%%, RSS: %s, %d processes\n", m.CPUPercent, m.RSS, m.Processes))
+		}
+		if svc.RestartCount > 0 {
+			b.WriteString(fmt.Sprintf("  Restarts: %d\n", svc.RestartCount))
+		}
+		if svc.RunID != "" {
+			b.WriteString(fmt.Sprintf("  Run: %s\n", svc.RunID))
+		}
+		if svc.LastError != "" {
+			b.WriteString(fmt.Sprintf("  Last error: %s\n", svc.LastError))
+		}
+		if !svc.HasTab {
+			b.WriteString("  (no tab)\n")
+		}
+		if svc.LogPath != "" {
+			b.WriteString(fmt.Sprintf("  Log: %s\n", svc.LogPath))
+		}
+		if names := actions[svc.Name]; len(names) > 0 {
+			b.WriteString(fmt.Sprintf("  Actions: %s\n", strings.Join(names, ", ")))
+		}
+		b.WriteString("\n")
 	}
-	b.WriteString("Commands: r=reload, R=restart, q=quit\n")
-	return b.String(), false
+	return b.String(), out, false
 }
 
-func resolveTabRef(tabRef string) (string, error) {
+func resolveTabRef(c *client.Client, tabRef string) (string, error) {
 	// Try numeric (1-based tab number)
 	if idx, err := strconv.Atoi(tabRef); err == nil && idx >= 1 {
-		data, err := apiGet("/tabs")
+		ctx, cancel := apiContext()
+		defer cancel()
+		out, err := c.Tabs(ctx)
 		if err != nil {
 			return "", err
 		}
-		var out struct {
-			Tabs []struct{ Name string } `json:"tabs"`
-		}
-		if err := json.Unmarshal([]byte(data), &out); err != nil {
-			return "", err
-		}
 		if idx <= len(out.Tabs) {
 			return out.Tabs[idx-1].Name, nil
 		}
@@ -374,133 +630,550 @@ func resolveTabRef(tabRef string) (string, error) {
 	return tabRef, nil // use as service name
 }
 
-func apiSend(tab, text string) (string, bool) {
-	service, err := resolveTabRef(tab)
+func apiSend(c *client.Client, tab, text string) (string, bool) {
+	service, err := resolveTabRef(c, tab)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	_, err = apiPost("/send/"+service, map[string]string{"text": text})
-	if err != nil {
+	ctx, cancel := apiContext()
+	defer cancel()
+	if _, err := c.Send(ctx, service, text); err != nil {
 		return "Failed: " + err.Error(), true
 	}
 	return fmt.Sprintf("Sent '%s' to %s", text, service), false
 }
 
-func apiLogs(tab, lines string) (string, bool) {
-	service, err := resolveTabRef(tab)
+// logOptions builds log query options from the lines/format/filter/compact tool arguments.
+// MCP output defaults to plain text; filter is a ';'-separated list of JSON log filters.
+func logOptions(args map[string]interface{}) client.LogOptions {
+	format, _ := args["format"].(string)
+	if format == "" {
+		format = client.FormatPlain
+	}
+	opts := client.LogOptions{Lines: intArg(args, "lines"), Format: format}
+	if filter, _ := args["filter"].(string); filter != "" {
+		for _, expr := range strings.Split(filter, ";") {
+			if expr = strings.TrimSpace(expr); expr != "" {
+				opts.Filters = append(opts.Filters, expr)
+			}
+		}
+	}
+	opts.Compact, _ = args["compact"].(bool)
+	return opts
+}
+
+func apiLogs(c *client.Client, tab string, opts client.LogOptions) (string, *LogOutput, bool) {
+	service, err := resolveTabRef(c, tab)
 	if err != nil {
-		return "Failed: " + err.Error(), true
+		return "Failed: " + err.Error(), nil, true
 	}
-	path := "/logs/" + service
-	if lines != "" {
-		path += "?lines=" + lines
+	ctx, cancel := apiContext()
+	defer cancel()
+	data, err := c.Logs(ctx, service, opts)
+	if err != nil {
+		return "Failed: " + err.Error(), nil, true
 	}
-	data, err := apiGet(path)
+	return fmt.Sprintf("=== %s (scrollback) ===\n\n%s", service, data), newLogOutput(service, "", "scrollback", data), false
+}
+
+func apiFocus(c *client.Client, tab string) (string, bool) {
+	service, err := resolveTabRef(c, tab)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	return fmt.Sprintf("=== %s (scrollback) ===\n\n%s", service, data), false
+	ctx, cancel := apiContext()
+	defer cancel()
+	if _, err := c.Focus(ctx, service); err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	return "Focused " + service, false
 }
 
-func apiFocus(tab string) (string, bool) {
-	service, err := resolveTabRef(tab)
+func apiStartOne(c *client.Client, service string) (string, bool) {
+	if service == "" {
+		return "Service name required", true
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	resp, err := c.StartOne(ctx, service)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	_, err = apiPost("/focus/"+service, nil)
+	return resp.Message, false
+}
+
+func apiKill(c *client.Client, service string) (string, bool) {
+	if service == "" {
+		return "Service name required", true
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	resp, err := c.Stop(ctx, service)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	return "Focused " + service, false
+	return resp.Message, false
 }
 
-func apiStartOne(service string) (string, bool) {
+func apiReload(c *client.Client, service string, timeout int) (string, bool) {
 	if service == "" {
 		return "Service name required", true
 	}
-	data, err := apiPost("/start-one/"+service, nil)
+	ready := time.Duration(timeout) * time.Second
+	if ready <= 0 {
+		ready = 60 * time.Second
+	}
+	// Leave room for the graceful stop (stop_timeout) on top of the readiness wait
+	ctx, cancel := context.WithTimeout(context.Background(), ready+90*time.Second)
+	defer cancel()
+	resp, err := c.Restart(ctx, service, ready)
+	if resp == nil {
+		return "Failed: " + err.Error(), true
+	}
+	var sb strings.Builder
+	sb.WriteString(resp.Message + "\n")
+	if resp.RunID != "" {
+		fmt.Fprintf(&sb, "run: %s", resp.RunID)
+		if resp.PreviousRunID != "" {
+			fmt.Fprintf(&sb, " (previous %s)", resp.PreviousRunID)
+		}
+		sb.WriteString("\n")
+	}
+	if resp.State != "" {
+		fmt.Fprintf(&sb, "state: %s, ready: %v\n", resp.State, resp.Ready)
+	}
+	if resp.Duration != "" {
+		fmt.Fprintf(&sb, "took: %s\n", resp.Duration)
+	}
+	if resp.LastError != "" {
+		fmt.Fprintf(&sb, "last error: %s\n", resp.LastError)
+	}
+	return strings.TrimRight(sb.String(), "\n"), err != nil
+}
+
+func apiBatch(c *client.Client, args map[string]interface{}) (string, bool) {
+	action := client.Action{}
+	action.Op, _ = args["op"].(string)
+	action.Group, _ = args["group"].(string)
+	action.Text, _ = args["text"].(string)
+	services, _ := args["services"].(string)
+	for _, name := range strings.Split(services, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			action.Services = append(action.Services, name)
+		}
+	}
+	req := client.ActionsRequest{Actions: []client.Action{action}, Wait: true}
+	if wait, ok := args["wait"].(bool); ok {
+		req.Wait = wait
+	}
+	wait := time.Duration(intArg(args, "timeout")) * time.Second
+	if wait <= 0 {
+		wait = 60 * time.Second
+	}
+	req.Timeout = wait.String()
+
+	// Services are handled one after another (each may take its stop_timeout), then waited on together
+	ctx, cancel := context.WithTimeout(context.Background(), wait+5*time.Minute)
+	defer cancel()
+	resp, err := c.Actions(ctx, req)
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	var sb strings.Builder
+	for _, r := range resp.Results {
+		mark := "✓"
+		if !r.Success {
+			mark = "✗"
+		}
+		fmt.Fprintf(&sb, "%s %s %s: %s (%s", mark, r.Op, r.Service, r.Message, r.Duration)
+		if r.WaitDuration != "" {
+			fmt.Fprintf(&sb, ", %s after %s", r.State, r.WaitDuration)
+		}
+		sb.WriteString(")")
+		if r.RunID != "" {
+			sb.WriteString(" run " + r.RunID)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "took %s", resp.Duration)
+	return sb.String(), !resp.Success
+}
+
+func apiWaitFor(c *client.Client, args map[string]interface{}) (string, bool) {
+	service, _ := args["service"].(string)
+	req := client.WaitRequest{}
+	req.Pattern, _ = args["pattern"].(string)
+	req.URL, _ = args["url"].(string)
+	req.FromStart, _ = args["from_start"].(bool)
+	state, _ := args["state"].(string)
+	req.State = client.ServiceState(state)
+	wait := time.Duration(intArg(args, "timeout")) * time.Second
+	if wait <= 0 {
+		wait = 60 * time.Second
+	}
+	req.Timeout = wait.String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait+30*time.Second)
+	defer cancel()
+	resp, err := c.Wait(ctx, service, req)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	var out struct {
-		Success bool   `json:"success"`
-		Message string `json:"message"`
+	if !resp.Success {
+		return resp.Message, true
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "matched after %s", resp.Elapsed)
+	if resp.Line != "" {
+		fmt.Fprintf(&sb, ": %s", resp.Line)
+		if resp.RunID != "" {
+			fmt.Fprintf(&sb, "\nrun: %s", resp.RunID)
+		}
 	}
-	if err := json.Unmarshal([]byte(data), &out); err != nil {
-		return data, false
+	if req.State != "" {
+		fmt.Fprintf(&sb, "\nstate: %s", resp.State)
 	}
-	if !out.Success {
-		return "Failed: " + out.Message, true
+	if req.URL != "" {
+		fmt.Fprintf(&sb, "\n%s answered %d", req.URL, resp.HTTPStatus)
 	}
-	return out.Message, false
+	return sb.String(), false
 }
 
-func apiKill(service string) (string, bool) {
+func apiConfigGet(c *client.Client, service string) (string, bool) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	var out string
+	var err error
 	if service == "" {
-		return "Service name required", true
+		out, err = c.Config(ctx)
+	} else {
+		out, err = c.ServiceConfig(ctx, service)
 	}
-	data, err := apiPost("/stop/"+service, nil)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	var out struct {
-		Success bool   `json:"success"`
-		Message string `json:"message"`
-	}
-	if err := json.Unmarshal([]byte(data), &out); err != nil {
-		return data, false
+	return out, false
+}
+
+func apiConfigSet(c *client.Client, args map[string]interface{}) (string, bool) {
+	service, _ := args["service"].(string)
+	apply, _ := args["apply"].(bool)
+	if service == "" {
+		return "Service name required", true
 	}
-	if !out.Success {
-		return "Failed: " + out.Message, true
+	var fields map[string]interface{}
+	switch v := args["config"].(type) {
+	case map[string]interface{}:
+		fields = v
+	case string:
+		// Some clients send objects as JSON (or YAML) text
+		if err := yaml.Unmarshal([]byte(v), &fields); err != nil || fields == nil {
+			return "config must be an object with the service's fields", true
+		}
+	default:
+		return "config must be an object with the service's fields", true
 	}
-	return out.Message, false
+	// A restart with apply stops the old run first (up to its stop_timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	resp, err := c.SetServiceConfig(ctx, service, fields, apply)
+	return configChangeText(resp, err)
 }
 
-func apiReload(service string) (string, bool) {
+func apiConfigRemove(c *client.Client, service string, apply bool) (string, bool) {
 	if service == "" {
 		return "Service name required", true
 	}
-	// Full reload = kill tab then start one
-	killMsg, killErr := apiKill(service)
-	startMsg, startErr := apiStartOne(service)
-	if startErr {
-		if killErr {
-			return "Kill: " + killMsg + "; start failed: " + startMsg, true
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	resp, err := c.RemoveServiceConfig(ctx, service, apply)
+	return configChangeText(resp, err)
+}
+
+func configChangeText(resp *client.ConfigChangeResponse, err error) (string, bool) {
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	var sb strings.Builder
+	sb.WriteString(resp.Message)
+	if r := resp.Restart; r != nil && r.RunID != "" {
+		fmt.Fprintf(&sb, "\nrun: %s (use crux_wait_for state=ready to wait for it)", r.RunID)
+	}
+	if !resp.Applied && resp.Success {
+		sb.WriteString("\nSaved to the file only: the running session keeps the old definition until crux restarts. Pass apply=true to use it now.")
+	}
+	if resp.Config != "" {
+		sb.WriteString("\n\n" + strings.TrimRight(resp.Config, "\n"))
+	}
+	return sb.String(), !resp.Success
+}
+
+func apiExec(c *client.Client, service, command string, timeout int) (string, bool) {
+	if service == "" || command == "" {
+		return "service and command required", true
+	}
+	req := client.ExecRequest{Command: command}
+	wait := 10 * time.Minute
+	if timeout > 0 {
+		wait = time.Duration(timeout) * time.Second
+		req.Timeout = wait.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wait+30*time.Second)
+	defer cancel()
+	res, err := c.Exec(ctx, service, req)
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "$ %s\n", command)
+	switch {
+	case res.Success:
+		fmt.Fprintf(&sb, "exit 0 after %s\n", res.Duration)
+	case res.Message != "":
+		fmt.Fprintf(&sb, "%s (exit %d after %s)\n", res.Message, res.ExitCode, res.Duration)
+	default:
+		fmt.Fprintf(&sb, "exit %d after %s\n", res.ExitCode, res.Duration)
+	}
+	if res.LogPath != "" {
+		fmt.Fprintf(&sb, "log: %s\n", res.LogPath)
+	}
+	if res.Output != "" {
+		if res.Truncated {
+			sb.WriteString("\n(output truncated, last 32KB)")
+		}
+		sb.WriteString("\n" + res.Output)
+	}
+	return strings.TrimRight(sb.String(), "\n"), !res.Success
+}
+
+func apiRunTask(c *client.Client, task string) (string, bool) {
+	if task == "" {
+		ctx, cancel := apiContext()
+		defer cancel()
+		resp, err := c.Tasks(ctx)
+		if err != nil {
+			return "Failed: " + err.Error(), true
 		}
-		return "Start failed: " + startMsg, true
+		if len(resp.Tasks) == 0 {
+			return "No tasks configured (add a tasks: section to config.yaml)", false
+		}
+		var sb strings.Builder
+		for _, t := range resp.Tasks {
+			fmt.Fprintf(&sb, "%s: %s", t.Name, t.Command)
+			if t.Description != "" {
+				fmt.Fprintf(&sb, " - %s", t.Description)
+			}
+			if len(t.DependsOn) > 0 {
+				fmt.Fprintf(&sb, " (needs %s)", strings.Join(t.DependsOn, ", "))
+			}
+			switch {
+			case t.Running:
+				sb.WriteString(" [running]")
+			case t.LastExitCode != nil:
+				fmt.Fprintf(&sb, " [last run %s: exit %d]", t.LastRunID, *t.LastExitCode)
+			}
+			sb.WriteString("\n")
+		}
+		return strings.TrimRight(sb.String(), "\n"), false
+	}
+	// Tasks are bounded by their own timeout on the crux side
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	res, err := c.RunTask(ctx, task)
+	if err != nil {
+		return "Failed: " + err.Error(), true
 	}
-	if killErr {
-		return "Reloaded " + service + " (kill had issues: " + killMsg + "). " + startMsg, false
+	var sb strings.Builder
+	switch {
+	case res.Success:
+		fmt.Fprintf(&sb, "%s finished in %s (exit 0)\n", task, res.Duration)
+	case res.Message != "":
+		fmt.Fprintf(&sb, "%s: %s\n", task, res.Message)
+	default:
+		fmt.Fprintf(&sb, "%s failed with exit code %d after %s\n", task, res.ExitCode, res.Duration)
+	}
+	if res.LogPath != "" {
+		fmt.Fprintf(&sb, "log: %s\n", res.LogPath)
+	}
+	if res.Output != "" {
+		if res.Truncated {
+			sb.WriteString("\n(output truncated, last 32KB)")
+		}
+		sb.WriteString("\n" + res.Output)
 	}
-	return "Reloaded " + service + ": " + startMsg, false
+	return strings.TrimRight(sb.String(), "\n"), !res.Success
 }
 
-func apiLogfile(service, run, lines string) (string, bool) {
+func apiLogfile(c *client.Client, service, run string, opts client.LogOptions) (string, *LogOutput, bool) {
 	if run == "" {
 		run = "latest"
 	}
-	path := "/logfile/" + service + "?run=" + run
-	if lines != "" {
-		path += "&lines=" + lines
+	ctx, cancel := apiContext()
+	defer cancel()
+	data, err := c.Logfile(ctx, service, run, opts)
+	if err != nil {
+		return "Failed: " + err.Error(), nil, true
+	}
+	if service == "list" || service == "" {
+		return data, newLogOutput("", "", "index", data), false
+	}
+	if run == "list" {
+		out := newLogOutput(service, "", "index", data)
+		if runs, err := c.Runs(ctx, service); err == nil {
+			out.Runs = runs.Runs
+		}
+		return data, out, false
+	}
+	return fmt.Sprintf("=== %s / %s ===\n\n%s", service, run, data), newLogOutput(service, run, "logfile", data), false
+}
+
+func apiTimeline(c *client.Client, services, since string, lines int) (string, bool) {
+	opts := client.TimelineOptions{Since: since, Lines: lines}
+	for _, name := range strings.Split(services, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Services = append(opts.Services, name)
+		}
 	}
-	data, err := apiGet(path)
+	ctx, cancel := apiContext()
+	defer cancel()
+	data, err := c.Timeline(ctx, opts)
 	if err != nil {
 		return "Failed: " + err.Error(), true
 	}
-	if service == "list" || service == "" {
-		return data, false
+	header := "all services"
+	if services != "" {
+		header = services
 	}
-	return fmt.Sprintf("=== %s / %s ===\n\n%s", service, run, data), false
+	return fmt.Sprintf("=== timeline: %s ===\n\n%s", header, data), false
 }
 
-func sendResult(id interface{}, result interface{}) {
-	resp := Response{JSONRPC: "2.0", ID: id, Result: result}
-	output, _ := json.Marshal(resp)
-	fmt.Println(string(output))
+func apiCompareRuns(c *client.Client, service, a, b string) (string, bool) {
+	if service == "" {
+		return "Service name required", true
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	data, err := c.CompareRuns(ctx, service, a, b, 0)
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	return data, false
+}
+
+// metricsLine renders one sample: "cpu 12.5%  rss 1.2 GB  threads 40  fds 120  procs 3".
+func metricsLine(m *client.MetricsSample) string {
+	line := fmt.Sprintf("cpu %5.1f%%  rss %9s  procs %d", m.CPUPercent, m.RSS, m.Processes)
+	if m.Threads > 0 {
+		line += fmt.Sprintf("  threads %d  fds %d", m.Threads, m.OpenFDs)
+	}
+	return line
+}
+
+func apiMetrics(c *client.Client, service, since string) (string, bool) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	var sb strings.Builder
+	if service == "" {
+		resp, err := c.Metrics(ctx)
+		if err != nil {
+			return "Failed: " + err.Error(), true
+		}
+		if len(resp.Services) == 0 {
+			return "No running services have been sampled yet (sampling every " + resp.Interval + ")", false
+		}
+		fmt.Fprintf(&sb, "Service metrics (sampled every %s, biggest RSS first)\n\n", resp.Interval)
+		for _, sm := range resp.Services {
+			fmt.Fprintf(&sb, "%-16s %s\n", sm.Service, metricsLine(sm.Latest))
+			if sm.Latest.LargestCommand != "" && sm.Latest.Processes > 1 {
+				fmt.Fprintf(&sb, "%-16s largest: pid %d %s\n", "", sm.Latest.LargestPID, sm.Latest.LargestCommand)
+			}
+			fmt.Fprintf(&sb, "%-16s peak this run: cpu %.1f%%, rss %s\n", "", sm.PeakCPUPercent, sm.PeakRSS)
+		}
+		return strings.TrimRight(sb.String(), "\n"), false
+	}
+	var window time.Duration
+	if since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return fmt.Sprintf("Invalid since %q (use e.g. 5m)", since), true
+		}
+		window = d
+	}
+	sm, err := c.ServiceMetrics(ctx, service, window)
+	if err != nil {
+		return "Failed: " + err.Error(), true
+	}
+	if len(sm.Samples) == 0 {
+		return fmt.Sprintf("No samples for %s (not running, or interactive: only wrapped services are sampled)", service), false
+	}
+	fmt.Fprintf(&sb, "=== %s: %d samples every %s ===\n\n", service, len(sm.Samples), sm.Interval)
+	fmt.Fprintf(&sb, "latest: %s\n", metricsLine(sm.Latest))
+	if sm.Latest.LargestCommand != "" {
+		fmt.Fprintf(&sb, "largest process: pid %d %s\n", sm.Latest.LargestPID, sm.Latest.LargestCommand)
+	}
+	fmt.Fprintf(&sb, "peak: cpu %.1f%%, rss %s\n\n", sm.PeakCPUPercent, sm.PeakRSS)
+	// At most 30 evenly spaced rows, always ending with the latest sample
+	const rows = 30
+	step := (len(sm.Samples) + rows - 1) / rows
+	for i := (len(sm.Samples) - 1) % step; i < len(sm.Samples); i += step {
+		smp := sm.Samples[i]
+		fmt.Fprintf(&sb, "%s  %s\n", smp.Time.Format("15:04:05"), metricsLine(&smp))
+	}
+	return strings.TrimRight(sb.String(), "\n"), false
 }
 
-func sendError(id interface{}, code int, message string) {
-	resp := Response{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: message}}
-	output, _ := json.Marshal(resp)
+// stdoutMu keeps responses and notifications (sent from the subscription watcher) on separate lines.
+var stdoutMu sync.Mutex
+
+// writeMessage writes one message to stdout (stdio transport).
+func writeMessage(msg interface{}) {
+	output, _ := json.Marshal(msg)
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
 	fmt.Println(string(output))
 }
+
+func newResult(id interface{}, result interface{}) *Response {
+	return &Response{JSONRPC: "2.0", ID: id, Result: result}
+}
+
+func newError(id interface{}, code int, message string) *Response {
+	return &Response{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: message}}
+}
+
+// session is one connected client: the stdio peer, or one Mcp-Session-Id over HTTP.
+type session struct {
+	id       string
+	protocol string                // negotiated at initialize
+	send     func(msg interface{}) // server-initiated messages (notifications)
+	crux     *cruxTarget           // the crux session this client talks to
+	subs     *resourceSubscriptions
+	events   *eventWatcher
+}
+
+func newSession(id string, send func(msg interface{})) *session {
+	sess := &session{id: id, send: send, crux: &cruxTarget{}}
+	sess.subs = newResourceSubscriptions(sess.crux.api, sess.sendNotification)
+	sess.events = newEventWatcher(sess.subs.done, sess.crux.api, sess.sendNotification)
+	return sess
+}
+
+// structured reports whether the client's protocol revision has structured tool output.
+func (s *session) structured() bool {
+	return s.protocol >= structuredSince
+}
+
+// sendNotification sends a server-initiated JSON-RPC notification (no id, no response).
+func (s *session) sendNotification(method string, params interface{}) {
+	s.send(Notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// close stops the session's background work (HTTP sessions end on DELETE or idle timeout).
+func (s *session) close() {
+	s.subs.stop()
+}
+
+// done is closed when the session has been closed.
+func (s *session) done() <-chan struct{} {
+	return s.subs.done
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glorko/crux/client"
+	"github.com/glorko/crux/internal/api"
+)
+
+// newTestAPI points crux-mcp at an in-process crux API for the duration of the test.
+func newTestAPI(t *testing.T) *api.Server {
+	t.Helper()
+	s := api.NewServer(0)
+	s.SetToken("test-token")
+	ts := httptest.NewServer(s.Handler())
+	prev := envAPI
+	envAPI = client.New(ts.URL, "test-token")
+	t.Cleanup(func() {
+		envAPI = prev
+		ts.Close()
+	})
+	return s
+}
+
+// callTool runs a tool and returns its text.
+func callTool(t *testing.T, name string, args map[string]interface{}) (string, bool) {
+	t.Helper()
+	res := handleToolCall(newSession("test", func(interface{}) {}), CallToolParams{Name: name, Arguments: args})
+	return res.Content[0].Text, res.IsError
+}
+
+func TestCompareRunsTool(t *testing.T) {
+	newTestAPI(t)
+	dir := filepath.Join("/tmp/crux-logs", "crux-mcp-test-diff")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "2024-02-11_100000.log"), []byte("10:00:00 up on :8080\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "2024-02-11_110000.log"), []byte("11:00:00 up on :8081\n11:00:01 panic: nil map\n"), 0644)
+
+	text, isError := callTool(t, "crux_compare_runs", map[string]interface{}{"service": "crux-mcp-test-diff"})
+	if isError || !strings.Contains(text, "--- New errors in B (1) ---\n11:00:01 panic: nil map") || strings.Contains(text, "up on") {
+		t.Errorf("crux_compare_runs = %v\n%s", isError, text)
+	}
+	if text, isError := callTool(t, "crux_compare_runs", map[string]interface{}{"service": "crux-mcp-test-none"}); !isError {
+		t.Errorf("service without runs: %s", text)
+	}
+	if _, isError := callTool(t, "crux_compare_runs", nil); !isError {
+		t.Error("missing service accepted")
+	}
+}
+
+func TestServicesListsActions(t *testing.T) {
+	s := newTestAPI(t)
+	s.SetServices([]api.ServiceSpec{
+		{Name: "app-ios", Actions: []api.ServiceAction{{Name: "reload", Send: "r"}, {Name: "restart", Send: "R"}}},
+		{Name: "db"},
+	})
+
+	text, _, isError := apiGetServices(envAPI)
+	if isError || !strings.Contains(text, "app-ios: ") ||
+		!strings.Contains(text, "  Actions: reload (crux_action_app-ios_reload), restart (crux_action_app-ios_restart)\n") {
+		t.Errorf("apiGetServices = %v\n%s", isError, text)
+	}
+	if strings.Count(text, "Actions:") != 1 || strings.Contains(text, "Commands:") {
+		t.Errorf("actions listed for a service without any:\n%s", text)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glorko/crux/client"
+)
+
+// MCP logging: each session follows the crux event stream (GET /events) and pushes
+// notifications/message when a service crashes, a run doesn't become ready or a dependency
+// check starts failing, so the agent hears about it without polling crux_status. The same
+// stream tells it when config edits change the action tools (notifications/tools/list_changed).
+
+const (
+	notifyLogLines     = 20              // log lines attached to a crash notification
+	eventRetryInterval = 5 * time.Second // reconnect delay while crux is unreachable
+)
+
+// notifyEvents are the event types that become notifications
+var notifyEvents = []string{client.EventServiceExited, client.EventServiceNotReady, client.EventDependencyDown}
+
+// watchedEvents are the event types followed: notifications, and config reloads for action tools
+var watchedEvents = append([]string{client.EventConfigReloaded}, notifyEvents...)
+
+// logLevels are the MCP (syslog) levels, least severe first
+var logLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+type LoggingCapability struct{}
+
+type SetLevelParams struct {
+	Level string `json:"level"`
+}
+
+type LogMessageParams struct {
+	Level  string      `json:"level"`
+	Logger string      `json:"logger,omitempty"`
+	Data   interface{} `json:"data"`
+}
+
+// ServiceAlert is the data of a notifications/message about a service.
+type ServiceAlert struct {
+	Message   string `json:"message"`
+	Event     string `json:"event"`
+	Service   string `json:"service"`
+	RunID     string `json:"run_id,omitempty"`
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	Log       string `json:"log,omitempty"` // last lines of the run's log
+}
+
+func levelRank(level string) int {
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// eventWatcher turns crux events into notifications for one session.
+type eventWatcher struct {
+	mu      sync.Mutex
+	level   string // minimum level sent, set by logging/setLevel (default: all)
+	started bool
+	tools   string // fingerprint of the action tools in the last tools/list
+	listed  bool   // the client has listed tools
+	done    <-chan struct{}
+	api     func() *client.Client // the session's crux API
+	notify  func(method string, params interface{})
+}
+
+func newEventWatcher(done <-chan struct{}, api func() *client.Client, notify func(method string, params interface{})) *eventWatcher {
+	return &eventWatcher{level: "debug", done: done, api: api, notify: notify}
+}
+
+// start begins following events (once), after the client has finished initializing.
+func (w *eventWatcher) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return
+	}
+	w.started = true
+	go w.run()
+}
+
+func (w *eventWatcher) setLevel(level string) error {
+	if levelRank(level) < 0 {
+		return fmt.Errorf("unknown level %q (use one of %s)", level, strings.Join(logLevels, ", "))
+	}
+	w.mu.Lock()
+	w.level = level
+	w.mu.Unlock()
+	return nil
+}
+
+// listedTools records the action tools a tools/list answered with.
+func (w *eventWatcher) listedTools(fingerprint string) {
+	w.mu.Lock()
+	w.tools, w.listed = fingerprint, true
+	w.mu.Unlock()
+}
+
+// checkTools sends notifications/tools/list_changed when the configured actions no longer
+// match the tools the client listed (not filtered by level: it is not a log message).
+func (w *eventWatcher) checkTools(c *client.Client) {
+	tools, _, err := actionTools(c)
+	if err != nil {
+		return // crux not reachable: compare again once it is back
+	}
+	fingerprint := toolsFingerprint(tools)
+	w.mu.Lock()
+	changed := w.listed && fingerprint != w.tools
+	w.tools = fingerprint
+	w.mu.Unlock()
+	if changed {
+		w.notify("notifications/tools/list_changed", nil)
+	}
+}
+
+// run follows the event stream of the crux session in use, reconnecting when crux restarts
+// and switching when crux-mcp switches sessions.
+func (w *eventWatcher) run() {
+	var since *uint64
+	var last *client.Client
+	for {
+		c := w.api()
+		if c != last {
+			since, last = nil, c // another session: its event ids are unrelated
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			ticker := time.NewTicker(eventRetryInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-w.done:
+					cancel()
+					return
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if w.api() != c {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+		w.checkTools(c) // the config may have changed, or this is another session
+		c.Events(ctx, client.EventOptions{Since: since, Types: watchedEvents}, func(ev client.Event) error {
+			id := ev.ID
+			since = &id
+			if ev.Type == client.EventConfigReloaded {
+				w.checkTools(c)
+				return nil
+			}
+			w.handle(c, ev)
+			return nil
+		})
+		cancel()
+		select {
+		case <-w.done:
+			return
+		case <-time.After(eventRetryInterval):
+		}
+	}
+}
+
+func (w *eventWatcher) handle(c *client.Client, ev client.Event) {
+	level, alert := describeEvent(ev)
+	if alert == nil {
+		return
+	}
+	w.mu.Lock()
+	min := w.level
+	w.mu.Unlock()
+	if levelRank(level) < levelRank(min) {
+		return
+	}
+	if ev.Type == client.EventServiceExited && alert.RunID != "" {
+		ctx, cancel := apiContext()
+		text, err := c.Logfile(ctx, ev.Service, alert.RunID, client.LogOptions{Lines: notifyLogLines, Format: client.FormatPlain})
+		cancel()
+		if err == nil {
+			alert.Log = strings.TrimRight(text, "\n")
+		}
+	}
+	w.notify("notifications/message", LogMessageParams{Level: level, Logger: "crux", Data: alert})
+}
+
+// describeEvent returns the level and content of the notification for ev (nil: none).
+func describeEvent(ev client.Event) (string, *ServiceAlert) {
+	alert := &ServiceAlert{Event: ev.Type, Service: ev.Service}
+	alert.RunID, _ = ev.Data["run_id"].(string)
+	alert.LastError, _ = ev.Data["last_error"].(string)
+	if code, ok := ev.Data["exit_code"].(float64); ok {
+		c := int(code)
+		alert.ExitCode = &c
+	}
+	var level string
+	switch ev.Type {
+	case client.EventServiceExited:
+		if state, _ := ev.Data["state"].(string); state != string(client.StateCrashed) {
+			return "", nil // exit code 0: finished, not crashed
+		}
+		level = "error"
+		alert.Message = ev.Service + " crashed"
+		if alert.ExitCode != nil {
+			alert.Message += fmt.Sprintf(" (exit code %d)", *alert.ExitCode)
+		}
+	case client.EventServiceNotReady:
+		level = "warning"
+		waited, _ := ev.Data["waited"].(string)
+		alert.Message = fmt.Sprintf("%s is not ready after %s", ev.Service, waited)
+		if ports, ok := ev.Data["ports"].([]interface{}); ok && len(ports) > 0 {
+			data, _ := json.Marshal(ports)
+			alert.Message += fmt.Sprintf(" (ports %s not all listening)", data)
+		}
+	case client.EventDependencyDown:
+		level = "warning"
+		check, _ := ev.Data["check"].(string)
+		alert.Message = fmt.Sprintf("dependency %s is down (check: %s)", ev.Service, check)
+	default:
+		return "", nil
+	}
+	if alert.LastError != "" {
+		alert.Message += ": " + alert.LastError
+	}
+	return level, alert
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/glorko/crux/client"
+)
+
+func TestDescribeEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		ev    client.Event
+		level string // "": no notification
+		msg   string
+	}{
+		{"crash", client.Event{Type: client.EventServiceExited, Service: "api", Data: map[string]interface{}{
+			"state": "crashed", "exit_code": 2.0, "run_id": "2024-02-11_100000", "last_error": "panic: nil map",
+		}}, "error", "api crashed (exit code 2): panic: nil map"},
+		{"crash without code", client.Event{Type: client.EventServiceExited, Service: "api", Data: map[string]interface{}{"state": "crashed"}}, "error", "api crashed"},
+		{"exit 0", client.Event{Type: client.EventServiceExited, Service: "migrate", Data: map[string]interface{}{"state": "exited", "exit_code": 0.0}}, "", ""},
+		{"not ready", client.Event{Type: client.EventServiceNotReady, Service: "api", Data: map[string]interface{}{
+			"waited": "1m0s", "ports": []interface{}{8080.0, 8081.0},
+		}}, "warning", "api is not ready after 1m0s (ports [8080,8081] not all listening)"},
+		{"dependency down", client.Event{Type: client.EventDependencyDown, Service: "postgres", Data: map[string]interface{}{"check": "pg_isready"}}, "warning", "dependency postgres is down (check: pg_isready)"},
+		{"other event", client.Event{Type: client.EventConfigReloaded}, "", ""},
+	}
+	for _, tt := range tests {
+		level, alert := describeEvent(tt.ev)
+		switch {
+		case tt.level == "" && alert != nil:
+			t.Errorf("%s: notified %q", tt.name, alert.Message)
+		case tt.level != "" && (alert == nil || level != tt.level || alert.Message != tt.msg):
+			t.Errorf("%s: %s %+v, want %s %q", tt.name, level, alert, tt.level, tt.msg)
+		}
+	}
+	_, alert := describeEvent(tests[0].ev)
+	if alert.RunID != "2024-02-11_100000" || alert.ExitCode == nil || *alert.ExitCode != 2 || alert.Service != "api" {
+		t.Errorf("crash alert = %+v", alert)
+	}
+}
+
+func TestEventWatcherHandle(t *testing.T) {
+	const service = "crux-mcp-test-notify"
+	newTestAPI(t)
+	writeTestRun(t, service, "2024-02-11_100000", "starting\npanic: nil map\n")
+	var sent []LogMessageParams
+	w := newEventWatcher(nil, (&cruxTarget{}).api, func(method string, params interface{}) {
+		if method == "notifications/message" {
+			sent = append(sent, params.(LogMessageParams))
+		}
+	})
+	crash := client.Event{Type: client.EventServiceExited, Service: service, Data: map[string]interface{}{"state": "crashed", "exit_code": 2.0, "run_id": "2024-02-11_100000"}}
+	notReady := client.Event{Type: client.EventServiceNotReady, Service: service, Data: map[string]interface{}{"waited": "1m0s"}}
+
+	w.handle(envAPI, crash)
+	w.handle(envAPI, notReady)
+	if len(sent) != 2 || sent[0].Level != "error" || sent[1].Level != "warning" {
+		t.Fatalf("sent %+v", sent)
+	}
+	if alert := sent[0].Data.(*ServiceAlert); alert.Log != "starting\npanic: nil map" {
+		t.Errorf("crash log = %q", alert.Log)
+	}
+
+	sent = nil
+	if err := w.setLevel("loud"); err == nil {
+		t.Error("unknown level accepted")
+	}
+	w.setLevel("error")
+	w.handle(envAPI, notReady)
+	w.handle(envAPI, crash)
+	if len(sent) != 1 || sent[0].Level != "error" {
+		t.Errorf("at level error sent %+v", sent)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/glorko/crux/client"
+	"github.com/glorko/crux/internal/prompts"
+)
+
+// MCP prompts: canned diagnosis and setup workflows. prompts/get fills them with the service's
+// current state, config entry and log from the crux API, so the agent starts from the evidence
+// instead of collecting it with half a dozen tool calls.
+
+const promptLogLines = 150
+
+type PromptsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type PromptsListResult struct {
+	Prompts []Prompt `json:"prompts"`
+}
+
+type GetPromptParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+type PromptMessage struct {
+	Role    string      `json:"role"`
+	Content ContentItem `json:"content"`
+}
+
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+var promptList = []Prompt{
+	{
+		Name:        "diagnose_crash",
+		Description: "Find out why a service crashed: its status, config entry, last log lines and what changed since the previous run",
+		Arguments:   []PromptArgument{{Name: "service", Description: "Service name (default: the first crashed or exited service)"}},
+	},
+	{
+		Name:        "explain_startup_failure",
+		Description: "Explain why a service doesn't become ready: its status, ports and who holds them, config entry, startup log and the other services' states",
+		Arguments:   []PromptArgument{{Name: "service", Description: "Service name (default: the first service that isn't ready)"}},
+	},
+	{
+		Name:        "write_config",
+		Description: "Analyse this repository and write (or fix) its crux config.yaml from the project's real run scripts",
+	},
+}
+
+// errPromptArgs marks errors caused by the caller's arguments (-32602) rather than crux
+var errPromptArgs = errors.New("invalid prompt arguments")
+
+func handlePromptRequest(sess *session, req Request) *Response {
+	switch req.Method {
+	case "prompts/list":
+		return newResult(req.ID, PromptsListResult{Prompts: promptList})
+
+	case "prompts/get":
+		var params GetPromptParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return newError(req.ID, -32602, "Invalid params")
+		}
+		result, err := getPrompt(sess.crux.api(), params.Name, params.Arguments["service"])
+		if errors.Is(err, errPromptArgs) {
+			return newError(req.ID, -32602, err.Error())
+		}
+		if err != nil {
+			return newError(req.ID, -32603, err.Error())
+		}
+		return newResult(req.ID, result)
+	}
+	return newError(req.ID, -32601, fmt.Sprintf("Method not found: %s", req.Method))
+}
+
+func getPrompt(c *client.Client, name, service string) (*GetPromptResult, error) {
+	var text string
+	var err error
+	switch name {
+	case "diagnose_crash":
+		text, err = crashPrompt(c, service)
+	case "explain_startup_failure":
+		text, err = startupPrompt(c, service)
+	case "write_config":
+		text = configPrompt(c)
+	default:
+		return nil, fmt.Errorf("%w: unknown prompt %q", errPromptArgs, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &GetPromptResult{Messages: []PromptMessage{{Role: "user", Content: ContentItem{Type: "text", Text: text}}}}
+	for _, p := range promptList {
+		if p.Name == name {
+			result.Description = p.Description
+		}
+	}
+	return result, nil
+}
+
+// pickService returns the status of name, or without a name the first service for which
+// match is true.
+func pickService(c *client.Client, name string, match func(client.ServiceStatus) bool, none string) (client.ServiceStatus, []client.ServiceStatus, error) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	out, err := c.Services(ctx)
+	if err != nil {
+		return client.ServiceStatus{}, nil, fmt.Errorf("crux API not available (is crux running?): %v", err)
+	}
+	if name != "" {
+		st, ok := findService(out.Services, name)
+		if !ok {
+			return st, nil, fmt.Errorf("%w: service %q not found", errPromptArgs, name)
+		}
+		return st, out.Services, nil
+	}
+	for _, st := range out.Services {
+		if match(st) {
+			return st, out.Services, nil
+		}
+	}
+	return client.ServiceStatus{}, nil, fmt.Errorf("%w: %s; pass service", errPromptArgs, none)
+}
+
+func crashPrompt(c *client.Client, service string) (string, error) {
+	st, _, err := pickService(c, service, func(st client.ServiceStatus) bool {
+		return st.State == client.StateCrashed || st.State == client.StateExited
+	}, "no service has crashed or exited")
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The %s service managed by crux is %s. Find the root cause from the evidence below.\n\n", st.Name, st.State)
+	writeStatus(&sb, st)
+	writeServiceConfig(c, &sb, st.Name)
+	writeLog(c, &sb, st, "Last %d lines of the log")
+
+	ctx, cancel := apiContext()
+	defer cancel()
+	if diff, err := c.CompareRuns(ctx, st.Name, "", "", 30); err == nil && strings.TrimSpace(diff) != "" {
+		fmt.Fprintf(&sb, "## Changes since the previous run\n\n```\n%s\n```\n\n", strings.TrimRight(diff, "\n"))
+	}
+
+	sb.WriteString(`## What to do
+1. Quote the log line(s) that show the failure and explain the cause. Ignore noise that also appears in working runs.
+2. Say whether it is a code bug, a config problem (command, workdir, env, ports) or a missing dependency, and propose the fix.
+3. After fixing, restart with crux_reload and confirm with crux_wait_for (state=ready) or crux_status. Use crux_logfile run=list and crux_compare_runs to look further back.
+`)
+	return sb.String(), nil
+}
+
+func startupPrompt(c *client.Client, service string) (string, error) {
+	st, all, err := pickService(c, service, func(st client.ServiceStatus) bool {
+		return st.State != client.StateReady
+	}, "all services are ready")
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The %s service managed by crux did not become ready (it is %s). Explain why from the evidence below.\n\n", st.Name, st.State)
+	sb.WriteString("crux counts a service as ready once its process is alive and every port in its ports: list accepts connections (without ports: after a short grace period).\n\n")
+	writeStatus(&sb, st)
+	writeServiceConfig(c, &sb, st.Name)
+	writeLog(c, &sb, st, "Startup log (last %d lines)")
+
+	sb.WriteString("## Other services\n\n")
+	for _, other := range all {
+		if other.Name == st.Name {
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s: %s", other.Name, other.State)
+		if other.LastError != "" {
+			fmt.Fprintf(&sb, " (last error: %s)", other.LastError)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(`
+## What to do
+1. Say where startup stops: still compiling, waiting on a dependency (database, another service), failing to bind a port, or crashed.
+2. If a port is held by another process, name it and say whether to stop it or change the port.
+3. Propose the fix, then restart with crux_reload and confirm with crux_wait_for (state=ready).
+`)
+	return sb.String(), nil
+}
+
+func configPrompt(c *client.Client) string {
+	var sb strings.Builder
+	sb.WriteString(prompts.Setup)
+	ctx, cancel := apiContext()
+	defer cancel()
+	if cfg, err := c.Config(ctx); err == nil {
+		fmt.Fprintf(&sb, "\n## Current config\ncrux is running with this config (secrets masked). Update it instead of starting over, with crux_config_set_service and crux_config_remove_service rather than editing the YAML by hand:\n\n```yaml\n%s\n```\n", strings.TrimRight(cfg, "\n"))
+	}
+	return sb.String()
+}
+
+func writeStatus(sb *strings.Builder, st client.ServiceStatus) {
+	sb.WriteString("## Status\n\n")
+	fmt.Fprintf(sb, "- state: %s since %s\n", st.State, st.StateSince.Format("15:04:05"))
+	if st.ExitCode != nil {
+		fmt.Fprintf(sb, "- exit code: %d\n", *st.ExitCode)
+	}
+	if st.RunID != "" {
+		fmt.Fprintf(sb, "- run: %s (restarts this session: %d)\n", st.RunID, st.RestartCount)
+	}
+	if st.Uptime != "" {
+		fmt.Fprintf(sb, "- uptime: %s\n", st.Uptime)
+	}
+	if len(st.Ports) > 0 {
+		fmt.Fprintf(sb, "- ports: %v\n", st.Ports)
+	}
+	for _, h := range st.PortHolders {
+		if !h.Own {
+			fmt.Fprintf(sb, "- port %d held by %s, not this run\n", h.Port, h)
+		}
+	}
+	if st.LastError != "" {
+		fmt.Fprintf(sb, "- last error: %s\n", st.LastError)
+	}
+	sb.WriteString("\n")
+}
+
+func writeServiceConfig(c *client.Client, sb *strings.Builder, service string) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	cfg, err := c.ServiceConfig(ctx, service)
+	if err != nil {
+		fmt.Fprintf(sb, "## Config\n\n(not available: %v)\n\n", err)
+		return
+	}
+	fmt.Fprintf(sb, "## Config\n\n```yaml\n%s\n```\n\n", strings.TrimRight(cfg, "\n"))
+}
+
+func writeLog(c *client.Client, sb *strings.Builder, st client.ServiceStatus, title string) {
+	fmt.Fprintf(sb, "## "+title+"\n\n", promptLogLines)
+	if st.Interactive {
+		sb.WriteString("(interactive service: no log file; use crux_logs for the terminal scrollback)\n\n")
+		return
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	text, err := c.Logfile(ctx, st.Name, "latest", client.LogOptions{Lines: promptLogLines, Format: client.FormatPlain})
+	if err != nil {
+		fmt.Fprintf(sb, "(no log: %v)\n\n", err)
+		return
+	}
+	fmt.Fprintf(sb, "```\n%s\n```\n\n", strings.TrimRight(text, "\n"))
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glorko/crux/client"
+)
+
+// MCP resources: service status and run logs as crux:// URIs, so clients can attach them to
+// context without tool calls. Subscribed resources are polled and notifications/resources/updated
+// is sent when they change.
+//
+//	crux://services              status of all services (JSON)
+//	crux://services/<service>    status of one service (JSON)
+//	crux://logs/<service>/latest log of the current run (plain text, last lines)
+//	crux://logs/<service>/<run>  log of a past run
+
+const (
+	servicesURI          = "crux://services"
+	resourceLogLines     = 500
+	resourcePollInterval = 2 * time.Second
+	errResourceNotFound  = -32002 // MCP's code for unknown resource URIs
+)
+
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourcesListResult struct {
+	Resources []Resource `json:"resources"`
+}
+
+type ResourceTemplatesListResult struct {
+	ResourceTemplates []ResourceTemplate `json:"resourceTemplates"`
+}
+
+type ResourceParams struct {
+	URI string `json:"uri"`
+}
+
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// resourceRef is a parsed crux:// URI
+type resourceRef struct {
+	service string // "" for crux://services
+	run     string // set for logs
+}
+
+func (r resourceRef) isLog() bool { return r.run != "" }
+
+var errUnknownResource = errors.New("unknown resource")
+
+func parseResourceURI(uri string) (resourceRef, error) {
+	if uri == servicesURI {
+		return resourceRef{}, nil
+	}
+	if name, ok := strings.CutPrefix(uri, servicesURI+"/"); ok && name != "" && !strings.Contains(name, "/") {
+		return resourceRef{service: name}, nil
+	}
+	if rest, ok := strings.CutPrefix(uri, "crux://logs/"); ok {
+		service, run, ok := strings.Cut(rest, "/")
+		if ok && service != "" && run != "" && !strings.Contains(run, "/") {
+			return resourceRef{service: service, run: run}, nil
+		}
+	}
+	return resourceRef{}, fmt.Errorf("%w %q (use crux://services, crux://services/<service> or crux://logs/<service>/<run>)", errUnknownResource, uri)
+}
+
+func handleResourceRequest(sess *session, req Request) *Response {
+	var params ResourceParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return newError(req.ID, -32602, "Invalid params")
+		}
+	}
+	switch req.Method {
+	case "resources/list":
+		resources, err := listResources(sess.crux.api())
+		if err != nil {
+			return newError(req.ID, -32603, "Crux API not available. Is crux running? "+err.Error())
+		}
+		sess.subs.start()
+		return newResult(req.ID, ResourcesListResult{Resources: resources})
+
+	case "resources/templates/list":
+		return newResult(req.ID, ResourceTemplatesListResult{ResourceTemplates: []ResourceTemplate{
+			{URITemplate: "crux://services/{service}", Name: "Service status", Description: "State, PID, ports, run id, last error and metrics of one service", MimeType: "application/json"},
+			{URITemplate: "crux://logs/{service}/{run}", Name: "Service log", Description: fmt.Sprintf("Last %d lines of a run's log; run is 'latest' or a run id", resourceLogLines), MimeType: "text/plain"},
+		}})
+
+	case "resources/read":
+		contents, err := readResource(sess.crux.api(), params.URI)
+		if errors.Is(err, errUnknownResource) {
+			return newError(req.ID, errResourceNotFound, err.Error())
+		}
+		if err != nil {
+			return newError(req.ID, -32603, err.Error())
+		}
+		return newResult(req.ID, ReadResourceResult{Contents: []ResourceContents{contents}})
+
+	case "resources/subscribe":
+		if _, err := parseResourceURI(params.URI); err != nil {
+			return newError(req.ID, errResourceNotFound, err.Error())
+		}
+		sess.subs.add(params.URI)
+		return newResult(req.ID, struct{}{})
+
+	case "resources/unsubscribe":
+		sess.subs.remove(params.URI)
+		return newResult(req.ID, struct{}{})
+	}
+	return newError(req.ID, -32601, fmt.Sprintf("Method not found: %s", req.Method))
+}
+
+// listResources lists the status resources and, per service, its latest and past run logs.
+func listResources(c *client.Client) ([]Resource, error) {
+	ctx, cancel := apiContext()
+	defer cancel()
+	out, err := c.Services(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resources := []Resource{{URI: servicesURI, Name: "All services", Description: "Status of every configured service", MimeType: "application/json"}}
+	for _, svc := range out.Services {
+		resources = append(resources, Resource{
+			URI:         servicesURI + "/" + svc.Name,
+			Name:        svc.Name + " status",
+			Description: fmt.Sprintf("%s is %s", svc.Name, svc.State),
+			MimeType:    "application/json",
+		})
+		runs, err := c.Runs(ctx, svc.Name)
+		if err != nil {
+			continue
+		}
+		for _, run := range runs.Runs {
+			r := Resource{MimeType: "text/plain", Description: runDescription(run)}
+			if run.Latest {
+				r.URI, r.Name = logURI(svc.Name, "latest"), svc.Name+" log (latest run)"
+			} else {
+				r.URI, r.Name = logURI(svc.Name, run.ID), svc.Name+" log "+run.ID
+			}
+			resources = append(resources, r)
+		}
+	}
+	return resources, nil
+}
+
+func logURI(service, run string) string {
+	return "crux://logs/" + service + "/" + run
+}
+
+func runDescription(run client.RunInfo) string {
+	d := fmt.Sprintf("run %s, %.1f KB", run.ID, float64(run.Size)/1024)
+	if run.ExitCode != nil {
+		d += fmt.Sprintf(", exit code %d", *run.ExitCode)
+	} else if run.Latest {
+		d += ", running"
+	}
+	return d
+}
+
+func readResource(c *client.Client, uri string) (ResourceContents, error) {
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return ResourceContents{}, err
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	if ref.isLog() {
+		text, err := c.Logfile(ctx, ref.service, ref.run, client.LogOptions{Lines: resourceLogLines, Format: client.FormatPlain})
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+			return ResourceContents{}, fmt.Errorf("%w: no %s log for %s", errUnknownResource, ref.run, ref.service)
+		}
+		if err != nil {
+			return ResourceContents{}, err
+		}
+		return ResourceContents{URI: uri, MimeType: "text/plain", Text: text}, nil
+	}
+	out, err := c.Services(ctx)
+	if err != nil {
+		return ResourceContents{}, err
+	}
+	var v interface{} = out
+	if ref.service != "" {
+		st, ok := findService(out.Services, ref.service)
+		if !ok {
+			return ResourceContents{}, fmt.Errorf("%w: service %q not found", errUnknownResource, ref.service)
+		}
+		v = st
+	}
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return ResourceContents{URI: uri, MimeType: "application/json", Text: string(data)}, nil
+}
+
+func findService(services []client.ServiceStatus, name string) (client.ServiceStatus, bool) {
+	for _, st := range services {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return client.ServiceStatus{}, false
+}
+
+// resourceSubscriptions polls a session's subscribed resources and the resource list, and
+// notifies the client when they change.
+type resourceSubscriptions struct {
+	mu      sync.Mutex
+	uris    map[string]string // uri -> last fingerprint
+	list    string            // fingerprint of the resource list
+	started bool
+	done    chan struct{}
+	api     func() *client.Client // the session's crux API
+	notify  func(method string, params interface{})
+}
+
+func newResourceSubscriptions(api func() *client.Client, notify func(method string, params interface{})) *resourceSubscriptions {
+	return &resourceSubscriptions{uris: make(map[string]string), done: make(chan struct{}), api: api, notify: notify}
+}
+
+func (s *resourceSubscriptions) add(uri string) {
+	snap := &resourceSnapshot{api: s.api()}
+	fp, _ := snap.fingerprint(uri)
+	s.mu.Lock()
+	s.uris[uri] = fp
+	s.mu.Unlock()
+	s.start()
+}
+
+func (s *resourceSubscriptions) remove(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uris, uri)
+}
+
+// start begins polling (once), after the client has shown interest in resources.
+func (s *resourceSubscriptions) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	go s.watch()
+}
+
+// stop ends polling for good.
+func (s *resourceSubscriptions) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+func (s *resourceSubscriptions) watch() {
+	ticker := time.NewTicker(resourcePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.poll()
+		}
+	}
+}
+
+func (s *resourceSubscriptions) poll() {
+	snap := &resourceSnapshot{api: s.api()}
+	s.mu.Lock()
+	uris := make([]string, 0, len(s.uris))
+	for uri := range s.uris {
+		uris = append(uris, uri)
+	}
+	s.mu.Unlock()
+
+	var updated []string
+	for _, uri := range uris {
+		fp, err := snap.fingerprint(uri)
+		if err != nil {
+			continue // crux not reachable: report changes once it is back
+		}
+		s.mu.Lock()
+		if prev, ok := s.uris[uri]; ok && prev != fp {
+			s.uris[uri] = fp
+			updated = append(updated, uri)
+		}
+		s.mu.Unlock()
+	}
+	for _, uri := range updated {
+		s.notify("notifications/resources/updated", ResourceParams{URI: uri})
+	}
+
+	if list, err := snap.listFingerprint(); err == nil {
+		s.mu.Lock()
+		changed := s.list != "" && s.list != list
+		s.list = list
+		s.mu.Unlock()
+		if changed {
+			s.notify("notifications/resources/list_changed", nil)
+		}
+	}
+}
+
+// resourceSnapshot caches API responses for one poll, so many subscriptions cost one request each.
+type resourceSnapshot struct {
+	api      *client.Client
+	services *client.ServicesResponse
+	runs     map[string][]client.RunInfo
+}
+
+func (p *resourceSnapshot) getServices() (*client.ServicesResponse, error) {
+	if p.services != nil {
+		return p.services, nil
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	out, err := p.api.Services(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.services = out
+	return out, nil
+}
+
+func (p *resourceSnapshot) getRuns(service string) ([]client.RunInfo, error) {
+	if runs, ok := p.runs[service]; ok {
+		return runs, nil
+	}
+	ctx, cancel := apiContext()
+	defer cancel()
+	out, err := p.api.Runs(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if p.runs == nil {
+		p.runs = make(map[string][]client.RunInfo)
+	}
+	p.runs[service] = out.Runs
+	return out.Runs, nil
+}
+
+// fingerprint summarises what a reader of uri would see change: state, run, exit code and
+// last error for status (not uptime or metrics, which change every sample), size for logs.
+func (p *resourceSnapshot) fingerprint(uri string) (string, error) {
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if ref.isLog() {
+		runs, err := p.getRuns(ref.service)
+		if err != nil {
+			return "", err
+		}
+		for _, run := range runs {
+			if run.ID == ref.run || (ref.run == "latest" && run.Latest) {
+				return fmt.Sprintf("%s:%d", run.ID, run.Size), nil
+			}
+		}
+		return "", nil
+	}
+	out, err := p.getServices()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, st := range out.Services {
+		if ref.service != "" && st.Name != ref.service {
+			continue
+		}
+		exit := ""
+		if st.ExitCode != nil {
+			exit = fmt.Sprint(*st.ExitCode)
+		}
+		fmt.Fprintf(&sb, "%s|%s|%s|%s|%s|%t\n", st.Name, st.State, st.RunID, exit, st.LastError, st.HasTab)
+	}
+	return sb.String(), nil
+}
+
+// listFingerprint changes when resources/list would return different URIs.
+func (p *resourceSnapshot) listFingerprint() (string, error) {
+	out, err := p.getServices()
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for _, st := range out.Services {
+		ids = append(ids, st.Name)
+		runs, err := p.getRuns(st.Name)
+		if err != nil {
+			return "", err
+		}
+		for _, run := range runs {
+			ids = append(ids, st.Name+"/"+run.ID)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ","), nil
+}
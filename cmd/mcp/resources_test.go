@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glorko/crux/internal/api"
+)
+
+func TestParseResourceURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want resourceRef
+		ok   bool
+	}{
+		{"crux://services", resourceRef{}, true},
+		{"crux://services/backend", resourceRef{service: "backend"}, true},
+		{"crux://logs/backend/latest", resourceRef{service: "backend", run: "latest"}, true},
+		{"crux://logs/backend/2024-02-11_100000", resourceRef{service: "backend", run: "2024-02-11_100000"}, true},
+		{"crux://services/", resourceRef{}, false},
+		{"crux://services/backend/logs", resourceRef{}, false},
+		{"crux://logs/backend", resourceRef{}, false},
+		{"crux://logs/backend/", resourceRef{}, false},
+		{"crux://logs//latest", resourceRef{}, false},
+		{"crux://logs/backend/latest/x", resourceRef{}, false},
+		{"file:///etc/passwd", resourceRef{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseResourceURI(tt.uri)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseResourceURI(%q) = %+v, %v", tt.uri, got, err)
+		}
+	}
+}
+
+// writeTestRun writes a run log for service under /tmp/crux-logs and points latest.log at it.
+func writeTestRun(t *testing.T, service, runID, content string) string {
+	t.Helper()
+	dir := filepath.Join("/tmp/crux-logs", service)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, runID+".log")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "latest.log"))
+	if err := os.Symlink(runID+".log", filepath.Join(dir, "latest.log")); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResourceFingerprints(t *testing.T) {
+	const service = "crux-mcp-test-res"
+	s := newTestAPI(t)
+	s.SetServices([]api.ServiceSpec{{Name: service}})
+	path := writeTestRun(t, service, "2024-02-11_100000", "started\n")
+
+	snap := &resourceSnapshot{api: envAPI}
+	status, err := snap.fingerprint("crux://services/" + service)
+	if err != nil || !strings.HasPrefix(status, service+"|") {
+		t.Fatalf("status fingerprint = %q, %v", status, err)
+	}
+	if all, _ := snap.fingerprint(servicesURI); all != status {
+		t.Errorf("all services = %q, want %q", all, status)
+	}
+	latest, _ := snap.fingerprint(logURI(service, "latest"))
+	byID, _ := snap.fingerprint(logURI(service, "2024-02-11_100000"))
+	if latest != "2024-02-11_100000:8" || byID != latest {
+		t.Errorf("log fingerprints = %q, %q", latest, byID)
+	}
+	if fp, err := snap.fingerprint(logURI(service, "2024-01-01_000000")); err != nil || fp != "" {
+		t.Errorf("missing run = %q, %v", fp, err)
+	}
+	if _, err := snap.fingerprint("crux://nope"); err == nil {
+		t.Error("bad uri accepted")
+	}
+
+	// A snapshot answers from its cache; a new one sees the log grow
+	os.WriteFile(path, []byte("started\nlistening\n"), 0644)
+	if fp, _ := snap.fingerprint(logURI(service, "latest")); fp != latest {
+		t.Errorf("cached fingerprint changed to %q", fp)
+	}
+	if fp, _ := (&resourceSnapshot{api: envAPI}).fingerprint(logURI(service, "latest")); fp != "2024-02-11_100000:18" {
+		t.Errorf("fingerprint after write = %q", fp)
+	}
+}
+
+func TestResourceSubscriptionsPoll(t *testing.T) {
+	const service = "crux-mcp-test-sub"
+	s := newTestAPI(t)
+	s.SetServices([]api.ServiceSpec{{Name: service}})
+	path := writeTestRun(t, service, "2024-02-11_100000", "started\n")
+
+	var mu sync.Mutex
+	var sent []string
+	subs := newResourceSubscriptions((&cruxTarget{}).api, func(method string, params interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p, ok := params.(ResourceParams); ok {
+			method += " " + p.URI
+		}
+		sent = append(sent, method)
+	})
+	defer subs.stop()
+	subs.add(logURI(service, "latest"))
+	subs.add("crux://services/" + service)
+	notified := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		defer func() { sent = nil }()
+		sort.Strings(sent) // subscriptions are polled in map order
+		return strings.Join(sent, ", ")
+	}
+
+	subs.poll() // records the resource list
+	if got := notified(); got != "" {
+		t.Errorf("nothing changed, sent %s", got)
+	}
+	os.WriteFile(path, []byte("started\nlistening\n"), 0644)
+	subs.poll()
+	if got, want := notified(), "notifications/resources/updated "+logURI(service, "latest"); got != want {
+		t.Errorf("after a write sent %q, want %q", got, want)
+	}
+	writeTestRun(t, service, "2024-02-11_110000", "again\n")
+	subs.poll()
+	want := "notifications/resources/list_changed, notifications/resources/updated " + logURI(service, "latest") + ", notifications/resources/updated crux://services/" + service
+	if got := notified(); got != want {
+		t.Errorf("after a new run sent %q, want %q", got, want)
+	}
+	subs.remove(logURI(service, "latest"))
+	os.WriteFile(path, []byte("more\n"), 0644)
+	writeTestRun(t, service, "2024-02-11_110000", "again and again\n")
+	subs.poll()
+	if got := notified(); got != "" {
+		t.Errorf("after unsubscribing sent %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/glorko/crux/client"
+)
+
+// Protocol revisions and structured tool output. Tools that agents read programmatically
+// (status, logs, logfile) declare an outputSchema and return structuredContent next to the
+// readable text, for clients on 2025-06-18 or later; older clients get the text only.
+
+// protocolVersions are the MCP revisions crux-mcp speaks, newest first
+var protocolVersions = []string{"2025-11-25", "2025-06-18", "2025-03-26", "2024-11-05"}
+
+// structuredSince is the first revision with outputSchema and structuredContent
+const structuredSince = "2025-06-18"
+
+type InitializeParams struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+// negotiateVersion answers a client's requested revision: the same one if supported,
+// else the newest we speak (the client then decides whether it can continue).
+func negotiateVersion(requested string) string {
+	if supportedVersion(requested) {
+		return requested
+	}
+	return protocolVersions[0]
+}
+
+func supportedVersion(v string) bool {
+	for _, s := range protocolVersions {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputSchema describes a tool's structuredContent (the same JSON Schema subset as inputs)
+type OutputSchema = InputSchema
+
+// LogOutput is the structuredContent of crux_logs and crux_logfile.
+type LogOutput struct {
+	Service string           `json:"service,omitempty"`
+	Run     string           `json:"run,omitempty"`  // crux_logfile: run read ("latest" or a run id)
+	Source  string           `json:"source"`         // scrollback, logfile or index (service/run lists)
+	Lines   int              `json:"lines"`          // lines in log
+	Log     string           `json:"log"`            // the text, as formatted (plain or raw)
+	Runs    []client.RunInfo `json:"runs,omitempty"` // crux_logfile run=list, newest first
+}
+
+func newLogOutput(service, run, source, text string) *LogOutput {
+	out := &LogOutput{Service: service, Run: run, Source: source, Log: text}
+	if trimmed := strings.TrimRight(text, "\n"); trimmed != "" {
+		out.Lines = strings.Count(trimmed, "\n") + 1
+	}
+	return out
+}
+
+var servicesOutputSchema = &OutputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"uptime": {Type: "string", Description: "crux session uptime"},
+		"services": {Type: "array", Items: &Property{
+			Type: "object",
+			Properties: map[string]Property{
+				"name":          {Type: "string"},
+				"state":         {Type: "string", Enum: []string{"pending", "starting", "ready", "crashed", "exited", "stopped"}},
+				"state_since":   {Type: "string", Format: "date-time"},
+				"pid":           {Type: "integer"},
+				"wrapper_pid":   {Type: "integer"},
+				"exit_code":     {Type: "integer", Description: "Set once the run has ended"},
+				"restart_count": {Type: "integer"},
+				"started_at":    {Type: "string", Format: "date-time"},
+				"uptime":        {Type: "string"},
+				"ports":         {Type: "array", Items: &Property{Type: "integer"}},
+				"port_holders":  {Type: "array", Description: "Processes listening on the declared ports", Items: &Property{Type: "object"}},
+				"metrics":       {Type: "object", Description: "Latest CPU/memory sample of the process tree"},
+				"run_id":        {Type: "string"},
+				"last_error":    {Type: "string"},
+				"interactive":   {Type: "boolean"},
+				"has_tab":       {Type: "boolean"},
+				"pane_id":       {Type: "string"},
+				"log_path":      {Type: "string"},
+			},
+			Required: []string{"name", "state", "state_since", "restart_count", "has_tab"},
+		}},
+	},
+	Required: []string{"services", "uptime"},
+}
+
+var logOutputSchema = &OutputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"service": {Type: "string"},
+		"run":     {Type: "string", Description: "Run read: latest or a run id"},
+		"source":  {Type: "string", Enum: []string{"scrollback", "logfile", "index"}},
+		"lines":   {Type: "integer", Description: "Number of lines in log"},
+		"log":     {Type: "string"},
+		"runs": {Type: "array", Description: "run=list: the service's runs, newest first", Items: &Property{
+			Type: "object",
+			Properties: map[string]Property{
+				"id":        {Type: "string"},
+				"started":   {Type: "string", Format: "date-time"},
+				"size":      {Type: "integer", Description: "Log size in bytes"},
+				"modified":  {Type: "string", Format: "date-time"},
+				"exit_code": {Type: "integer"},
+				"latest":    {Type: "boolean"},
+			},
+			Required: []string{"id", "started", "size", "modified"},
+		}},
+	},
+	Required: []string{"source", "lines", "log"},
+}
+
+// intArg reads an integer tool argument (0 when absent). Numbers are expected; numeric
+// strings, which clients sent while the schema declared strings, are still accepted.
+func intArg(args map[string]interface{}, name string) int {
+	switch v := args[name].(type) {
+	case float64:
+		return int(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	}
+	return 0
+}
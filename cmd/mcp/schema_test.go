@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	for requested, want := range map[string]string{
+		"2025-06-18": "2025-06-18",
+		"2024-11-05": "2024-11-05",
+		"2026-01-01": protocolVersions[0],
+		"":           protocolVersions[0],
+		"latest":     protocolVersions[0],
+	} {
+		if got := negotiateVersion(requested); got != want {
+			t.Errorf("negotiateVersion(%q) = %q, want %q", requested, got, want)
+		}
+	}
+}
+
+// session.structured compares revisions as strings, which only holds while they are
+// YYYY-MM-DD dates: pin that down for every revision we speak.
+func TestStructuredByRevision(t *testing.T) {
+	for i, v := range protocolVersions {
+		if len(v) != len("2006-01-02") || v[4] != '-' || v[7] != '-' {
+			t.Errorf("revision %q is not a YYYY-MM-DD date", v)
+		}
+		if i > 0 && protocolVersions[i-1] <= v {
+			t.Errorf("protocolVersions not newest first as strings: %q before %q", protocolVersions[i-1], v)
+		}
+	}
+	for v, want := range map[string]bool{
+		"2025-11-25": true,
+		"2025-06-18": true,
+		"2025-03-26": false,
+		"2024-11-05": false,
+	} {
+		if got := (&session{protocol: v}).structured(); got != want {
+			t.Errorf("structured(%s) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestIntArg(t *testing.T) {
+	args := map[string]interface{}{
+		"float":    100.0,
+		"fraction": 2.9,
+		"number":   json.Number("42"),
+		"string":   " 7 ",
+		"word":     "many",
+		"bool":     true,
+	}
+	for name, want := range map[string]int{"float": 100, "fraction": 2, "number": 42, "string": 7, "word": 0, "bool": 0, "missing": 0} {
+		if got := intArg(args, name); got != want {
+			t.Errorf("intArg(%s) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestStructuredContent(t *testing.T) {
+	newTestAPI(t)
+	call := Request{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: json.RawMessage(`{"name":"crux_status"}`)}
+	for v, want := range map[string]bool{"2025-06-18": true, "2024-11-05": false} {
+		resp := handleRequest(&session{protocol: v}, call)
+		result, ok := resp.Result.(ToolResult)
+		if !ok || result.IsError || (result.StructuredContent != nil) != want {
+			t.Errorf("%s: %+v", v, resp.Result)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glorko/crux/client"
+)
+
+// Which crux session crux-mcp talks to. CRUX_API_URL pins one explicitly. Otherwise every crux
+// registers itself in ~/.crux/sessions and crux-mcp uses the session whose project contains its
+// working directory (or CRUX_PROJECT_DIR), else the only one running, else the default URL.
+// crux_sessions lists the sessions and can pin another one for the MCP session that calls it.
+
+var envAPI *client.Client // set when CRUX_API_URL is
+
+func init() {
+	if os.Getenv("CRUX_API_URL") != "" {
+		envAPI = client.NewFromEnv()
+	}
+}
+
+// cruxTarget is the crux session one MCP session talks to. Each MCP session has its own, so an
+// HTTP client pinning a session with crux_sessions doesn't repoint the others.
+type cruxTarget struct {
+	mu         sync.Mutex
+	pinnedPID  int // chosen with crux_sessions use=...
+	current    *client.Client
+	currentPID int // session current talks to (0: default URL)
+}
+
+// api returns the client for the session in use. It re-resolves the session on every call, so
+// crux-mcp follows crux restarts and sessions started after it.
+func (t *cruxTarget) api() *client.Client {
+	if envAPI != nil {
+		return envAPI
+	}
+	session, ok, _ := t.resolve()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil || t.currentPID != session.PID {
+		if ok {
+			t.current = client.NewForSession(session)
+		} else {
+			t.current = client.NewFromEnv() // default URL; token file for its port
+		}
+		t.currentPID = session.PID
+	}
+	return t.current
+}
+
+// pinned returns the PID chosen with crux_sessions (0: none).
+func (t *cruxTarget) pinned() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pinnedPID
+}
+
+func (t *cruxTarget) pin(pid int) {
+	t.mu.Lock()
+	t.pinnedPID = pid
+	t.mu.Unlock()
+}
+
+// resolve returns the running sessions and the one to use: the pinned one while it runs, else
+// the match for the project directory.
+func (t *cruxTarget) resolve() (client.SessionInfo, bool, []client.SessionInfo) {
+	sessions, err := client.Sessions()
+	if err != nil || len(sessions) == 0 {
+		return client.SessionInfo{}, false, nil
+	}
+	pinned := t.pinned()
+	for _, s := range sessions {
+		if pinned != 0 && s.PID == pinned {
+			return s, true, sessions
+		}
+	}
+	s, ok := client.SessionFor(sessions, projectDir())
+	return s, ok, sessions
+}
+
+func projectDir() string {
+	if dir := os.Getenv("CRUX_PROJECT_DIR"); dir != "" {
+		return dir
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// pickSession finds the session meant by use: a PID, a project directory or its name.
+func pickSession(sessions []client.SessionInfo, use string) (client.SessionInfo, error) {
+	if pid, err := strconv.Atoi(use); err == nil {
+		for _, s := range sessions {
+			if s.PID == pid {
+				return s, nil
+			}
+		}
+		return client.SessionInfo{}, fmt.Errorf("no running crux session with pid %d", pid)
+	}
+	var matches []client.SessionInfo
+	for _, s := range sessions {
+		if s.ProjectDir == filepath.Clean(use) || filepath.Base(s.ProjectDir) == use {
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return client.SessionInfo{}, fmt.Errorf("no running crux session for %q", use)
+	case 1:
+		return matches[0], nil
+	}
+	return client.SessionInfo{}, fmt.Errorf("%d sessions match %q; use the pid", len(matches), use)
+}
+
+func apiSessions(t *cruxTarget, use string) (string, bool) {
+	if envAPI != nil {
+		return "CRUX_API_URL is set (" + os.Getenv("CRUX_API_URL") + "): crux-mcp always uses that session.", use != ""
+	}
+	_, _, sessions := t.resolve()
+	var sb strings.Builder
+	switch use {
+	case "":
+	case "auto":
+		t.pin(0)
+		sb.WriteString("Back to automatic selection by project directory.\n\n")
+	default:
+		s, err := pickSession(sessions, use)
+		if err != nil {
+			return err.Error(), true
+		}
+		t.pin(s.PID)
+		fmt.Fprintf(&sb, "Now using %s (pid %d).\n\n", s.ProjectDir, s.PID)
+	}
+
+	if len(sessions) == 0 {
+		sb.WriteString("No crux sessions running. Start crux in the project directory (crux -c config.yaml).\n")
+		fmt.Fprintf(&sb, "Until then crux-mcp tries %s.", client.DefaultURL)
+		return sb.String(), false
+	}
+	inUse, ok, _ := t.resolve()
+	pinned := t.pinned()
+	fmt.Fprintf(&sb, "Crux sessions (%d), working directory %s:\n", len(sessions), projectDir())
+	for _, s := range sessions {
+		marker := "  "
+		if ok && s.PID == inUse.PID {
+			marker = "* "
+		}
+		fmt.Fprintf(&sb, "%spid %d  %s  %s  up %s", marker, s.PID, s.ProjectDir, s.URL, time.Since(s.Started).Round(time.Second))
+		if len(s.Services) > 0 {
+			fmt.Fprintf(&sb, "  services: %s", strings.Join(s.Services, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	switch {
+	case ok && pinned == inUse.PID:
+		sb.WriteString("* in use (pinned; use=auto to select by project directory again)")
+	case ok:
+		sb.WriteString("* in use (matches the working directory, or is the only session)")
+	default:
+		fmt.Fprintf(&sb, "None matches the working directory; pick one with use=<pid or project>. Until then crux-mcp tries %s.", client.DefaultURL)
+	}
+	return sb.String(), false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glorko/crux/client"
+	"github.com/glorko/crux/internal/api"
+)
+
+func TestSessionPinPerClient(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	prev := envAPI
+	envAPI = nil
+	t.Cleanup(func() { envAPI = prev })
+	projects := t.TempDir()
+	a, b := filepath.Join(projects, "app-a"), filepath.Join(projects, "app-b")
+	os.MkdirAll(a, 0755)
+	os.MkdirAll(b, 0755)
+	t.Setenv("CRUX_PROJECT_DIR", a)
+	// Both PIDs must be alive for the registry to list them
+	for i, s := range []client.SessionInfo{
+		{PID: os.Getpid(), ProjectDir: a, Port: 9101, URL: "http://127.0.0.1:9101"},
+		{PID: os.Getppid(), ProjectDir: b, Port: 9102, URL: "http://127.0.0.1:9102"},
+	} {
+		s.Started = time.Now().Add(time.Duration(i) * time.Second)
+		if err := api.RegisterSession(api.SessionRegistryDir(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	one, two := newSession("one", func(interface{}) {}), newSession("two", func(interface{}) {})
+	inUse := func(sess *session) int {
+		s, _, _ := sess.crux.resolve()
+		return s.PID
+	}
+	if inUse(one) != os.Getpid() || inUse(two) != os.Getpid() {
+		t.Fatalf("by project dir: %d, %d", inUse(one), inUse(two))
+	}
+	if text, isError := apiSessions(one.crux, "app-b"); isError || !strings.HasPrefix(text, "Now using "+b) {
+		t.Fatalf("use=app-b: %s", text)
+	}
+	if inUse(one) != os.Getppid() || inUse(two) != os.Getpid() {
+		t.Errorf("after pinning one: %d, %d; only one should move", inUse(one), inUse(two))
+	}
+	if text, _ := apiSessions(two.crux, ""); !strings.Contains(text, "(matches the working directory") {
+		t.Errorf("two's list: %s", text)
+	}
+	apiSessions(one.crux, "auto")
+	if inUse(one) != os.Getpid() {
+		t.Errorf("after use=auto: %d", inUse(one))
+	}
+}
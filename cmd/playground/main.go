@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -9,10 +10,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/glorko/crux/internal/api"
+	"github.com/glorko/crux/internal/prompts"
 	"github.com/glorko/crux/internal/terminal"
 )
 
@@ -106,6 +109,20 @@ func main() {
 		return
 	}
 
+	// Report dependency, port and session health without starting anything
+	if len(positional) >= 1 && positional[0] == "doctor" {
+		os.Exit(runDoctor(cfg, configPath))
+	}
+
+	// Run a one-off task from the tasks: section and exit with its exit code
+	if len(positional) >= 1 && positional[0] == "run-task" {
+		if len(positional) < 2 {
+			fmt.Printf("❌ usage: crux run-task <task> (available: %s)\n", strings.Join(cfg.taskNames(), ", "))
+			os.Exit(1)
+		}
+		os.Exit(runTask(cfg, positional[1]))
+	}
+
 	// Check and start dependencies first
 	if err := cfg.CheckDependencies(); err != nil {
 		fmt.Printf("%v\n", err)
@@ -145,7 +162,7 @@ func main() {
 	}
 	fmt.Println("✅ Terminal: wezterm")
 	fmt.Println()
-	runWithWezterm(cfg)
+	runWithWezterm(cfg, configPath)
 }
 
 // exitCodeInLogRe matches "Exited with code N" in the wrapper log tail
@@ -267,7 +284,7 @@ func runStartOne(cfg *PlaygroundConfig, configPath string, serviceName string) e
 		return fmt.Errorf("no Wezterm window open: %w (open Wezterm and run crux, or start the crashed tab manually)", err)
 	}
 
-	_, err = terminal.SpawnTabInPane(paneID, svc.Name, workDir, svc.Command, svc.ExpandArgs(), svc.Interactive)
+	_, err = terminal.SpawnTabInPane(paneID, svc.Name, workDir, svc.Command, svc.ExpandArgs(), svc.ExpandEnv(), svc.Interactive)
 	if err != nil {
 		return err
 	}
@@ -282,7 +299,7 @@ func runStartOne(cfg *PlaygroundConfig, configPath string, serviceName string) e
 }
 
 // runWithWezterm uses native Wezterm tabs (no tmux needed)
-func runWithWezterm(cfg *PlaygroundConfig) {
+func runWithWezterm(cfg *PlaygroundConfig, configPath string) {
 	wez := terminal.NewWeztermLauncher()
 	interactiveServices := collectInteractiveServiceNames(cfg.Services)
 	if !wez.IsAvailable() {
@@ -301,6 +318,7 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 	// Kill any previous crux session
 	fmt.Println("🧹 Cleaning up previous session...")
 	wez.KillPrevious()
+	checkServicePorts(cfg)
 
 	fmt.Println("📺 Opening Wezterm with service tabs...")
 
@@ -311,6 +329,7 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 			Name:        svc.Name,
 			Command:     svc.Command,
 			Args:        svc.ExpandArgs(),
+			Env:         svc.ExpandEnv(),
 			WorkDir:     svc.WorkDir,
 			Interactive: svc.Interactive,
 		}
@@ -328,7 +347,69 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 	apiServer := api.NewServer(cfg.API.Port)
 	tc := newWeztermTabController(wez)
 	apiServer.SetTabController(tc)
+	apiServer.SetServices(cfg.ServiceSpecs())
+	apiServer.SetTasks(cfg.TaskSpecs())
+	if abs, err := filepath.Abs(configPath); err == nil {
+		configPath = abs
+	}
+	apiServer.SetConfigPath(configPath)
+	apiServer.SetMetrics(cfg.Metrics.SampleInterval(), cfg.Metrics.History)
+	apiServer.SetExecPolicy(cfg.Exec.Allow, time.Duration(cfg.Exec.Timeout)*time.Second)
+	redactor, err := api.NewRedactor(cfg.Redact.Patterns, cfg.SecretValues())
+	if err != nil {
+		fmt.Printf("⚠️  %v (using built-in redaction only)\n", err)
+		redactor, _ = api.NewRedactor(nil, cfg.SecretValues())
+	}
+	apiServer.SetRedactor(redactor, cfg.Redact.AllowRaw)
+	apiServer.SetListen(cfg.API.Host, cfg.API.Socket)
+	tokenPath := api.TokenPath(cfg.API.Port)
+	token, err := api.GenerateToken()
+	if err == nil {
+		err = api.WriteTokenFile(tokenPath, token)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to create API token: %v\n", err)
+		wez.Cleanup()
+		os.Exit(1)
+	}
+	apiServer.SetToken(token)
+	// Register the session so crux-mcp can find it by project directory
+	sessionDir := api.SessionRegistryDir()
+	err = api.RegisterSession(sessionDir, api.SessionInfo{
+		PID:        os.Getpid(),
+		ConfigPath: configPath,
+		ProjectDir: filepath.Dir(configPath),
+		Port:       cfg.API.Port,
+		URL:        cfg.API.LocalURL(),
+		Socket:     cfg.API.Socket,
+		Token:      token,
+		Started:    time.Now(),
+		Services:   cfg.serviceNames(),
+	})
+	if err != nil {
+		fmt.Printf("⚠️  Failed to register session in %s: %v\n", sessionDir, err)
+	}
+	// cfgMu guards cfg.Services and cfg.Tasks, which config edits (API or hand edits to the file) replace
+	var cfgMu sync.Mutex
+	apiServer.SetConfigReloader(func(data []byte, apply bool) error {
+		newCfg, err := parsePlaygroundConfig(configPath, data)
+		if err != nil || !apply {
+			return err
+		}
+		cfgMu.Lock()
+		cfg.Services, cfg.Tasks = newCfg.Services, newCfg.Tasks
+		cfgMu.Unlock()
+		apiServer.SetServices(newCfg.ServiceSpecs())
+		apiServer.SetTasks(newCfg.TaskSpecs())
+		apiServer.SetExecPolicy(newCfg.Exec.Allow, time.Duration(newCfg.Exec.Timeout)*time.Second)
+		// New env values may be secrets; patterns and allow_raw stay as the session started
+		if redactor, err := api.NewRedactor(cfg.Redact.Patterns, newCfg.SecretValues()); err == nil {
+			apiServer.SetRedactor(redactor, cfg.Redact.AllowRaw)
+		}
+		return nil
+	})
 	apiServer.SetStartOneHandler(func(serviceName string) (string, error) {
+		cfgMu.Lock()
 		var svc *ServiceConfig
 		for i := range cfg.Services {
 			if cfg.Services[i].Name == serviceName {
@@ -341,23 +422,34 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 			for _, s := range cfg.Services {
 				names = append(names, s.Name)
 			}
+			cfgMu.Unlock()
 			return "", fmt.Errorf("service %q not found (available: %s)", serviceName, strings.Join(names, ", "))
 		}
+		def := *svc
+		cfgMu.Unlock()
+		svc = &def
 		cwd, _ := os.Getwd()
 		workDir := svc.WorkDir
 		if workDir == "" {
 			workDir = cwd
 		}
-		if _, err := wez.SpawnTab(svc.Name, workDir, svc.Command, svc.ExpandArgs(), svc.Interactive); err != nil {
+		if _, err := wez.SpawnTab(svc.Name, workDir, svc.Command, svc.ExpandArgs(), svc.ExpandEnv(), svc.Interactive); err != nil {
 			return "", err
 		}
 		return fmt.Sprintf("Started %s in new tab", svc.Name), nil
 	})
 	apiServer.SetOnShutdown(func() {
+		fmt.Println("\n🛑 Shutdown requested via API, stopping services...")
+		apiServer.StopAll()
 		wez.Cleanup()
+		os.Remove(tokenPath)
+		api.UnregisterSession(sessionDir, os.Getpid())
 		os.Exit(0)
 	})
 	go apiServer.Start()
+	if len(cfg.Dependencies) > 0 {
+		go watchDependencies(cfg.Dependencies, apiServer.Events(), 10*time.Second)
+	}
 
 	fmt.Println()
 	fmt.Println("✅ Services running in Wezterm tabs!")
@@ -365,7 +457,11 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 		fmt.Printf("   Interactive services: %s\n", strings.Join(interactiveServices, ", "))
 		fmt.Println("   This service is interactive; complete prompts in its terminal tab.")
 	}
-	fmt.Printf("\n🌐 API: http://localhost:%d (MCP uses this)\n", cfg.API.Port)
+	fmt.Printf("\n🌐 API: http://%s (MCP uses this)\n", net.JoinHostPort(cfg.API.Host, strconv.Itoa(cfg.API.Port)))
+	fmt.Printf("   Token: %s (crux-mcp reads it automatically)\n", tokenPath)
+	if cfg.API.Socket != "" {
+		fmt.Printf("   Socket: %s\n", cfg.API.Socket)
+	}
 	fmt.Println()
 	fmt.Println("   Ctrl+C here = close all tabs and exit")
 	fmt.Println("   Or just close this terminal - tabs stay running")
@@ -374,7 +470,9 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 	// After a short delay, check if any service already exited with error and warn loudly
 	go func() {
 		time.Sleep(15 * time.Second)
+		cfgMu.Lock()
 		names := collectNonInteractiveServiceNames(cfg.Services)
+		cfgMu.Unlock()
 		failed := checkServiceFailures(names)
 		if len(failed) > 0 {
 			printFailedServicesWarning(names, failed)
@@ -392,8 +490,19 @@ func runWithWezterm(cfg *PlaygroundConfig) {
 
 	// Wait for signal
 	<-sigChan
-	fmt.Println("\n🛑 Shutting down...")
+	fmt.Println("\n🛑 Shutting down (Ctrl+C again to force)...")
+	go func() {
+		<-sigChan
+		fmt.Println("\n⚠️  Forced shutdown")
+		wez.Cleanup()
+		os.Remove(tokenPath)
+		api.UnregisterSession(sessionDir, os.Getpid())
+		os.Exit(1)
+	}()
+	apiServer.StopAll()
 	wez.Cleanup()
+	os.Remove(tokenPath)
+	api.UnregisterSession(sessionDir, os.Getpid())
 	fmt.Println("✅ All tabs closed")
 }
 
@@ -433,173 +542,11 @@ func sendCommand(pipePath string, cmd string) error {
 func printAgentPrompt() {
 	fmt.Print(`# Crux Agent Prompt
 # Copy everything below this line and paste to your AI assistant
+# (MCP clients get the same text as the crux-mcp prompt write_config)
 # ================================================================
 
-I want you to set up and run my development environment using crux.
-
-NOTE: crux is tested on macOS. May work on Linux (Wezterm is cross-platform).
-
-## Step 1: Verify crux is installed
-Run: crux --help
-If not found, tell the user to install crux:
-  git clone https://github.com/glorko/crux.git
-  cd crux
-  ./install.sh
-  # Add ~/go/bin and ~/bin to PATH
-
-## Step 2: Check MCP integration
-Run: which crux-mcp
-If not found, tell the user:
-  "crux-mcp is not installed. Run ./install.sh in the crux repo.
-   
-   Then add to Cursor MCP config:
-   {\"mcpServers\":{\"crux\":{\"command\":\"${userHome}/bin/crux-mcp\",\"args\":[]}}}"
-
-## Step 3: Analyze this project - USE EXISTING SCRIPTS, DO NOT GUESS
-
-CRITICAL: Do NOT guess commands like "go run ./cmd/server" or "react-native run". 
-You MUST find and use the project's actual run scripts. Read files, don't assume.
-
-For each service, look for and USE (in order of priority):
-1. scripts/ folder - start.sh, run.sh, dev.sh, scripts/start-backend.sh, etc.
-2. Makefile - targets like "run", "start", "dev", "backend"
-3. package.json "scripts" - "start", "dev", "run:ios", "run:android", "run:web", etc.
-4. docker-compose.yml - services and how they're started
-5. README or docs - often document the exact run commands
-
-Backend: Look for scripts/run.sh, Make run, npm run dev - NOT "go run" unless that's what the script uses.
-React Native: Almost always uses package.json scripts (npm run ios, yarn android, etc.) - NOT "react-native run" directly.
-Flutter: Uses flutter run -d <device> but check if there's a wrapper script first.
-
-WRONG: guessing "go run ./cmd/server" when project has scripts/start-backend.sh
-RIGHT: command: ./scripts/start-backend.sh  workdir: ./
-WRONG: guessing "react-native run" for a React Native app
-RIGHT: command: npm  args: ["run", "ios"]  (or whatever package.json "scripts" actually defines)
-
-If a service may ask for password/auth/confirmation prompts (for example Shopify CLI), set:
-  interactive: true
-This runs it in a real terminal TTY tab without non-interactive wrapper piping.
-
-Identify:
-- Backend services (Go, Python, Node.js, etc.) - and which script starts each
-- Mobile apps (Flutter, React Native) - and their actual run commands from package.json/scripts
-- Web apps (React, Vue, etc.) - usually npm run dev / yarn dev
-
-## Step 3a: Backend infrastructure dependencies
-Check if project needs databases/caches. Ask user: "Are postgres/redis/mongo already running, or should crux start them?"
-
-If crux should manage them, add to dependencies:
-  - name: postgres
-    check: pg_isready -h localhost -p 5432
-    start: docker run -d --name crux-postgres -p 5432:5432 -e POSTGRES_PASSWORD=postgres postgres:15
-    timeout: 30
-  - name: redis
-    check: redis-cli ping
-    start: docker run -d --name crux-redis -p 6379:6379 redis:7
-    timeout: 15
-
-## Step 3b: Mobile app dependencies (REQUIRED if project has mobile apps)
-IMPORTANT: If project contains Flutter, React Native, iOS, or Android apps, you MUST add emulator dependencies.
-
-For iOS apps - add this dependency:
-  - name: ios-simulator
-    check: xcrun simctl list devices | grep -q Booted
-    start: open -a Simulator
-    timeout: 60
-
-For Android apps - first find AVD name with: emulator -list-avds
-Then add this dependency (replace YOUR_AVD_NAME):
-  - name: android-emulator
-    check: adb devices | grep -q emulator
-    start: nohup emulator -avd YOUR_AVD_NAME > /dev/null 2>&1 &
-    timeout: 120
-
-## Step 3c: Get device IDs for mobile services
-For iOS: run "xcrun simctl list devices available"
-- Use the UUID (e.g., "90266925-B62F-4741-A89E-EF11BFA0CC57")
-- If no simulators, tell user to create one in Xcode
-
-For Android: run "flutter devices" (after emulator starts)
-- Use the device ID (e.g., "emulator-5554")
-- If no emulators, tell user to create AVD in Android Studio
-
-## Step 4: Create config.yaml
-Create a config.yaml using the ACTUAL commands you found (from scripts, Makefile, package.json).
-- One service entry per runnable component
-- command/args = what the project's scripts use, e.g.:
-  - Script: command: ./scripts/start-backend.sh  (or /bin/bash -c "./scripts/start-backend.sh")
-  - Makefile: command: make  args: ["run"]
-  - package.json: command: npm  args: ["run", "dev"]  (use the exact script name)
-  - React Native: command: npm  args: ["run", "ios"]  (or "run:ios", whatever package.json has)
-- Working directories relative to config.yaml (where the script/command runs from)
-- For prompt-driven CLIs (Shopify, auth/password prompts), set interactive: true
-- terminal.app set to wezterm
-
-Run: crux --help
-to see the exact config format.
-
-## Step 5: Run crux
-Run: crux
-This opens Wezterm with all services in separate tabs.
-
-## Step 6: Use MCP to control services
-Once running, you can use these MCP tools:
-
-crux_status
-  - No parameters
-  - Returns: List of all tabs with numbers and titles
-
-crux_send
-  - tab: Tab number (1,2,3...) or partial name ("backend", "flutter")
-  - text: Command to send ("r"=reload, "R"=restart, "q"=quit, or any text)
-
-crux_logs
-  - tab: Tab number or partial name
-  - lines: Number of lines to get (default: 50)
-  - Returns: Live terminal scrollback from the running tab
-
-crux_focus
-  - tab: Tab number or partial name
-  - Action: Brings that tab to front in Wezterm
-
-crux_start_one
-  - service: Service name from config (e.g. backend, flutter-ios)
-  - Action: Start that service in a new tab (or new window). Use when a service crashed.
-
-crux_logfile
-  - service: Service name ("backend") or "list" to see all services with logs
-  - run: "latest" (default), "list" to show run history, or timestamp like "2024-02-11_143022"
-  - lines: Number of lines from end (default: 100)
-  - Returns: Log file content from /tmp/crux-logs/<service>/<timestamp>.log
-  - USE WHEN: Tab crashed/closed, debugging failed startup, or viewing run history
-
-Log structure:
-  /tmp/crux-logs/<service>/<timestamp>.log (keeps last 10 runs per service)
-  /tmp/crux-logs/<service>/latest.log -> symlink to most recent
-
-If a command fails, the tab stays open with error message until Enter is pressed.
-
-Examples:
-- "What services are running?" -> crux_status
-- "Hot reload Flutter" -> crux_send tab="flutter" text="r"
-- "Show live backend logs" -> crux_logs tab="backend"
-- "Backend crashed, what happened?" -> crux_logfile service="backend"
-- "What services have logs?" -> crux_logfile service="list"
-- "Show previous backend runs" -> crux_logfile service="backend" run="list"
-- "Read this morning's run" -> crux_logfile service="backend" run="2024-02-11_090000"
-
-## Notes
-- NEVER guess: "go run", "react-native run", "python main.py" - always read scripts/package.json/Makefile first
-- If a service has scripts/start.sh or similar, use it: command: ./scripts/start.sh
-- For Python with venv, use the project's run script (./run.sh, Makefile, etc.)
-- For React Native, use package.json scripts (npm run ios, yarn android) - not react-native CLI directly
-- For Flutter, you need actual device IDs:
-  - iOS: Get UUID with "xcrun simctl list devices"
-  - Android: Start emulator first, then get ID from "flutter devices"
-- Services run in interactive terminals - Ctrl+C, keyboard input all work
-- Wezterm must be installed: brew install --cask wezterm
-
 `)
+	fmt.Print(prompts.Setup)
 }
 
 func printHelp() {
@@ -615,6 +562,7 @@ COMMANDS:
     (none)      Start services from config file
     init        Generate example config.yaml
     prompt      Print AI agent prompt (for configuring crux via LLM)
+    doctor      Check dependencies, who holds the declared ports, and the running session
     help        Show this help message
     version     Show version
 
@@ -623,6 +571,8 @@ COMMANDS:
         crux -c config.test.yaml    # Use test configuration
         crux --config=config.e2e.yaml
         crux start-one backend      # Start only one service in current Wezterm window (e.g. after crash)
+        crux run-task migrate       # Run a one-off task from the tasks: section
+        crux doctor                 # Check dependencies, port holders and the running session
 
 CONFIGURATION:
     Create a config.yaml in your project root:
@@ -701,14 +651,34 @@ MCP INTEGRATION:
     Add to Cursor MCP config:
       {"mcpServers":{"crux":{"command":"${userHome}/bin/crux-mcp","args":[]}}}
 
+    Or share one server between several agents (streamable HTTP):
+      crux-mcp --http 127.0.0.1:9878   →   {"mcpServers":{"crux":{"url":"http://127.0.0.1:9878/mcp"}}}
+
     Available MCP tools:
       crux_status   - List all terminal tabs
-      crux_send     - Send commands to tabs (r=reload, R=restart, q=quit)
+      crux_send     - Send keys to tabs (r=reload, R=restart, q=quit; Flutter only)
       crux_logs     - Get live terminal output from running tabs
       crux_focus    - Focus a specific tab
       crux_start_one - Start one service in new tab (same session, after crash)
+      crux_batch    - Start/stop/restart several services and wait until ready
+      crux_run_task - Run a task from tasks: (migrate, seed...) and return its output
+      crux_exec     - Run an allowed command (exec.allow) in a service's workdir and env
       crux_logfile  - Read log history for crashed/closed tabs
                      Logs: /tmp/crux-logs/<service>/<timestamp>.log
+      crux_timeline - Interleave recent lines from several services by time
+      crux_compare_runs - Show what changed between two runs of a service
+      crux_metrics  - CPU and memory per service (find the tab eating 8GB)
+      crux_wait_for - Wait for a log line, state or URL (after a hot reload)
+      crux_config_get / crux_config_set_service / crux_config_remove_service
+                    - Read and safely edit config.yaml (optionally apply now)
+      crux_sessions - List crux sessions (one per project) and pick one
+      crux_action_<service>_<action>
+                    - One tool per action under a service's actions: (send, exec or task)
+
+    MCP resources (subscribable): crux://services, crux://services/<service>,
+      crux://logs/<service>/latest, crux://logs/<service>/<run>
+    MCP prompts: diagnose_crash, explain_startup_failure, write_config
+    MCP notifications: crashes, services not ready after 60s, failing dependencies
 
 MORE INFO:
     https://github.com/glorko/crux
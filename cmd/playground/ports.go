@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glorko/crux/client"
+	"github.com/glorko/crux/internal/api"
+	"golang.org/x/term"
+)
+
+// portUse is a port declared in config and who declared it
+type portUse struct {
+	Port  int
+	Owner string // service or dependency name
+	IsDep bool
+}
+
+func (c *PlaygroundConfig) declaredPorts() []portUse {
+	var uses []portUse
+	for _, dep := range c.Dependencies {
+		for _, p := range dep.Ports {
+			uses = append(uses, portUse{Port: p, Owner: dep.Name, IsDep: true})
+		}
+	}
+	for _, svc := range c.Services {
+		for _, p := range svc.Ports {
+			uses = append(uses, portUse{Port: p, Owner: svc.Name})
+		}
+	}
+	return uses
+}
+
+func portNumbers(uses []portUse) []int {
+	ports := make([]int, len(uses))
+	for i, u := range uses {
+		ports[i] = u.Port
+	}
+	return ports
+}
+
+// checkServicePorts runs before services start: any process already listening on a service's
+// port would make it fail with EADDRINUSE. Leftovers from an earlier crux session are offered
+// for killing; anything else is reported.
+func checkServicePorts(cfg *PlaygroundConfig) {
+	var uses []portUse
+	for _, u := range cfg.declaredPorts() {
+		if !u.IsDep {
+			uses = append(uses, u)
+		}
+	}
+	holders := api.FindPortHolders(portNumbers(uses))
+	for _, h := range holders {
+		if h.CruxService != "" {
+			// Tabs closed by KillPrevious may still be shutting down
+			time.Sleep(time.Second)
+			holders = api.FindPortHolders(portNumbers(uses))
+			break
+		}
+	}
+	if len(holders) == 0 {
+		return
+	}
+	fmt.Println("🔌 Ports already in use:")
+	for _, u := range uses {
+		h, held := holders[u.Port]
+		if !held {
+			continue
+		}
+		if h.CruxService == "" {
+			fmt.Printf("  ⚠️  %d (%s) is held by %s; %s will probably fail to start\n", u.Port, u.Owner, h, u.Owner)
+			continue
+		}
+		fmt.Printf("  ⚠️  %d (%s) is held by %s, left over from an earlier crux session\n", u.Port, u.Owner, h)
+		offerKill(h)
+	}
+	fmt.Println()
+}
+
+// offerKill asks on the terminal whether to kill a stale holder (just prints how otherwise).
+func offerKill(h api.PortHolder) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("     stop it with: kill %d\n", h.PID)
+		return false
+	}
+	fmt.Printf("     Kill pid %d? [Y/n] ", h.PID)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "" && a != "y" && a != "yes" {
+		return false
+	}
+	if err := h.Kill(5 * time.Second); err != nil {
+		fmt.Printf("     ❌ %v\n", err)
+		return false
+	}
+	fmt.Printf("     ✅ killed pid %d\n", h.PID)
+	return true
+}
+
+// runDoctor reports dependency checks, who holds the declared ports and whether a crux session
+// is running, without starting anything. Returns the exit code (1 when something needs attention).
+func runDoctor(cfg *PlaygroundConfig, configPath string) int {
+	problems := 0
+	fmt.Printf("🩺 crux doctor (%s)\n\n", configPath)
+
+	if len(cfg.Dependencies) > 0 {
+		fmt.Println("Dependencies:")
+		for _, dep := range cfg.Dependencies {
+			if runCheck(dep.Check) {
+				fmt.Printf("  ✅ %s\n", dep.Name)
+			} else {
+				problems++
+				fmt.Printf("  ❌ %s is not running (check: %s)\n", dep.Name, dep.Check)
+			}
+		}
+		fmt.Println()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := client.New(cfg.API.LocalURL(), "").Services(ctx)
+	fmt.Println("Session:")
+	if err != nil {
+		fmt.Printf("  ⏹  no crux session at %s\n", cfg.API.LocalURL())
+	} else {
+		fmt.Printf("  ✅ crux running at %s (up %s)\n", cfg.API.LocalURL(), status.Uptime)
+		for _, st := range status.Services {
+			fmt.Printf("     %-20s %s\n", st.Name, st.State)
+		}
+	}
+	fmt.Println()
+
+	// Holders the running session reports as its own services' current runs
+	own := make(map[int]bool)
+	if status != nil {
+		for _, st := range status.Services {
+			for _, h := range st.PortHolders {
+				if h.Own {
+					own[h.Port] = true
+				}
+			}
+		}
+	}
+	uses := cfg.declaredPorts()
+	if len(uses) > 0 {
+		holders := api.FindPortHolders(portNumbers(uses))
+		fmt.Println("Ports:")
+		for _, u := range uses {
+			h, held := holders[u.Port]
+			switch {
+			case !held && u.IsDep:
+				problems++
+				fmt.Printf("  ❌ %-6d %-20s nothing listening\n", u.Port, u.Owner)
+			case !held:
+				fmt.Printf("  ·  %-6d %-20s free\n", u.Port, u.Owner)
+			case u.IsDep || own[u.Port]:
+				fmt.Printf("  ✅ %-6d %-20s %s\n", u.Port, u.Owner, h)
+			case h.CruxService != "":
+				problems++
+				fmt.Printf("  ⚠️  %-6d %-20s %s, left over from an earlier crux session\n", u.Port, u.Owner, h)
+				if offerKill(h) {
+					problems--
+				}
+			default:
+				problems++
+				fmt.Printf("  ⚠️  %-6d %-20s in use by %s\n", u.Port, u.Owner, h)
+			}
+		}
+		fmt.Println()
+	}
+
+	if problems > 0 {
+		fmt.Printf("%d problem(s) found\n", problems)
+		return 1
+	}
+	fmt.Println("✅ No problems found")
+	return 0
+}
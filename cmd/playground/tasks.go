@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/glorko/crux/client"
+	"github.com/glorko/crux/internal/api"
+)
+
+func (c *PlaygroundConfig) taskNames() []string {
+	names := make([]string, len(c.Tasks))
+	for i, task := range c.Tasks {
+		names[i] = task.Name
+	}
+	return names
+}
+
+// runTask runs a task from the tasks: section in this terminal (crux run-task migrate) and
+// returns the exit code to exit with. Service requirements are checked against the running crux.
+func runTask(cfg *PlaygroundConfig, name string) int {
+	var spec *api.TaskSpec
+	specs := cfg.TaskSpecs()
+	for i := range specs {
+		if specs[i].Name == name {
+			spec = &specs[i]
+			break
+		}
+	}
+	if spec == nil {
+		fmt.Printf("❌ task %q not found in config (available: %s)\n", name, strings.Join(cfg.taskNames(), ", "))
+		return 1
+	}
+
+	crux := client.New(cfg.API.LocalURL(), "")
+	err := api.CheckTaskRequirements(*spec, func(svc string) (api.ServiceState, error) {
+		resp, err := crux.Services(context.Background())
+		if err != nil {
+			return "", fmt.Errorf("can't check, crux is not running (%v)", err)
+		}
+		for _, st := range resp.Services {
+			if st.Name == svc {
+				return st.State, nil
+			}
+		}
+		return "", fmt.Errorf("not in the running crux session")
+	})
+	if err != nil {
+		fmt.Printf("❌ %s: %v\n", name, err)
+		return 1
+	}
+
+	fmt.Printf("▶ %s: %s\n\n", name, spec.CommandLine())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	res := api.RunTask(ctx, *spec, os.Stdout)
+	fmt.Println()
+	switch {
+	case res.Success:
+		fmt.Printf("✅ %s finished in %s (log: %s)\n", name, res.Duration, res.LogPath)
+		return 0
+	case res.Message != "":
+		fmt.Printf("❌ %s: %s (log: %s)\n", name, res.Message, res.LogPath)
+	default:
+		fmt.Printf("❌ %s exited with code %d after %s (log: %s)\n", name, res.ExitCode, res.Duration, res.LogPath)
+	}
+	if res.ExitCode > 0 {
+		return res.ExitCode
+	}
+	return 1
+}
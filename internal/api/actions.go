@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations accepted by POST /actions
+const (
+	OpStart   = "start"
+	OpStop    = "stop"
+	OpRestart = "restart"
+	OpSend    = "send"
+)
+
+// GroupAll selects every configured service in an Action
+const GroupAll = "all"
+
+var errTabsUnavailable = errors.New("tab controller not available")
+
+// ActionsRequest is the body of POST /actions. Actions run in order; with Wait set, the call
+// then blocks until every affected service reaches its target state or Timeout passes.
+type ActionsRequest struct {
+	Actions []Action     `json:"actions"`
+	Wait    bool         `json:"wait,omitempty"`
+	State   ServiceState `json:"state,omitempty"`   // target for all services (default: ready after start/restart, stopped after stop)
+	Timeout string       `json:"timeout,omitempty"` // wait timeout, e.g. "90s" (default 60s)
+}
+
+// Action is one operation applied to a list of services and/or a group.
+type Action struct {
+	Op       string   `json:"op"`
+	Services []string `json:"services,omitempty"`
+	Group    string   `json:"group,omitempty"` // services listing this group; "all" = every service
+	Text     string   `json:"text,omitempty"`  // for send
+}
+
+// ActionResult is the outcome of one operation on one service.
+type ActionResult struct {
+	Op           string       `json:"op"`
+	Service      string       `json:"service"`
+	Success      bool         `json:"success"`
+	Message      string       `json:"message"`
+	RunID        string       `json:"run_id,omitempty"`
+	State        ServiceState `json:"state,omitempty"`         // last observed state (when waiting)
+	Duration     string       `json:"duration"`                // time the operation took
+	WaitDuration string       `json:"wait_duration,omitempty"` // time until the target state was reached or the wait gave up
+}
+
+// ActionsResponse is the response for POST /actions
+type ActionsResponse struct {
+	Success  bool           `json:"success"`
+	Results  []ActionResult `json:"results"`
+	Duration string         `json:"duration"`
+}
+
+// resolveAction returns the services an action applies to: explicit names first, then the
+// group in config order (reversed for stop, so dependents stop before what they depend on).
+func (s *Server) resolveAction(a Action) ([]string, error) {
+	switch a.Op {
+	case OpStart, OpStop, OpRestart:
+	case OpSend:
+		if a.Text == "" {
+			return nil, fmt.Errorf("send needs text")
+		}
+	default:
+		return nil, fmt.Errorf("unknown op %q (use start, stop, restart or send)", a.Op)
+	}
+	s.mu.RLock()
+	specs := append([]ServiceSpec(nil), s.services...)
+	s.mu.RUnlock()
+
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range a.Services {
+		if len(specs) > 0 {
+			if _, ok := specFrom(specs, name); !ok {
+				return nil, fmt.Errorf("service %q not found in config", name)
+			}
+		}
+		add(name)
+	}
+	if a.Group != "" {
+		var group []string
+		for _, spec := range specs {
+			if a.Group == GroupAll || containsString(spec.Groups, a.Group) {
+				group = append(group, spec.Name)
+			}
+		}
+		if len(group) == 0 {
+			return nil, fmt.Errorf("group %q matches no services", a.Group)
+		}
+		if a.Op == OpStop {
+			for i, j := 0, len(group)-1; i < j; i, j = i+1, j-1 {
+				group[i], group[j] = group[j], group[i]
+			}
+		}
+		for _, name := range group {
+			add(name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s needs services or group", a.Op)
+	}
+	return names, nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// RunActions applies a batch of actions (validated up front) and optionally waits for the
+// affected services to settle. Each operation holds the service's lifecycle lock.
+func (s *Server) RunActions(req ActionsRequest) (ActionsResponse, error) {
+	if len(req.Actions) == 0 {
+		return ActionsResponse{}, fmt.Errorf("actions required")
+	}
+	timeout := defaultReadyTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			return ActionsResponse{}, fmt.Errorf("invalid timeout %q (use e.g. 30s or 2m)", req.Timeout)
+		}
+		timeout = d
+	}
+	targets := make([][]string, len(req.Actions))
+	for i, a := range req.Actions {
+		names, err := s.resolveAction(a)
+		if err != nil {
+			return ActionsResponse{}, fmt.Errorf("action %d: %w", i+1, err)
+		}
+		targets[i] = names
+	}
+	s.mu.RLock()
+	tc := s.tabCtrl
+	s.mu.RUnlock()
+	if tc == nil {
+		return ActionsResponse{}, errTabsUnavailable
+	}
+
+	start := time.Now()
+	resp := ActionsResponse{Success: true}
+	last := make(map[string]int) // service -> index of its last lifecycle result, which is what we wait on
+	for i, a := range req.Actions {
+		for _, name := range targets[i] {
+			res := s.runAction(tc, a, name)
+			if !res.Success {
+				resp.Success = false
+			}
+			if a.Op != OpSend && res.Success {
+				last[name] = len(resp.Results)
+			}
+			resp.Results = append(resp.Results, res)
+		}
+	}
+
+	if req.Wait {
+		var wg sync.WaitGroup
+		waitStart := time.Now()
+		for _, idx := range last {
+			wg.Add(1)
+			go func(res *ActionResult) {
+				defer wg.Done()
+				st, ok := s.waitForTarget(res.Service, res.Op, req.State, timeout)
+				res.State = st.State
+				res.WaitDuration = time.Since(waitStart).Round(100 * time.Millisecond).String()
+				if !ok {
+					res.Success = false
+					res.Message += fmt.Sprintf("; state %s", st.State)
+					if st.LastError != "" {
+						res.Message += ": " + st.LastError
+					}
+				}
+			}(&resp.Results[idx])
+		}
+		wg.Wait()
+		for _, res := range resp.Results {
+			if !res.Success {
+				resp.Success = false
+			}
+		}
+	}
+	resp.Duration = time.Since(start).Round(100 * time.Millisecond).String()
+	return resp, nil
+}
+
+// runAction applies one operation to one service.
+func (s *Server) runAction(tc TabController, a Action, name string) ActionResult {
+	start := time.Now()
+	res := ActionResult{Op: a.Op, Service: name}
+	lock := s.serviceLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	st, _ := s.serviceStatus(name)
+	switch a.Op {
+	case OpStart:
+		if st.HasTab {
+			res.Success, res.Message, res.RunID = true, "already running", st.RunID
+			break
+		}
+		res.RunID, res.Message, res.Success = s.startAndWaitRun(name)
+	case OpStop:
+		if !st.HasTab {
+			res.Success, res.Message = true, "not running"
+			break
+		}
+		msg, err := s.StopService(name)
+		res.Success, res.Message = err == nil, msg
+		if err != nil {
+			res.Message = err.Error()
+		}
+	case OpRestart:
+		r := s.restartLocked(name, 0)
+		res.Success, res.Message, res.RunID = r.Success, r.Message, r.RunID
+	case OpSend:
+		err := s.sendInput(tc, name, a.Text)
+		res.Success, res.Message = err == nil, "sent"
+		if err != nil {
+			res.Message = err.Error()
+		}
+	}
+	res.Duration = time.Since(start).Round(100 * time.Millisecond).String()
+	return res
+}
+
+// startAndWaitRun starts a service and waits for its run record. Caller holds the service lock.
+func (s *Server) startAndWaitRun(name string) (runID, msg string, ok bool) {
+	s.mu.RLock()
+	startOne := s.startOneHdl
+	spec, _ := s.specFor(name)
+	s.mu.RUnlock()
+	if startOne == nil {
+		return "", "Start not available (crux must be running with wezterm)", false
+	}
+	prev := latestRunID(logBaseDir, name)
+	avoidRunIDReuse(prev)
+	msg, err := startOne(name)
+	if err != nil {
+		return "", err.Error(), false
+	}
+	if spec.Interactive {
+		return "", msg, true
+	}
+	if runID, ok = waitNewRun(name, prev, newRunTimeout); !ok {
+		return "", fmt.Sprintf("started, but no new run appeared within %s", newRunTimeout), false
+	}
+	return runID, msg, true
+}
+
+// waitForTarget waits for the state an operation should end in. Without an explicit target,
+// start/restart wait for ready (giving up early on crashed/exited) and stop for stopped.
+func (s *Server) waitForTarget(name, op string, target ServiceState, timeout time.Duration) (ServiceStatus, bool) {
+	if target != "" {
+		return s.waitForState(name, timeout, target)
+	}
+	if op == OpStop {
+		return s.waitForState(name, timeout, StateStopped, StateExited, StateCrashed, StatePending)
+	}
+	st, _ := s.waitForState(name, timeout, StateReady, StateCrashed, StateExited)
+	return st, st.State == StateReady
+}
+
+// handleActions runs a batch of operations (POST /actions).
+func (s *Server) handleActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ActionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.State = ServiceState(strings.ToLower(string(req.State)))
+	resp, err := s.RunActions(req)
+	if err == errTabsUnavailable {
+		http.Error(w, "Tab controller not available", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Messages of failed waits end with the service's last error line
+	red := s.redactFor(r)
+	for i := range resp.Results {
+		resp.Results[i].Message = red.Redact(resp.Results[i].Message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveAction(t *testing.T) {
+	s := NewServer(0)
+	s.SetServices([]ServiceSpec{
+		{Name: "db", Groups: []string{"infra"}},
+		{Name: "backend", Groups: []string{"infra", "api"}},
+		{Name: "web"},
+	})
+	for _, tc := range []struct {
+		action Action
+		want   []string
+	}{
+		{Action{Op: OpStart, Group: "infra"}, []string{"db", "backend"}},
+		{Action{Op: OpStop, Group: "infra"}, []string{"backend", "db"}},
+		{Action{Op: OpRestart, Services: []string{"web", "backend"}, Group: "api"}, []string{"web", "backend"}},
+		{Action{Op: OpStop, Group: GroupAll}, []string{"web", "backend", "db"}},
+		{Action{Op: OpSend, Services: []string{"web"}, Text: "r"}, []string{"web"}},
+	} {
+		got, err := s.resolveAction(tc.action)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("resolveAction(%+v) = %v, %v; want %v", tc.action, got, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		action Action
+		errSub string
+	}{
+		{Action{Op: "reboot", Services: []string{"web"}}, "unknown op"},
+		{Action{Op: OpSend, Services: []string{"web"}}, "needs text"},
+		{Action{Op: OpStart, Services: []string{"nope"}}, "not found"},
+		{Action{Op: OpStart, Group: "mobile"}, "matches no services"},
+		{Action{Op: OpStart}, "needs services or group"},
+	} {
+		if _, err := s.resolveAction(tc.action); err == nil || !strings.Contains(err.Error(), tc.errSub) {
+			t.Errorf("resolveAction(%+v) err = %v, want %q", tc.action, err, tc.errSub)
+		}
+	}
+}
+
+func TestRunActionsValidatesBeforeActing(t *testing.T) {
+	s := NewServer(0)
+	s.SetServices([]ServiceSpec{{Name: "web"}})
+	_, err := s.RunActions(ActionsRequest{Actions: []Action{
+		{Op: OpStart, Services: []string{"web"}},
+		{Op: OpStop, Services: []string{"nope"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "action 2") {
+		t.Fatalf("err = %v, want action 2 error", err)
+	}
+	if _, err := s.RunActions(ActionsRequest{Actions: []Action{{Op: OpStart, Services: []string{"web"}}}}); err != errTabsUnavailable {
+		t.Fatalf("err = %v, want errTabsUnavailable", err)
+	}
+}
+
+func TestHandleActionsRedactsMessages(t *testing.T) {
+	const name = "crux-test-actions-redact"
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(logBaseDir, name)) })
+	runID := time.Now().Format(runFileLayout)
+	writeRun(t, logBaseDir, name, runID, "panic: login as admin:hunter2 failed\n")
+	code := 1
+	writeRecord(t, logBaseDir, name, runID, 0, &code)
+
+	s := NewServer(0)
+	s.SetTabController(newFakeTabs(name))
+	s.SetServices([]ServiceSpec{{Name: name}})
+	red, _ := NewRedactor(nil, []string{"hunter2"})
+	s.SetRedactor(red, false)
+	body := `{"actions": [{"op": "start", "services": ["` + name + `"]}], "wait": true, "timeout": "5s"}`
+	rec := httptest.NewRecorder()
+	s.handleActions(rec, httptest.NewRequest("POST", "/actions", strings.NewReader(body)))
+
+	var resp ActionsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	if resp.Success || len(resp.Results) != 1 || !strings.Contains(resp.Results[0].Message, "login as admin") {
+		t.Fatalf("response = %+v", resp)
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") {
+		t.Errorf("secret in response: %s", rec.Body)
+	}
+}
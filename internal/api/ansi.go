@@ -0,0 +1,408 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Log output formats for ?format= on log endpoints
+const (
+	FormatRaw   = "raw"   // bytes exactly as the terminal/log file has them
+	FormatPlain = "plain" // escape sequences applied and stripped, \r progress collapsed
+	FormatHTML  = "html"  // like plain, but SGR colors kept as <span> styles
+)
+
+// parseLogFormat reads ?format= with a default, rejecting unknown values.
+func parseLogFormat(r *http.Request, def string) (string, error) {
+	f := r.URL.Query().Get("format")
+	if f == "" {
+		return def, nil
+	}
+	switch f {
+	case FormatRaw, FormatPlain, FormatHTML:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid format %q (use plain, raw or html)", f)
+}
+
+// writeLogText renders log text in the requested format, redacts it and writes the response.
+func (s *Server) writeLogText(w http.ResponseWriter, r *http.Request, content, format string) {
+	red := s.redactFor(r)
+	switch format {
+	case FormatPlain:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(red.Redact(renderPlain(content))))
+	case FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(renderHTML(red.Redact(content))))
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(red.Redact(content)))
+	}
+}
+
+// Limits on cursor movement, so a stray or hostile escape sequence (ESC[999999999C) can't make
+// the screen allocate without bound
+const (
+	maxCursorCol     = 1000 // ESC[C and ESC[G stop here, unless the line is already longer
+	cursorDownMargin = 1    // ESC[B and ESC[E go at most this many lines below the last one
+)
+
+// cell is one rendered character with the CSS style active when it was written
+type cell struct {
+	r     rune
+	style string
+}
+
+// screen is a minimal terminal emulator: enough cursor movement and erasing to replay
+// progress bars (\r, ESC[K, ESC[A ...) into their final state. Lines only grow downwards.
+type screen struct {
+	lines [][]cell
+	row   int
+	col   int
+	sgr   sgrState
+}
+
+func newScreen() *screen {
+	return &screen{lines: [][]cell{nil}}
+}
+
+func (sc *screen) put(r rune) {
+	line := sc.lines[sc.row]
+	for len(line) < sc.col {
+		line = append(line, cell{r: ' '})
+	}
+	c := cell{r: r, style: sc.sgr.css()}
+	if sc.col < len(line) {
+		line[sc.col] = c
+	} else {
+		line = append(line, c)
+	}
+	sc.lines[sc.row] = line
+	sc.col++
+}
+
+func (sc *screen) newline() {
+	sc.row++
+	for len(sc.lines) <= sc.row {
+		sc.lines = append(sc.lines, nil)
+	}
+	sc.col = 0
+}
+
+func (sc *screen) eraseLine(mode int) {
+	line := sc.lines[sc.row]
+	switch mode {
+	case 0: // cursor to end
+		if sc.col < len(line) {
+			sc.lines[sc.row] = line[:sc.col]
+		}
+	case 1: // start to cursor
+		for i := 0; i <= sc.col && i < len(line); i++ {
+			line[i] = cell{r: ' '}
+		}
+	case 2:
+		sc.lines[sc.row] = nil
+	}
+}
+
+// csi applies a Control Sequence Introducer command (ESC [ params final).
+func (sc *screen) csi(params string, final byte) {
+	args := parseCSIParams(params)
+	n := 1
+	if len(args) > 0 && args[0] > 0 {
+		n = args[0]
+	}
+	switch final {
+	case 'm':
+		sc.sgr.apply(args)
+	case 'K':
+		mode := 0
+		if len(args) > 0 {
+			mode = args[0]
+		}
+		sc.eraseLine(mode)
+	case 'J':
+		// Erase below: drop lines under the cursor (spinners redraw them). Full clears are ignored
+		// so earlier output stays in the log.
+		if len(args) == 0 || args[0] == 0 {
+			sc.eraseLine(0)
+			sc.lines = sc.lines[:sc.row+1]
+		}
+	case 'A', 'F':
+		sc.row -= n
+		if sc.row < 0 {
+			sc.row = 0
+		}
+		if final == 'F' {
+			sc.col = 0
+		}
+	case 'B', 'E':
+		n = min(n, len(sc.lines)-1+cursorDownMargin-sc.row)
+		for i := 0; i < n; i++ {
+			col := sc.col
+			sc.newline()
+			sc.col = col
+		}
+		if final == 'E' {
+			sc.col = 0
+		}
+	case 'C':
+		sc.col = min(sc.col+min(n, maxCursorCol), sc.maxCol())
+	case 'D':
+		sc.col -= n
+		if sc.col < 0 {
+			sc.col = 0
+		}
+	case 'G':
+		sc.col = min(n-1, sc.maxCol())
+	}
+}
+
+// maxCol is the furthest right the cursor can be moved on the current line.
+func (sc *screen) maxCol() int {
+	return max(maxCursorCol, len(sc.lines[sc.row]))
+}
+
+// feed runs text through the screen.
+func (sc *screen) feed(text string) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\n':
+			sc.newline()
+		case '\r':
+			sc.col = 0
+		case '\b':
+			if sc.col > 0 {
+				sc.col--
+			}
+		case '\t':
+			sc.put(' ')
+			for sc.col%8 != 0 {
+				sc.put(' ')
+			}
+		case 0x1b:
+			i = sc.escape(runes, i)
+		default:
+			if r < 0x20 || r == 0x7f {
+				continue // other control characters (bell etc.)
+			}
+			sc.put(r)
+		}
+	}
+}
+
+// escape consumes an escape sequence starting at runes[i] (ESC) and returns the index of its last rune.
+func (sc *screen) escape(runes []rune, i int) int {
+	if i+1 >= len(runes) {
+		return i
+	}
+	switch runes[i+1] {
+	case '[': // CSI
+		j := i + 2
+		for j < len(runes) && (runes[j] < 0x40 || runes[j] > 0x7e) {
+			j++
+		}
+		if j >= len(runes) {
+			return len(runes) - 1
+		}
+		sc.csi(string(runes[i+2:j]), byte(runes[j]))
+		return j
+	case ']': // OSC: terminated by BEL or ESC \
+		for j := i + 2; j < len(runes); j++ {
+			if runes[j] == 0x07 {
+				return j
+			}
+			if runes[j] == 0x1b && j+1 < len(runes) && runes[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(runes) - 1
+	case '(', ')': // charset designation: ESC ( B
+		return i + 2
+	}
+	return i + 1 // two-byte sequences (ESC 7, ESC 8, ESC =, ...)
+}
+
+func parseCSIParams(params string) []int {
+	params = strings.TrimLeft(params, "?<=>")
+	if params == "" {
+		return nil
+	}
+	parts := strings.Split(params, ";")
+	out := make([]int, len(parts))
+	for i, p := range parts {
+		out[i], _ = strconv.Atoi(p)
+	}
+	return out
+}
+
+// renderPlain applies carriage returns, cursor movement and erases, and drops all escape
+// sequences, leaving what a human would have seen on screen.
+func renderPlain(text string) string {
+	sc := newScreen()
+	sc.feed(text)
+	return strings.Join(sc.plainLines(), "\n")
+}
+
+// renderHTML is renderPlain with SGR colors kept as inline-styled spans, wrapped in <pre>.
+func renderHTML(text string) string {
+	sc := newScreen()
+	sc.feed(text)
+	return `<pre class="crux-log">` + strings.Join(sc.htmlLines(), "\n") + "</pre>\n"
+}
+
+// plainLines returns the screen's lines as text, trailing spaces trimmed.
+func (sc *screen) plainLines() []string {
+	out := make([]string, len(sc.lines))
+	for i, line := range sc.lines {
+		var b strings.Builder
+		for _, c := range line {
+			b.WriteRune(c.r)
+		}
+		out[i] = strings.TrimRight(b.String(), " ")
+	}
+	return out
+}
+
+// htmlLines returns the screen's lines as escaped HTML with styled runs in spans.
+func (sc *screen) htmlLines() []string {
+	out := make([]string, len(sc.lines))
+	for i, line := range sc.lines {
+		for len(line) > 0 && line[len(line)-1].r == ' ' && line[len(line)-1].style == "" {
+			line = line[:len(line)-1]
+		}
+		var b strings.Builder
+		for start := 0; start < len(line); {
+			end := start
+			var run strings.Builder
+			for end < len(line) && line[end].style == line[start].style {
+				run.WriteRune(line[end].r)
+				end++
+			}
+			if style := line[start].style; style != "" {
+				b.WriteString(`<span style="` + style + `">` + html.EscapeString(run.String()) + `</span>`)
+			} else {
+				b.WriteString(html.EscapeString(run.String()))
+			}
+			start = end
+		}
+		out[i] = b.String()
+	}
+	return out
+}
+
+// ansiPalette is the standard 16-color palette (normal then bright)
+var ansiPalette = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+// sgrState tracks Select Graphic Rendition attributes
+type sgrState struct {
+	bold, dim, italic, underline bool
+	fg, bg                       string
+}
+
+func (s *sgrState) apply(args []int) {
+	if len(args) == 0 {
+		*s = sgrState{}
+		return
+	}
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == 0:
+			*s = sgrState{}
+		case a == 1:
+			s.bold = true
+		case a == 2:
+			s.dim = true
+		case a == 3:
+			s.italic = true
+		case a == 4:
+			s.underline = true
+		case a == 22:
+			s.bold, s.dim = false, false
+		case a == 23:
+			s.italic = false
+		case a == 24:
+			s.underline = false
+		case a >= 30 && a <= 37:
+			s.fg = ansiPalette[a-30]
+		case a >= 90 && a <= 97:
+			s.fg = ansiPalette[a-90+8]
+		case a == 39:
+			s.fg = ""
+		case a >= 40 && a <= 47:
+			s.bg = ansiPalette[a-40]
+		case a >= 100 && a <= 107:
+			s.bg = ansiPalette[a-100+8]
+		case a == 49:
+			s.bg = ""
+		case a == 38 || a == 48:
+			color, used := extendedColor(args[i+1:])
+			i += used
+			if a == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+}
+
+// extendedColor parses the tail of a 38/48 sequence (5;n or 2;r;g;b), returning the color and args consumed.
+func extendedColor(args []int) (string, int) {
+	if len(args) >= 2 && args[0] == 5 {
+		n := args[1]
+		switch {
+		case n < 0 || n > 255:
+			return "", 2 // not a palette index: no color
+		case n < 16:
+			return ansiPalette[n], 2
+		case n < 232:
+			n -= 16
+			scale := func(v int) int {
+				if v == 0 {
+					return 0
+				}
+				return 55 + v*40
+			}
+			return fmt.Sprintf("#%02x%02x%02x", scale(n/36), scale(n/6%6), scale(n%6)), 2
+		default:
+			g := 8 + (n-232)*10
+			return fmt.Sprintf("#%02x%02x%02x", g, g, g), 2
+		}
+	}
+	if len(args) >= 4 && args[0] == 2 {
+		return fmt.Sprintf("#%02x%02x%02x", args[1]&0xff, args[2]&0xff, args[3]&0xff), 4
+	}
+	return "", len(args)
+}
+
+func (s sgrState) css() string {
+	var parts []string
+	if s.fg != "" {
+		parts = append(parts, "color:"+s.fg)
+	}
+	if s.bg != "" {
+		parts = append(parts, "background:"+s.bg)
+	}
+	if s.bold {
+		parts = append(parts, "font-weight:bold")
+	}
+	if s.dim {
+		parts = append(parts, "opacity:.7")
+	}
+	if s.italic {
+		parts = append(parts, "font-style:italic")
+	}
+	if s.underline {
+		parts = append(parts, "text-decoration:underline")
+	}
+	return strings.Join(parts, ";")
+}
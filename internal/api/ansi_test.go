@@ -0,0 +1,56 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPlain(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"colors stripped", "\x1b[32mok\x1b[0m done", "ok done"},
+		{"carriage return progress", "Downloading 10%\rDownloading 55%\rDownloading 100%\nnext", "Downloading 100%\nnext"},
+		{"crlf line endings", "a\r\nb\r\n", "a\nb\n"},
+		{"erase line", "building...\r\x1b[Kbuilt\n", "built\n"},
+		{"cursor up redraw", "step 1/3\nstep 2/3\n\x1b[1A\x1b[2K\x1b[Gstep 3/3\n", "step 1/3\nstep 3/3\n"},
+		{"osc title dropped", "\x1b]0;vite\x07ready", "ready"},
+		{"backspace", "spin|\b/\b-", "spin-"},
+		{"trailing spaces trimmed", "x   \n", "x\n"},
+		{"256 and truecolor", "\x1b[38;5;196mred\x1b[38;2;1;2;3m rgb\x1b[m", "red rgb"},
+		{"palette index out of range", "\x1b[38;5;-3ma\x1b[48;5;999mb", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderPlain(tt.in); got != tt.want {
+				t.Errorf("renderPlain(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderCursorLimits(t *testing.T) {
+	got := renderPlain("a\x1b[999999999Cb\x1b[99999999Bc\x1b[999999999Gd")
+	lines := strings.Split(got, "\n")
+	if len(lines) != 2 || lines[0] != "a"+strings.Repeat(" ", maxCursorCol-1)+"b" || lines[1] != strings.Repeat(" ", maxCursorCol+1)+"cd" {
+		t.Errorf("renderPlain = %d lines of %v", len(lines), len(got))
+	}
+	// A line that is already long is not cut back by ESC[G
+	long := strings.Repeat("x", 2*maxCursorCol)
+	if got := renderPlain(long + "\x1b[99999Gy"); got != long+"y" {
+		t.Errorf("long line: got %d chars", len(got))
+	}
+	if got := renderHTML("\x1b[38;5;-3mx"); got != `<pre class="crux-log">x</pre>`+"\n" {
+		t.Errorf("renderHTML negative index = %q", got)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	got := renderHTML("\x1b[1;31mERR\x1b[0m <tag> & co\rX")
+	want := `<pre class="crux-log">` + `X<span style="color:#cd3131;font-weight:bold">RR</span> &lt;tag&gt; &amp; co</pre>` + "\n"
+	if got != want {
+		t.Errorf("renderHTML = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHost is the interface the API binds to unless api.host says otherwise
+const DefaultHost = "127.0.0.1"
+
+// TokenPath returns where the session token for the API on port is stored:
+// ~/.crux/api-<port>.token (readable only by the user).
+func TokenPath(port int) string {
+	dir := os.TempDir()
+	if home, err := os.UserHomeDir(); err == nil {
+		dir = filepath.Join(home, ".crux")
+	}
+	return filepath.Join(dir, fmt.Sprintf("api-%d.token", port))
+}
+
+// GenerateToken returns a random 256-bit token, hex encoded.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WriteTokenFile stores token at path with mode 0600 (directory 0700), replacing any old token.
+func WriteTokenFile(path, token string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(token + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadTokenFile reads a token written by WriteTokenFile.
+func ReadTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetListen sets the TCP bind host (default 127.0.0.1) and an optional Unix socket path.
+// Requests over the socket skip token auth; the socket file is only accessible to the user.
+func (s *Server) SetListen(host, socketPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if host == "" {
+		host = DefaultHost
+	}
+	s.host = host
+	s.socketPath = socketPath
+}
+
+// SetToken requires every TCP request (except /health and /openapi.yaml) to carry the token as
+// "Authorization: Bearer <token>" or X-Crux-Token. ?token= is accepted only on GET /events, for
+// EventSource clients that can't set headers, so the token stays out of other URLs and logs.
+// An empty token disables auth.
+func (s *Server) SetToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// requireToken wraps the API handler with token auth.
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		token := s.token
+		s.mu.RUnlock()
+		if token == "" || r.URL.Path == "/health" || r.URL.Path == "/openapi.yaml" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		got := r.Header.Get("X-Crux-Token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if got == "" && r.Method == http.MethodGet && r.URL.Path == "/events" {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="crux"`)
+			http.Error(w, fmt.Sprintf("Unauthorized: send the token from %s as 'Authorization: Bearer <token>'", TokenPath(s.port)), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	s := NewServer(9876)
+	s.SetToken("secret-token")
+	h := s.requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{"no token", "GET", "/tabs", "", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/tabs", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"bearer", "GET", "/tabs", "Authorization", "Bearer secret-token", http.StatusOK},
+		{"header", "GET", "/tabs", "X-Crux-Token", "secret-token", http.StatusOK},
+		{"query on the event stream", "GET", "/events?token=secret-token", "", "", http.StatusOK},
+		{"query elsewhere", "GET", "/tabs?token=secret-token", "", "", http.StatusUnauthorized},
+		{"query on a POST", "POST", "/events?token=secret-token", "", "", http.StatusUnauthorized},
+		{"health is open", "GET", "/health", "", "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.header != "" {
+			r.Header.Set(tc.header, tc.value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestWriteTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crux", "api-9876.token")
+	if err := WriteTokenFile(path, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file mode %o, want 600", perm)
+	}
+	if got, _ := ReadTokenFile(path); got != "abc" {
+		t.Errorf("ReadTokenFile = %q, want abc", got)
+	}
+}
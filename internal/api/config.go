@@ -0,0 +1,686 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigReloader checks config file contents for this session (parse, defaults, validation).
+// With apply it also makes them the session's config, so later starts and restarts use the new
+// service definitions.
+type ConfigReloader func(data []byte, apply bool) error
+
+// ConfigChangeResponse is the response for PUT and DELETE /config/services/<name>
+type ConfigChangeResponse struct {
+	CommandResponse
+	Config  string           `json:"config,omitempty"`  // the service's entry as written (secrets masked)
+	Applied bool             `json:"applied"`           // the running session picked up the change
+	Restart *RestartResponse `json:"restart,omitempty"` // with apply on PUT: restarting the service
+	Stopped string           `json:"stopped,omitempty"` // with apply on DELETE: how the service was stopped
+}
+
+// serviceKeyOrder is where keys of a new service entry go; unknown keys follow sorted.
+var serviceKeyOrder = []string{"name", "command", "args", "workdir", "interactive", "env", "ports", "groups"}
+
+// SetConfigPath tells the server which config file the session was started from, so
+// GET /config can serve it.
+func (s *Server) SetConfigPath(path string) {
+	s.mu.Lock()
+	s.configPath = path
+	s.mu.Unlock()
+	// The session was started from what the file holds now
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	if data, err := os.ReadFile(path); err == nil {
+		s.configSeen.sum = sha256.Sum256(data)
+	}
+	if info, err := os.Stat(path); err == nil {
+		s.configSeen.mod, s.configSeen.size = info.ModTime(), info.Size()
+	}
+}
+
+// configPollInterval is how often watchConfig looks at the config file
+const configPollInterval = 2 * time.Second
+
+// configFileState identifies the config file content the session last loaded or wrote.
+type configFileState struct {
+	mod  time.Time
+	size int64
+	sum  [sha256.Size]byte
+}
+
+// watchConfig applies edits made to the config file by hand, like an applied API edit but
+// without restarting anything: service definitions, tasks, actions and exec.allow are
+// replaced, and running services pick up their new definition when they next restart.
+func (s *Server) watchConfig(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.checkConfigFile()
+		}
+	}
+}
+
+// checkConfigFile reloads the config file if its content changed since the session last loaded
+// or wrote it, and publishes config.reloaded. It reports whether it reloaded.
+func (s *Server) checkConfigFile() bool {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.mu.RLock()
+	path, reload := s.configPath, s.configReloader
+	s.mu.RUnlock()
+	if path == "" || reload == nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.ModTime().Equal(s.configSeen.mod) && info.Size() == s.configSeen.size {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	s.configSeen.mod, s.configSeen.size = info.ModTime(), info.Size()
+	sum := sha256.Sum256(data)
+	if sum == s.configSeen.sum {
+		return false // touched, or rewritten with the same content
+	}
+	s.configSeen.sum = sum
+	// An invalid edit is reported once and left alone; the next save is checked again
+	if err := reload(data, true); err != nil {
+		fmt.Printf("⚠️  %s changed but was not applied: %v\n", filepath.Base(path), err)
+		return false
+	}
+	fmt.Printf("🔄 %s changed: reloaded service definitions\n", filepath.Base(path))
+	s.events.Publish(EventConfigReloaded, "", map[string]interface{}{"file": filepath.Base(path)})
+	return true
+}
+
+// SetConfigReloader sets the validation and reload hook for config edits. Without one, edits are
+// only checked to be valid YAML and can't be applied.
+func (s *Server) SetConfigReloader(fn ConfigReloader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configReloader = fn
+}
+
+// readConfig returns the session's config file.
+func (s *Server) readConfig() (path string, data []byte, err error) {
+	s.mu.RLock()
+	path = s.configPath
+	s.mu.RUnlock()
+	if path == "" {
+		return "", nil, errNoConfig
+	}
+	data, err = os.ReadFile(path)
+	return path, data, err
+}
+
+// parseConfigNode parses a config file, keeping comments.
+func parseConfigNode(path string, data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: not a YAML mapping", path)
+	}
+	return &doc, nil
+}
+
+// mappingValue returns the value node of key in a mapping node (nil if absent).
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+// mappingIndex returns the index of key's key node in m.Content (-1 if absent).
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// servicesNode returns the services: sequence, adding an empty one when create is set.
+func servicesNode(doc *yaml.Node, create bool) *yaml.Node {
+	root := doc.Content[0]
+	if services := mappingValue(root, "services"); services != nil && services.Kind == yaml.SequenceNode {
+		return services
+	}
+	if !create || mappingValue(root, "services") != nil {
+		return nil
+	}
+	services := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "services"}, services)
+	return services
+}
+
+// serviceIndex returns the position of the entry of services: whose name is name (-1 if none).
+func serviceIndex(services *yaml.Node, name string) int {
+	if services == nil {
+		return -1
+	}
+	for i, item := range services.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if n := mappingValue(item, "name"); n != nil && n.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// serviceNode returns the entry of services: whose name is name (nil if there is none).
+func serviceNode(doc *yaml.Node, name string) *yaml.Node {
+	services := servicesNode(doc, false)
+	if i := serviceIndex(services, name); i >= 0 {
+		return services.Content[i]
+	}
+	return nil
+}
+
+func encodeYAML(node *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	enc.Close()
+	return buf.String(), nil
+}
+
+// serviceSnippet renders one service entry as a one-item list, so it pastes back under
+// services: unchanged.
+func serviceSnippet(item *yaml.Node) (string, error) {
+	return encodeYAML(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}})
+}
+
+// yamlValue converts a decoded JSON value for encoding: json.Number becomes an int or float so
+// ports stay 8080 rather than "8080" or 8.08e+03.
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = yamlValue(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlValue(e)
+		}
+	}
+	return v
+}
+
+func sameYAML(a, b *yaml.Node) bool {
+	x, errA := yaml.Marshal(a)
+	y, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
+
+// restoreMasked puts back secrets a client copied from masked GET /config output: a value that
+// is exactly what the redactor makes of the value at the same place in the file is unchanged.
+func restoreMasked(n, old *yaml.Node, red *Redactor, path string) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, redactMask) {
+			return nil
+		}
+		if old != nil && old.Kind == yaml.ScalarNode && old.Value != n.Value && red.Redact(old.Value) == n.Value {
+			n.Value, n.Style, n.Tag = old.Value, old.Style, old.Tag
+			return nil
+		}
+		return fmt.Errorf("%s is masked (%s); send the real value or leave the key unchanged", path, redactMask)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			var prev *yaml.Node
+			if old != nil && old.Kind == yaml.MappingNode {
+				prev = mappingValue(old, n.Content[i].Value)
+			}
+			if err := restoreMasked(n.Content[i+1], prev, red, path+"."+n.Content[i].Value); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, e := range n.Content {
+			var prev *yaml.Node
+			if old != nil && old.Kind == yaml.SequenceNode && i < len(old.Content) {
+				prev = old.Content[i]
+			}
+			if err := restoreMasked(e, prev, red, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buildServiceNode turns the fields of a PUT body into the service's new entry. Keys that stay
+// keep their position and comments (and their node, if the value is unchanged); new keys follow.
+func buildServiceNode(name string, fields map[string]interface{}, old *yaml.Node, red *Redactor) (*yaml.Node, error) {
+	if n, ok := fields["name"]; ok && n != name {
+		return nil, fmt.Errorf("name %v doesn't match the service in the path (%s)", n, name)
+	}
+	fields["name"] = name
+	if cmd, _ := fields["command"].(string); strings.TrimSpace(cmd) == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	rank := func(k string) int {
+		if old != nil {
+			if i := mappingIndex(old, k); i >= 0 {
+				return i - len(old.Content) // keys already in the entry come first, in file order
+			}
+		}
+		for i, o := range serviceKeyOrder {
+			if o == k {
+				return i
+			}
+		}
+		return len(serviceKeyOrder)
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := rank(keys[i]), rank(keys[j]); ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	item := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if old != nil {
+		item.HeadComment, item.LineComment, item.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	}
+	for _, k := range keys {
+		value := &yaml.Node{}
+		if err := value.Encode(yamlValue(fields[k])); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
+		var prev *yaml.Node
+		if old != nil {
+			if i := mappingIndex(old, k); i >= 0 {
+				key, prev = old.Content[i], old.Content[i+1]
+			}
+		}
+		if err := restoreMasked(value, prev, red, k); err != nil {
+			return nil, err
+		}
+		switch {
+		case prev != nil && sameYAML(value, prev):
+			value = prev
+		case prev != nil:
+			value.LineComment = prev.LineComment
+			if prev.Kind == value.Kind {
+				value.Style |= prev.Style & yaml.FlowStyle // ports: [8080] stays on one line
+			}
+		}
+		item.Content = append(item.Content, key, value)
+	}
+	return item, nil
+}
+
+// serviceCommands are the parts of a service entry that crux runs as commands.
+type serviceCommands struct {
+	Command     string            `yaml:"command"`
+	Args        []interface{}     `yaml:"args"`
+	StopCommand string            `yaml:"stop_command"`
+	WorkDir     string            `yaml:"workdir"`
+	Env         map[string]string `yaml:"env"`
+	Actions     map[string]struct {
+		Exec string `yaml:"exec"`
+	} `yaml:"actions"`
+}
+
+func (c serviceCommands) argv() []string {
+	argv := []string{c.Command}
+	for _, a := range c.Args {
+		argv = append(argv, fmt.Sprint(a))
+	}
+	return argv
+}
+
+// checkNewCommands rejects an entry that adds or changes a command (command and args,
+// stop_command, exec actions) exec.allow doesn't cover, so editing the config over the API can't
+// run what POST /exec may not. Commands already in the file were written by hand and are trusted.
+// env and workdir change what an allowed command runs (PATH, LD_PRELOAD, a relative ./run.sh),
+// so changing them counts as changing the command line.
+func checkNewCommands(allow []string, item, old *yaml.Node) error {
+	var next, prev serviceCommands
+	if err := item.Decode(&next); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Decode(&prev)
+	}
+	denied := func(what, line string) error {
+		if len(allow) == 0 {
+			return fmt.Errorf("%w: %s %q: commands set over the API must match exec.allow, which is empty (edit config.yaml by hand instead)", errExecDenied, what, line)
+		}
+		return fmt.Errorf("%w: %s %q matches no exec.allow entry (%s)", errExecDenied, what, line, strings.Join(allow, ", "))
+	}
+	if argv := next.argv(); !slices.Equal(argv, prev.argv()) && !execAllowed(allow, argv) {
+		return denied("command", strings.Join(argv, " "))
+	}
+	// stop_command runs through sh -c, where anything can follow an allowed prefix: only the
+	// "*" entry (the one entry a lone "*" matches) covers it, as it does env and workdir
+	anything := execAllowed(allow, []string{"*"})
+	if next.StopCommand != "" && next.StopCommand != prev.StopCommand && !anything {
+		return fmt.Errorf("%w: stop_command %q runs through the shell; setting it over the API needs exec.allow: [\"*\"]", errExecDenied, next.StopCommand)
+	}
+	if next.WorkDir != prev.WorkDir && !anything {
+		return fmt.Errorf("%w: workdir %q changes what the service's commands run; changing it over the API needs exec.allow: [\"*\"]", errExecDenied, next.WorkDir)
+	}
+	keys := make([]string, 0, len(next.Env))
+	for key := range next.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if val, ok := prev.Env[key]; (!ok || val != next.Env[key]) && !anything {
+			return fmt.Errorf("%w: env %s changes what the service's commands run; setting it over the API needs exec.allow: [\"*\"]", errExecDenied, key)
+		}
+	}
+	names := make([]string, 0, len(next.Actions))
+	for name := range next.Actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line := next.Actions[name].Exec
+		if line == "" || line == prev.Actions[name].Exec {
+			continue
+		}
+		if argv, err := SplitCommandLine(line); err != nil || !execAllowed(allow, argv) {
+			return denied("action "+name+" exec", line)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data via a temp file in the same directory, keeping the
+// file mode, so a crash or a concurrent reader never sees half a config.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ConfigSetService adds or replaces a service's entry in the config file. fields is the whole
+// entry (as from JSON); comments on keys that stay are preserved. With apply the session reloads
+// the config and restarts the service (or starts it, if new).
+func (s *Server) ConfigSetService(name string, fields map[string]interface{}, apply bool) (ConfigChangeResponse, error) {
+	return s.editConfig(name, apply, func(doc *yaml.Node) (*yaml.Node, error) {
+		s.mu.RLock()
+		red := s.redactor
+		allow := s.execAllow
+		s.mu.RUnlock()
+		services := servicesNode(doc, true)
+		if services == nil {
+			return nil, fmt.Errorf("services: in the config is not a list")
+		}
+		i := serviceIndex(services, name)
+		var old *yaml.Node
+		if i >= 0 {
+			old = services.Content[i]
+		}
+		item, err := buildServiceNode(name, fields, old, red)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkNewCommands(allow, item, old); err != nil {
+			return nil, err
+		}
+		if i >= 0 {
+			services.Content[i] = item
+		} else {
+			services.Content = append(services.Content, item)
+		}
+		return item, nil
+	})
+}
+
+// ConfigRemoveService deletes a service's entry from the config file. With apply the service is
+// stopped and its tab closed first, then the session reloads the config.
+func (s *Server) ConfigRemoveService(name string, apply bool) (ConfigChangeResponse, error) {
+	return s.editConfig(name, apply, func(doc *yaml.Node) (*yaml.Node, error) {
+		services := servicesNode(doc, false)
+		i := serviceIndex(services, name)
+		if i < 0 {
+			return nil, errServiceNotInConfig
+		}
+		services.Content = append(services.Content[:i], services.Content[i+1:]...)
+		return nil, nil
+	})
+}
+
+// Errors of config edits that map to HTTP statuses other than 400
+var (
+	errNoConfig           = errors.New("no config file for this session")
+	errServiceNotInConfig = errors.New("service not found in config")
+	errConfigWrite        = errors.New("failed to write")
+)
+
+// editConfig applies edit to the parsed config, validates and writes the result, and with apply
+// hands it to the session. edit returns the service's new entry (nil when it was removed).
+func (s *Server) editConfig(name string, apply bool, edit func(doc *yaml.Node) (*yaml.Node, error)) (ConfigChangeResponse, error) {
+	resp := ConfigChangeResponse{CommandResponse: CommandResponse{Service: name}}
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.mu.RLock()
+	reload := s.configReloader
+	s.mu.RUnlock()
+	if apply && reload == nil {
+		return resp, fmt.Errorf("apply not available (crux must be running with wezterm)")
+	}
+
+	path, data, err := s.readConfig()
+	if err != nil {
+		return resp, err
+	}
+	doc, err := parseConfigNode(path, data)
+	if err != nil {
+		return resp, err
+	}
+	item, err := edit(doc)
+	if err != nil {
+		return resp, err
+	}
+	out, err := encodeYAML(doc)
+	if err != nil {
+		return resp, err
+	}
+	if reload != nil {
+		if err := reload([]byte(out), false); err != nil {
+			return resp, fmt.Errorf("invalid config: %v", err)
+		}
+	}
+	if err := writeFileAtomic(path, []byte(out)); err != nil {
+		return resp, fmt.Errorf("%w %s: %v", errConfigWrite, path, err)
+	}
+	// Not a hand edit: watchConfig leaves it to apply (a save without apply stays unapplied)
+	s.configSeen.sum = sha256.Sum256([]byte(out))
+	if info, err := os.Stat(path); err == nil {
+		s.configSeen.mod, s.configSeen.size = info.ModTime(), info.Size()
+	}
+
+	resp.Success = true
+	if item != nil {
+		resp.Config, _ = serviceSnippet(item)
+		resp.Message = fmt.Sprintf("Saved %s in %s", name, filepath.Base(path))
+	} else {
+		resp.Message = fmt.Sprintf("Removed %s from %s", name, filepath.Base(path))
+	}
+	if !apply {
+		return resp, nil
+	}
+
+	lock := s.serviceLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	if item == nil {
+		// Stop while the old definition (stop policy) is still loaded
+		if st, ok := s.serviceStatus(name); ok && st.HasTab {
+			if resp.Stopped, err = s.StopService(name); err != nil {
+				resp.Success = false
+				resp.Message += "; stop failed: " + err.Error()
+				return resp, nil
+			}
+		}
+	}
+	if err := reload([]byte(out), true); err != nil {
+		resp.Success = false
+		resp.Message += "; reload failed: " + err.Error()
+		return resp, nil
+	}
+	resp.Applied = true
+	s.events.Publish(EventConfigReloaded, name, map[string]interface{}{"file": filepath.Base(path)})
+	if item != nil {
+		restart := s.restartLocked(name, 0)
+		resp.Restart = &restart
+		resp.Message += "; " + restart.Message
+		resp.Success = restart.Success
+	} else if resp.Stopped != "" {
+		resp.Message += "; stopped: " + resp.Stopped
+	}
+	return resp, nil
+}
+
+// handleConfig serves the session's config (GET /config) or one service's entry
+// (GET /config/services/<name>) as YAML with comments, secrets masked. PUT and DELETE on
+// /config/services/<name> edit the entry; ?apply=true also applies it to the running session.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/config"), "/")
+	name, isService := strings.CutPrefix(rest, "services/")
+	if rest != "" && (!isService || name == "" || strings.Contains(name, "/")) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet:
+	case (r.Method == http.MethodPut || r.Method == http.MethodDelete) && isService:
+		s.handleConfigEdit(w, r, name)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, data, err := s.readConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	out := string(data)
+	if isService {
+		doc, err := parseConfigNode(path, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		item := serviceNode(doc, name)
+		if item == nil {
+			http.Error(w, fmt.Sprintf("service %q not found in config", name), http.StatusNotFound)
+			return
+		}
+		if out, err = serviceSnippet(item); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write([]byte(s.redactFor(r).Redact(out)))
+}
+
+func (s *Server) handleConfigEdit(w http.ResponseWriter, r *http.Request, name string) {
+	apply, _ := strconv.ParseBool(r.URL.Query().Get("apply"))
+	var resp ConfigChangeResponse
+	var err error
+	if r.Method == http.MethodPut {
+		var fields map[string]interface{}
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil || fields == nil {
+			http.Error(w, "Body must be a JSON object with the service's fields", http.StatusBadRequest)
+			return
+		}
+		resp, err = s.ConfigSetService(name, fields, apply)
+	} else {
+		resp, err = s.ConfigRemoveService(name, apply)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, errServiceNotInConfig):
+			status = http.StatusNotFound
+			err = fmt.Errorf("service %q not found in config", name)
+		case errors.Is(err, errNoConfig) || errors.Is(err, fs.ErrNotExist):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, errConfigWrite):
+			status = http.StatusInternalServerError
+		case errors.Is(err, errExecDenied):
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	red := s.redactFor(r)
+	resp.Config = red.Redact(resp.Config)
+	resp.Message = red.Redact(resp.Message)
+	if resp.Restart != nil {
+		resp.Restart.redact(red)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
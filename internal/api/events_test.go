@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBus_ReplayAndRing(t *testing.T) {
+	b := NewEventBus()
+	for i := 0; i < eventBufferSize+5; i++ {
+		b.Publish(EventInputSent, "backend", nil)
+	}
+	if got := b.LastID(); got != eventBufferSize+5 {
+		t.Fatalf("LastID = %d, want %d", got, eventBufferSize+5)
+	}
+	all := b.Since(0)
+	if len(all) != eventBufferSize || all[0].ID != 6 {
+		t.Fatalf("ring holds %d events starting at %d, want %d starting at 6", len(all), all[0].ID, eventBufferSize)
+	}
+	if got := b.Since(eventBufferSize + 3); len(got) != 2 {
+		t.Fatalf("Since(last-2) returned %d events, want 2", len(got))
+	}
+}
+
+func TestEventBus_SubscribeGetsNewEvents(t *testing.T) {
+	b := NewEventBus()
+	b.Publish(EventServiceSpawned, "backend", nil)
+	replay, ch, cancel := b.Subscribe(0)
+	defer cancel()
+	if len(replay) != 1 {
+		t.Fatalf("replay = %d events, want 1", len(replay))
+	}
+	b.Publish(EventServiceReady, "backend", nil)
+	select {
+	case ev := <-ch:
+		if ev.Type != EventServiceReady || ev.ID != 2 {
+			t.Fatalf("got %+v, want service.ready id 2", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+	}
+}
+
+func TestHandleEvents_ResumeAndFilter(t *testing.T) {
+	s := NewServer(0)
+	s.events.Publish(EventServiceSpawned, "backend", nil)
+	s.events.Publish(EventInputSent, "backend", nil)
+	s.events.Publish(EventServiceReady, "web", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/events?since=0&types=service.*", nil).WithContext(ctx)
+	r.Header.Set("Last-Event-ID", "99") // ?since wins
+	w := httptest.NewRecorder()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	s.handleEvents(w, r)
+
+	var ids []string
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	if strings.Join(ids, ",") != "1,3" {
+		t.Fatalf("streamed ids %v, want [1 3]\n%s", ids, w.Body.String())
+	}
+}
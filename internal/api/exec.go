@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout bounds POST /exec unless the request or exec.timeout says otherwise
+const DefaultExecTimeout = 60 * time.Second
+
+// maxExecTimeout caps the timeout a request may ask for
+const maxExecTimeout = 10 * time.Minute
+
+// ExecRequest is the body of POST /exec/<service>.
+type ExecRequest struct {
+	Command string `json:"command"`           // command line, split like a shell would but never run by one
+	Timeout string `json:"timeout,omitempty"` // e.g. "30s" (default exec.timeout, else 60s; max 10m)
+}
+
+// ExecResponse is the outcome of POST /exec/<service>.
+type ExecResponse struct {
+	Service   string `json:"service"`
+	Command   string `json:"command"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message,omitempty"` // why it did not run or did not finish
+	ExitCode  int    `json:"exit_code"`         // -1 when the command could not start or was killed
+	RunID     string `json:"run_id,omitempty"`
+	LogPath   string `json:"log_path,omitempty"`
+	Duration  string `json:"duration"`
+	Output    string `json:"output"`              // stdout and stderr as interleaved by the command (tail when truncated)
+	Truncated bool   `json:"truncated,omitempty"` // output is the last 32KB only
+}
+
+// ExecLogName is the directory under /tmp/crux-logs exec runs for a service log to.
+func ExecLogName(service string) string {
+	return "exec-" + service
+}
+
+// errExecDenied marks commands the allowlist doesn't cover (403)
+var errExecDenied = errors.New("command not allowed")
+
+// SetExecPolicy sets the commands POST /exec may run, and config edits may add: each entry allows
+// command lines that start with its words ("go test", "npm run lint"); "*" allows any. Without
+// entries exec is off.
+func (s *Server) SetExecPolicy(allow []string, timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.execAllow = allow
+	s.execTimeout = timeout
+}
+
+// execAllowed reports whether argv starts with the words of an allowlist entry.
+func execAllowed(allow []string, argv []string) bool {
+	for _, entry := range allow {
+		words, err := SplitCommandLine(entry)
+		if err != nil || len(words) == 0 || len(words) > len(argv) {
+			continue
+		}
+		if len(words) == 1 && words[0] == "*" {
+			return true
+		}
+		match := true
+		for i, w := range words {
+			if argv[i] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitCommandLine splits a command line into words the way sh does for plain words, single
+// and double quotes and backslash escapes. Operators (;, |, &&, $(...)) have no meaning: there
+// is no shell, so they end up as literal arguments.
+func SplitCommandLine(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", line)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// Exec runs a one-off command in a service's workdir with its environment, without touching
+// the service's tab. The run is logged to /tmp/crux-logs/exec-<service>/ and published as
+// exec.finished.
+func (s *Server) Exec(ctx context.Context, service string, req ExecRequest) (ExecResponse, error) {
+	s.mu.RLock()
+	spec, known := s.specFor(service)
+	allow := s.execAllow
+	timeout := s.execTimeout
+	s.mu.RUnlock()
+	if !known {
+		return ExecResponse{}, fmt.Errorf("%w: %s", errServiceNotInConfig, service)
+	}
+	if len(allow) == 0 {
+		return ExecResponse{}, fmt.Errorf("%w: exec is off (list allowed commands under exec.allow in config.yaml)", errExecDenied)
+	}
+	argv, err := SplitCommandLine(req.Command)
+	if err != nil {
+		return ExecResponse{}, err
+	}
+	if len(argv) == 0 {
+		return ExecResponse{}, fmt.Errorf("command required")
+	}
+	if !execAllowed(allow, argv) {
+		return ExecResponse{}, fmt.Errorf("%w: %q matches no exec.allow entry (%s)", errExecDenied, req.Command, strings.Join(allow, ", "))
+	}
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return ExecResponse{}, fmt.Errorf("invalid timeout %q (use e.g. 30s or 2m)", req.Timeout)
+		}
+		timeout = min(d, maxExecTimeout)
+	}
+
+	return s.execIn(ctx, spec, req.Command, argv, timeout), nil
+}
+
+// execIn runs argv for a service (POST /exec and exec actions) and publishes exec.finished.
+func (s *Server) execIn(ctx context.Context, spec ServiceSpec, command string, argv []string, timeout time.Duration) ExecResponse {
+	// One run per service at a time, so run ids (and logs) don't collide
+	lock := s.serviceLock("exec:" + spec.Name)
+	lock.Lock()
+	defer lock.Unlock()
+	res := RunTask(ctx, TaskSpec{
+		Name:    spec.Name + " (exec)",
+		Command: argv[0],
+		Args:    argv[1:],
+		WorkDir: spec.WorkDir,
+		Env:     spec.Env,
+		Timeout: timeout,
+		LogName: ExecLogName(spec.Name),
+	}, nil)
+	data := map[string]interface{}{"command": command, "exit_code": res.ExitCode, "run_id": res.RunID, "duration": res.Duration}
+	if res.Message != "" {
+		data["message"] = res.Message
+	}
+	s.events.Publish(EventExecFinished, spec.Name, data)
+	return ExecResponse{
+		Service:   spec.Name,
+		Command:   command,
+		Success:   res.Success,
+		Message:   res.Message,
+		ExitCode:  res.ExitCode,
+		RunID:     res.RunID,
+		LogPath:   res.LogPath,
+		Duration:  res.Duration,
+		Output:    res.Output,
+		Truncated: res.Truncated,
+	}
+}
+
+// handleExec runs an allowed command in a service's context (POST /exec/<service>).
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	service := strings.TrimPrefix(r.URL.Path, "/exec/")
+	if service == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := s.Exec(r.Context(), service, req)
+	switch {
+	case errors.Is(err, errExecDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errServiceNotInConfig):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	red := s.redactFor(r)
+	resp.Output = red.Redact(resp.Output)
+	resp.Message = red.Redact(resp.Message)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
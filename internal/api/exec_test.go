@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"go test ./...", []string{"go", "test", "./..."}},
+		{`  psql -c "select 1; drop table x"  `, []string{"psql", "-c", "select 1; drop table x"}},
+		{`echo 'it''s' a\ b ""`, []string{"echo", "its", "a b", ""}},
+		{"ls; rm -rf /", []string{"ls;", "rm", "-rf", "/"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitCommandLine(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitCommandLine(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := SplitCommandLine(`echo "open`); err == nil {
+		t.Error("unterminated quote accepted")
+	}
+}
+
+func TestExecAllowed(t *testing.T) {
+	allow := []string{"go test", "npm run lint", "psql"}
+	for _, line := range []string{"go test ./...", "npm run lint", "psql -c 'select 1'"} {
+		argv, _ := SplitCommandLine(line)
+		if !execAllowed(allow, argv) {
+			t.Errorf("%q denied", line)
+		}
+	}
+	for _, line := range []string{"go build", "npm run", "npm run lint-fix", "rm -rf /", "gotest"} {
+		argv, _ := SplitCommandLine(line)
+		if execAllowed(allow, argv) {
+			t.Errorf("%q allowed", line)
+		}
+	}
+	if !execAllowed([]string{"*"}, []string{"anything"}) {
+		t.Error(`"*" should allow any command`)
+	}
+}
+
+func TestExec(t *testing.T) {
+	workDir := t.TempDir()
+	s := NewServer(0)
+	s.SetServices([]ServiceSpec{{Name: "crux-test-exec", WorkDir: workDir, Env: []string{"WHO=exec", "DB_PASSWORD=hunter2"}}})
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(logBaseDir, ExecLogName("crux-test-exec"))) })
+	redactor, _ := NewRedactor(nil, []string{"hunter2"})
+	s.SetRedactor(redactor, false)
+
+	post := func(service string, req ExecRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/exec/"+service, bytes.NewReader(body)))
+		return w
+	}
+
+	if w := post("crux-test-exec", ExecRequest{Command: "pwd"}); w.Code != http.StatusForbidden {
+		t.Fatalf("exec without allowlist: %d %s", w.Code, w.Body)
+	}
+	s.SetExecPolicy([]string{"sh -c"}, 0)
+	if w := post("crux-test-exec", ExecRequest{Command: "pwd"}); w.Code != http.StatusForbidden {
+		t.Fatalf("pwd not in allowlist: %d %s", w.Code, w.Body)
+	}
+	if w := post("nope", ExecRequest{Command: "sh -c true"}); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown service: %d %s", w.Code, w.Body)
+	}
+
+	w := post("crux-test-exec", ExecRequest{Command: `sh -c 'echo "$WHO $DB_PASSWORD"; pwd; exit 2'`})
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec: %d %s", w.Code, w.Body)
+	}
+	var resp ExecResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Success || resp.ExitCode != 2 || resp.RunID == "" {
+		t.Errorf("response = %+v, want exit code 2", resp)
+	}
+	dir, _ := filepath.EvalSymlinks(workDir)
+	if want := "exec ****\n" + dir + "\n"; resp.Output != want {
+		t.Errorf("output = %q, want %q", resp.Output, want)
+	}
+	if data, err := os.ReadFile(resp.LogPath); err != nil || !strings.Contains(string(data), "Command: sh -c") {
+		t.Errorf("log %s: %v\n%s", resp.LogPath, err, data)
+	}
+	if evs := s.events.Since(0); len(evs) == 0 || evs[len(evs)-1].Type != EventExecFinished {
+		t.Errorf("events = %+v, want exec.finished", evs)
+	}
+
+	if _, err := s.Exec(t.Context(), "crux-test-exec", ExecRequest{Command: "sh -c true", Timeout: "soon"}); err == nil || errors.Is(err, errExecDenied) {
+		t.Errorf("invalid timeout: %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field names used by common structured loggers (zap, logrus, slog, pino, structlog)
+var (
+	jsonLevelKeys = []string{"level", "lvl", "severity", "log.level", "levelname"}
+	jsonMsgKeys   = []string{"msg", "message", "event"}
+	jsonTimeKeys  = []string{"time", "ts", "timestamp", "@timestamp", "t"}
+)
+
+// jsonLevelRanks orders level names; pino's numeric levels are mapped in levelRank.
+var jsonLevelRanks = map[string]int{
+	"trace": 0, "debug": 1, "info": 2, "notice": 2,
+	"warn": 3, "warning": 3,
+	"error": 4, "err": 4,
+	"fatal": 5, "panic": 5, "dpanic": 5, "critical": 5, "crit": 5, "alert": 5, "emergency": 5,
+}
+
+// JSONLogRecord is one parsed JSON log line
+type JSONLogRecord struct {
+	Fields map[string]interface{}
+}
+
+// parseJSONLogLine returns the record for a JSON object line, or false for anything else.
+func parseJSONLogLine(line string) (*JSONLogRecord, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") || !strings.HasSuffix(trimmed, "}") {
+		return nil, false
+	}
+	var fields map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false
+	}
+	return &JSONLogRecord{Fields: fields}, true
+}
+
+// Get returns a field by name, supporting dotted paths into nested objects.
+func (rec *JSONLogRecord) Get(path string) (interface{}, bool) {
+	if v, ok := rec.Fields[path]; ok {
+		return v, true
+	}
+	var cur interface{} = rec.Fields
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func (rec *JSONLogRecord) first(keys []string) (string, interface{}, bool) {
+	for _, k := range keys {
+		if v, ok := rec.Get(k); ok {
+			return k, v, true
+		}
+	}
+	return "", nil, false
+}
+
+// Level returns the normalized level name ("" if absent).
+func (rec *JSONLogRecord) Level() string {
+	_, v, ok := rec.first(jsonLevelKeys)
+	if !ok {
+		return ""
+	}
+	if n, ok := v.(json.Number); ok {
+		// pino: 10 trace, 20 debug, 30 info, 40 warn, 50 error, 60 fatal
+		i, _ := n.Int64()
+		switch {
+		case i >= 60:
+			return "fatal"
+		case i >= 50:
+			return "error"
+		case i >= 40:
+			return "warn"
+		case i >= 30:
+			return "info"
+		case i >= 20:
+			return "debug"
+		default:
+			return "trace"
+		}
+	}
+	return strings.ToLower(fieldString(v))
+}
+
+// Message returns the log message ("" if absent).
+func (rec *JSONLogRecord) Message() string {
+	_, v, ok := rec.first(jsonMsgKeys)
+	if !ok {
+		return ""
+	}
+	return fieldString(v)
+}
+
+// levelRank maps a level name to an ordinal; unknown levels rank as info.
+func levelRank(level string) int {
+	if r, ok := jsonLevelRanks[strings.ToLower(level)]; ok {
+		return r
+	}
+	return jsonLevelRanks["info"]
+}
+
+func fieldString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// jsonLogFilter is one parsed filter expression
+type jsonLogFilter struct {
+	field string
+	op    string // =, !=, ~, >=, <=, >, <
+	value string
+	re    *regexp.Regexp
+}
+
+// jsonFilterRe splits "field<op>value"; field may be dotted (http.status)
+var jsonFilterRe = regexp.MustCompile(`^([A-Za-z0-9_.@-]+)\s*(>=|<=|!=|=|~|>|<)\s*(.*)$`)
+
+// parseJSONLogFilter parses expressions like level>=warn, user_id=42, msg~timeout.
+func parseJSONLogFilter(expr string) (*jsonLogFilter, error) {
+	m := jsonFilterRe.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return nil, fmt.Errorf("invalid filter %q (use field=value, field!=value, field~regex, level>=warn)", expr)
+	}
+	f := &jsonLogFilter{field: m[1], op: m[2], value: m[3]}
+	if f.op == "~" {
+		re, err := regexp.Compile(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in filter %q: %w", expr, err)
+		}
+		f.re = re
+	}
+	return f, nil
+}
+
+// match reports whether a record satisfies the filter. level and msg use the logger-specific keys.
+func (f *jsonLogFilter) match(rec *JSONLogRecord) bool {
+	var actual string
+	switch f.field {
+	case "level":
+		actual = rec.Level()
+		if actual == "" {
+			return false
+		}
+		if f.op != "~" {
+			return compareOrdered(levelRank(actual), levelRank(f.value), f.op)
+		}
+	case "msg", "message":
+		actual = rec.Message()
+	default:
+		v, ok := rec.Get(f.field)
+		if !ok {
+			return f.op == "!="
+		}
+		actual = fieldString(v)
+	}
+	switch f.op {
+	case "=":
+		return actual == f.value
+	case "!=":
+		return actual != f.value
+	case "~":
+		return f.re.MatchString(actual)
+	}
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(f.value, 64)
+	if errA != nil || errB != nil {
+		return compareOrdered(strings.Compare(actual, f.value), 0, f.op)
+	}
+	c := 0
+	if a < b {
+		c = -1
+	} else if a > b {
+		c = 1
+	}
+	return compareOrdered(c, 0, f.op)
+}
+
+func compareOrdered(a, b int, op string) bool {
+	switch op {
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	}
+	return false
+}
+
+// JSONLogQuery holds ?filter= and ?compact= options for log endpoints
+type JSONLogQuery struct {
+	filters []*jsonLogFilter
+	compact bool
+}
+
+// parseJSONLogQuery reads repeated ?filter=expr params and ?compact=1.
+func parseJSONLogQuery(r *http.Request) (*JSONLogQuery, error) {
+	q := &JSONLogQuery{compact: r.URL.Query().Get("compact") == "1"}
+	for _, expr := range r.URL.Query()["filter"] {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		f, err := parseJSONLogFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		q.filters = append(q.filters, f)
+	}
+	return q, nil
+}
+
+// Active reports whether the query changes output at all.
+func (q *JSONLogQuery) Active() bool {
+	return q != nil && (len(q.filters) > 0 || q.compact)
+}
+
+// Filtering reports whether the query drops lines (so callers should read more before tailing).
+func (q *JSONLogQuery) Filtering() bool {
+	return q != nil && len(q.filters) > 0
+}
+
+// Apply filters and/or compacts JSON lines. Non-JSON lines always pass through untouched.
+func (q *JSONLogQuery) Apply(text string) string {
+	if !q.Active() {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		rec, ok := parseJSONLogLine(line)
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		keep := true
+		for _, f := range q.filters {
+			if !f.match(rec) {
+				keep = false
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		if q.compact {
+			line = rec.Compact()
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// Compact renders a record as "15:04:05.000 WARN message key=value ...".
+func (rec *JSONLogRecord) Compact() string {
+	skip := make(map[string]bool)
+	var parts []string
+	if k, v, ok := rec.first(jsonTimeKeys); ok {
+		skip[k] = true
+		parts = append(parts, compactTime(v))
+	}
+	if k, _, ok := rec.first(jsonLevelKeys); ok {
+		skip[k] = true
+		parts = append(parts, fmt.Sprintf("%-5s", strings.ToUpper(rec.Level())))
+	}
+	if k, _, ok := rec.first(jsonMsgKeys); ok {
+		skip[k] = true
+		parts = append(parts, rec.Message())
+	}
+	keys := make([]string, 0, len(rec.Fields))
+	for k := range rec.Fields {
+		if !skip[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fieldString(rec.Fields[k])
+		if strings.ContainsAny(v, " \t") {
+			v = strconv.Quote(v)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// compactTime shortens string or epoch (seconds/millis) timestamps to local wall clock.
+func compactTime(v interface{}) string {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return t.String()
+		}
+		if f > 1e12 { // epoch millis (pino)
+			f /= 1000
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).Local().Format("15:04:05.000")
+	case string:
+		if parsed, ok := lineTime(t, time.Now()); ok {
+			return parsed.Local().Format("15:04:05.000")
+		}
+		return t
+	}
+	return fieldString(v)
+}
+
+// tailLines returns the last n lines of text.
+func tailLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const mixedLog = `=== crux: backend ===
+{"level":"info","ts":1700000000.5,"msg":"listening","port":8080}
+{"time":"2024-02-11T14:30:22Z","level":"WARN","msg":"slow query","db":{"table":"users"},"ms":1200}
+plain text line
+{"level":50,"time":1700000000123,"msg":"connection refused","user_id":42}
+{"event":"job done","level":"debug","job":"sync"}
+{not json}`
+
+func applyQuery(t *testing.T, params url.Values) string {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/logfile/backend?"+params.Encode(), nil)
+	q, err := parseJSONLogQuery(r)
+	if err != nil {
+		t.Fatalf("parseJSONLogQuery: %v", err)
+	}
+	return q.Apply(mixedLog)
+}
+
+func TestJSONLogQuery_LevelFilter(t *testing.T) {
+	got := applyQuery(t, url.Values{"filter": {"level>=warn"}})
+	for _, want := range []string{"slow query", "connection refused", "plain text line", "{not json}", "=== crux: backend ==="} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"listening", "job done"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("did not expect %q in output:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestJSONLogQuery_FieldAndRegexFilters(t *testing.T) {
+	tests := []struct {
+		filters []string
+		want    string
+		absent  string
+	}{
+		{[]string{"user_id=42"}, "connection refused", "slow query"},
+		{[]string{"db.table=users"}, "slow query", "listening"},
+		{[]string{"msg~^job"}, "job done", "listening"},
+		{[]string{"ms>1000"}, "slow query", "listening"},
+		{[]string{"level>=info", "port=8080"}, "listening", "slow query"},
+	}
+	for _, tt := range tests {
+		got := applyQuery(t, url.Values{"filter": tt.filters})
+		if !strings.Contains(got, tt.want) || strings.Contains(got, tt.absent) {
+			t.Errorf("filters %v: want %q without %q, got:\n%s", tt.filters, tt.want, tt.absent, got)
+		}
+	}
+}
+
+func TestJSONLogQuery_Compact(t *testing.T) {
+	got := applyQuery(t, url.Values{"compact": {"1"}, "filter": {"msg~slow"}})
+	if !strings.Contains(got, `WARN  slow query db={"table":"users"} ms=1200`) {
+		t.Errorf("unexpected compact output:\n%s", got)
+	}
+	if !strings.Contains(got, "plain text line") {
+		t.Error("non-JSON lines must pass through")
+	}
+}
+
+func TestParseJSONLogFilter_Invalid(t *testing.T) {
+	for _, expr := range []string{"level", "msg~(", "=x"} {
+		if _, err := parseJSONLogFilter(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
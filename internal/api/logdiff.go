@@ -0,0 +1,225 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Normalizers applied to each line before comparing runs, so values that change on every
+// start (times, PIDs, ports, addresses) don't show up as differences.
+var logdiffNormalizers = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}_\d{6}`), "<RUN>"},
+	{isoTimeRe, "<TS>"},
+	{regexp.MustCompile(`\b(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d+ \d{2}:\d{2}:\d{2}(?: [A-Z]{2,5})? \d{4}\b`), "<TS>"},
+	{clockTimeRe, "<TS>"},
+	{regexp.MustCompile(`(?i)\b(pid|process|thread|tid)([:= #]+)\d+`), "$1$2<PID>"},
+	{regexp.MustCompile(`\[\d{2,7}\]`), "[<PID>]"},
+	{regexp.MustCompile(`(localhost|\[::1?\]|\b(?:\d{1,3}\.){3}\d{1,3}|\b[a-z0-9-]+(?:\.[a-z0-9-]+)+|^|\s):\d{2,5}\b`), "$1:<PORT>"},
+	{regexp.MustCompile(`(?i)\bport[:= ]+\d{2,5}\b`), "port <PORT>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]{4,}\b`), "<ADDR>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<UUID>"},
+	{regexp.MustCompile(`\b\d+(?:\.\d+)?\s?(?:ns|µs|us|ms|s)\b`), "<DUR>"},
+}
+
+var (
+	errorLineRe = regexp.MustCompile(`(?i)\b(error|err|fatal|panic|exception|failed|failure|traceback|eaddrinuse)\b`)
+	warnLineRe  = regexp.MustCompile(`(?i)\b(warn|warning|deprecated)\b`)
+)
+
+// normalizeLogLine canonicalizes a line for comparison between runs.
+func normalizeLogLine(line string) string {
+	line = strings.TrimSpace(line)
+	for _, n := range logdiffNormalizers {
+		line = n.re.ReplaceAllString(line, n.repl)
+	}
+	return line
+}
+
+// LogDiff is the result of comparing two runs of a service
+type LogDiff struct {
+	Service string
+	RunA    string
+	RunB    string
+	OnlyA   []string // lines (first occurrence, un-normalized) present only in A
+	OnlyB   []string // lines present only in B
+}
+
+// diffRuns compares two log texts as multisets of normalized lines, preserving order of first appearance.
+func diffRuns(a, b string) (onlyA, onlyB []string) {
+	count := func(text string) (map[string]int, []string, map[string]string) {
+		counts := make(map[string]int)
+		original := make(map[string]string)
+		var order []string
+		for _, l := range strings.Split(text, "\n") {
+			key := normalizeLogLine(l)
+			if key == "" {
+				continue
+			}
+			if counts[key] == 0 {
+				order = append(order, key)
+				original[key] = strings.TrimRight(l, " ")
+			}
+			counts[key]++
+		}
+		return counts, order, original
+	}
+	ca, orderA, origA := count(a)
+	cb, orderB, origB := count(b)
+	for _, k := range orderA {
+		if cb[k] == 0 {
+			onlyA = append(onlyA, origA[k])
+		}
+	}
+	for _, k := range orderB {
+		if ca[k] == 0 {
+			onlyB = append(onlyB, origB[k])
+		}
+	}
+	return onlyA, onlyB
+}
+
+// resolveRunPair picks the two runs to compare. Empty a/b default to the previous and latest run;
+// "latest" resolves to the newest run and "previous" to the one before it.
+// Any other ref must name one of the service's runs.
+func resolveRunPair(baseDir, service, a, b string) (string, string, error) {
+	var runs []string
+	for _, f := range logRunFiles(baseDir, service) {
+		runs = append(runs, strings.TrimSuffix(filepath.Base(f), ".log"))
+	}
+	resolve := func(ref string, fallbackFromEnd int) (string, error) {
+		switch ref {
+		case "", "latest", "previous":
+			if ref == "latest" {
+				fallbackFromEnd = 1
+			} else if ref == "previous" {
+				fallbackFromEnd = 2
+			}
+			if len(runs) < fallbackFromEnd {
+				return "", fmt.Errorf("%s has %d run(s); need at least 2 to compare", service, len(runs))
+			}
+			return runs[len(runs)-fallbackFromEnd], nil
+		}
+		// Only runs of this service: a ref is never joined into a path
+		if !slices.Contains(runs, ref) {
+			return "", fmt.Errorf("run %s not found for %s (use run=list to see runs)", ref, service)
+		}
+		return ref, nil
+	}
+	ra, err := resolve(a, 2)
+	if err != nil {
+		return "", "", err
+	}
+	rb, err := resolve(b, 1)
+	if err != nil {
+		return "", "", err
+	}
+	return ra, rb, nil
+}
+
+// compareRuns loads two runs (plain-rendered) and diffs them.
+func compareRuns(baseDir, service, a, b string) (*LogDiff, error) {
+	ra, rb, err := resolveRunPair(baseDir, service, a, b)
+	if err != nil {
+		return nil, err
+	}
+	dataA, err := os.ReadFile(filepath.Join(baseDir, service, ra+".log"))
+	if err != nil {
+		return nil, err
+	}
+	dataB, err := os.ReadFile(filepath.Join(baseDir, service, rb+".log"))
+	if err != nil {
+		return nil, err
+	}
+	onlyA, onlyB := diffRuns(renderPlain(string(dataA)), renderPlain(string(dataB)))
+	return &LogDiff{Service: service, RunA: ra, RunB: rb, OnlyA: onlyA, OnlyB: onlyB}, nil
+}
+
+// splitBySeverity partitions lines into errors, warnings and the rest.
+func splitBySeverity(lines []string) (errs, warns, other []string) {
+	for _, l := range lines {
+		switch {
+		case errorLineRe.MatchString(l):
+			errs = append(errs, l)
+		case warnLineRe.MatchString(l):
+			warns = append(warns, l)
+		default:
+			other = append(other, l)
+		}
+	}
+	return
+}
+
+// Format renders the diff as text, capping each section at limit lines.
+func (d *LogDiff) Format(limit int) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("=== %s: A=%s vs B=%s ===\n", d.Service, d.RunA, d.RunB))
+	out.WriteString("(timestamps, PIDs, ports, addresses and durations normalized)\n\n")
+
+	errB, warnB, otherB := splitBySeverity(d.OnlyB)
+	errA, warnA, otherA := splitBySeverity(d.OnlyA)
+	out.WriteString(fmt.Sprintf("New in B: %d lines (%d errors, %d warnings)\n", len(d.OnlyB), len(errB), len(warnB)))
+	out.WriteString(fmt.Sprintf("Gone since A: %d lines (%d errors, %d warnings)\n", len(d.OnlyA), len(errA), len(warnA)))
+
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		out.WriteString(fmt.Sprintf("\n--- %s (%d) ---\n", title, len(lines)))
+		for i, l := range lines {
+			if i >= limit {
+				out.WriteString(fmt.Sprintf("... %d more\n", len(lines)-limit))
+				break
+			}
+			out.WriteString(l + "\n")
+		}
+	}
+	section("New errors in B", errB)
+	section("New warnings in B", warnB)
+	section("Other new lines in B", otherB)
+	section("Errors only in A", errA)
+	section("Warnings only in A", warnA)
+	section("Other lines only in A", otherA)
+	if len(d.OnlyA) == 0 && len(d.OnlyB) == 0 {
+		out.WriteString("\nNo differences.\n")
+	}
+	return out.String()
+}
+
+func (s *Server) handleLogdiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	service := strings.TrimSuffix(r.URL.Path[len("/logdiff/"):], "/")
+	if service == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(service, "/") || strings.Contains(service, "..") {
+		http.Error(w, "Invalid service name", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if n := q.Get("limit"); n != "" {
+		if parsed, err := strconv.Atoi(n); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	diff, err := compareRuns(logBaseDir, service, q.Get("a"), q.Get("b"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(s.redactFor(r).Redact(diff.Format(limit))))
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLogLine(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"2024-02-11T14:30:22.123Z INFO started", "<TS> INFO started"},
+		{"[14:30:22] compiled", "[<TS>] compiled"},
+		{"Sun Feb 11 14:30:22 UTC 2024 boot", "<TS> boot"},
+		{"log: /tmp/crux-logs/api/2024-02-11_143022.log", "log: /tmp/crux-logs/api/<RUN>.log"},
+		{"worker pid=4242 ready", "worker pid=<PID> ready"},
+		{"nginx[31337]: up", "nginx[<PID>]: up"},
+		{"listening on localhost:8080", "listening on localhost:<PORT>"},
+		{"listening on 127.0.0.1:54321 and [::]:9000", "listening on 127.0.0.1:<PORT> and [::]:<PORT>"},
+		{"bound to port 3000", "bound to port <PORT>"},
+		{"request took 12.5ms (db 3 s)", "request took <DUR> (db <DUR>)"},
+		{"object at 0xc000123abc", "object at <ADDR>"},
+		{"id 123e4567-e89b-12d3-a456-426614174000", "id <UUID>"},
+		{"  padded  ", "padded"},
+	}
+	for _, tt := range tests {
+		if got := normalizeLogLine(tt.in); got != tt.want {
+			t.Errorf("normalizeLogLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	dir := t.TempDir()
+	write := func(run, data string) {
+		if err := os.MkdirAll(filepath.Join(dir, "api"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "api", run+".log"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("2024-02-11_100000", "10:00:00 starting pid=100\n10:00:01 listening on :8080\n10:00:01 cache warmed in 120ms\n10:00:02 WARN deprecated flag --old\n")
+	write("2024-02-11_110000", "11:00:00 starting pid=200\n11:00:01 listening on :8081\n\x1b[31m11:00:01 ERROR connect db: refused\x1b[0m\n11:00:01 cache warmed in 98ms\n")
+	write("latest", "not a run\n")
+
+	diff, err := compareRuns(dir, "api", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.RunA != "2024-02-11_100000" || diff.RunB != "2024-02-11_110000" {
+		t.Errorf("runs = %s, %s", diff.RunA, diff.RunB)
+	}
+	if want := []string{"10:00:02 WARN deprecated flag --old"}; !reflect.DeepEqual(diff.OnlyA, want) {
+		t.Errorf("OnlyA = %q, want %q", diff.OnlyA, want)
+	}
+	if want := []string{"11:00:01 ERROR connect db: refused"}; !reflect.DeepEqual(diff.OnlyB, want) {
+		t.Errorf("OnlyB = %q, want %q", diff.OnlyB, want)
+	}
+	text := diff.Format(10)
+	for _, want := range []string{"New in B: 1 lines (1 errors, 0 warnings)", "--- New errors in B (1) ---", "--- Warnings only in A (1) ---"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Format() missing %q:\n%s", want, text)
+		}
+	}
+
+	if same, _ := compareRuns(dir, "api", "2024-02-11_110000", "latest"); same == nil || len(same.OnlyA)+len(same.OnlyB) != 0 || !strings.Contains(same.Format(10), "No differences.") {
+		t.Errorf("run against itself: %+v", same)
+	}
+	if _, _, err := resolveRunPair(dir, "api", "2024-01-01_000000", ""); err == nil {
+		t.Error("unknown run accepted")
+	}
+	os.MkdirAll(filepath.Join(dir, "other"), 0755)
+	write("../other/2024-02-11_120000", "another service\n")
+	write("../outside", "not a run\n")
+	for _, ref := range []string{"../other/2024-02-11_120000", "../outside", dir + "/outside", "2024-02-11_110000/../../outside"} {
+		if _, _, err := resolveRunPair(dir, "api", ref, "latest"); err == nil {
+			t.Errorf("ref %q outside the service's runs accepted", ref)
+		}
+	}
+	if _, _, err := resolveRunPair(dir, "web", "", ""); err == nil {
+		t.Error("service without runs accepted")
+	}
+}
@@ -0,0 +1,397 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics sampling defaults (metrics.interval / metrics.history in config)
+const (
+	DefaultMetricsInterval = 5 * time.Second
+	DefaultMetricsHistory  = 720 // one hour at the default interval
+)
+
+// clockTicks is USER_HZ, the unit of utime/stime in /proc/<pid>/stat (100 on every Linux we run on)
+const clockTicks = 100
+
+// MetricsSample is the resource usage of a service's process tree (wrapper and everything
+// below it) at one point in time.
+type MetricsSample struct {
+	Time           time.Time `json:"time"`
+	RunID          string    `json:"run_id,omitempty"`
+	CPUPercent     float64   `json:"cpu_percent"` // of one core, summed over the tree (200 = two busy cores)
+	RSSBytes       uint64    `json:"rss_bytes"`
+	RSS            string    `json:"rss"` // RSSBytes for humans ("1.2 GB")
+	Threads        int       `json:"threads,omitempty"`
+	OpenFDs        int       `json:"open_fds,omitempty"`
+	Processes      int       `json:"processes"`
+	LargestPID     int       `json:"largest_pid,omitempty"` // process with the most RSS
+	LargestCommand string    `json:"largest_command,omitempty"`
+}
+
+// ServiceMetrics is one service in GET /metrics, or the response of GET /metrics/{service}
+// (which includes the samples).
+type ServiceMetrics struct {
+	Service        string          `json:"service"`
+	Latest         *MetricsSample  `json:"latest,omitempty"`
+	PeakCPUPercent float64         `json:"peak_cpu_percent,omitempty"` // over the samples kept (or asked for)
+	PeakRSSBytes   uint64          `json:"peak_rss_bytes,omitempty"`
+	PeakRSS        string          `json:"peak_rss,omitempty"`
+	Interval       string          `json:"interval,omitempty"`
+	Samples        []MetricsSample `json:"samples,omitempty"`
+}
+
+// MetricsResponse is the response for GET /metrics: the latest sample of every running
+// service, biggest memory user first.
+type MetricsResponse struct {
+	Interval string           `json:"interval"`
+	Services []ServiceMetrics `json:"services"`
+}
+
+// procUsage is what one process contributes to a sample
+type procUsage struct {
+	ticks   uint64 // utime + stime
+	rss     uint64
+	threads int
+	fds     int
+}
+
+// metricsStore keeps a bounded history of samples per service, plus the CPU ticks seen at the
+// previous sample so CPU usage can be computed as a rate.
+type metricsStore struct {
+	mu        sync.Mutex
+	limit     int
+	history   map[string][]MetricsSample
+	prevTicks map[string]map[int]uint64
+	prevTime  map[string]time.Time
+}
+
+func newMetricsStore(limit int) *metricsStore {
+	return &metricsStore{
+		limit:     limit,
+		history:   make(map[string][]MetricsSample),
+		prevTicks: make(map[string]map[int]uint64),
+		prevTime:  make(map[string]time.Time),
+	}
+}
+
+// record samples the processes pids of a service's run and appends the result to its history.
+func (m *metricsStore) record(name, runID string, pids []int, now time.Time) MetricsSample {
+	usage := sampleProcesses(pids)
+	sample := MetricsSample{Time: now, RunID: runID, Processes: len(usage)}
+	var largest uint64
+	for pid, u := range usage {
+		sample.RSSBytes += u.rss
+		sample.Threads += u.threads
+		sample.OpenFDs += u.fds
+		if u.rss > largest {
+			largest = u.rss
+			sample.LargestPID = pid
+		}
+	}
+	sample.RSS = formatBytes(sample.RSSBytes)
+	if sample.LargestPID > 0 {
+		sample.LargestCommand = processCommand(sample.LargestPID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ticks := make(map[int]uint64, len(usage))
+	var used uint64
+	prev := m.prevTicks[name]
+	for pid, u := range usage {
+		ticks[pid] = u.ticks
+		// Processes that appeared since the last sample have no baseline yet
+		if before, ok := prev[pid]; ok && u.ticks >= before {
+			used += u.ticks - before
+		}
+	}
+	if last, ok := m.prevTime[name]; ok && now.After(last) {
+		cpu := float64(used) / clockTicks / now.Sub(last).Seconds() * 100
+		sample.CPUPercent = float64(int(cpu*10+0.5)) / 10
+	}
+	m.prevTicks[name] = ticks
+	m.prevTime[name] = now
+
+	h := append(m.history[name], sample)
+	if len(h) > m.limit {
+		h = h[len(h)-m.limit:]
+	}
+	m.history[name] = h
+	return sample
+}
+
+// idle forgets the CPU baseline of a service that isn't running, so its next run starts fresh.
+func (m *metricsStore) idle(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.prevTicks, name)
+	delete(m.prevTime, name)
+}
+
+// latest returns the newest sample of a service's run (nil if that run hasn't been sampled).
+func (m *metricsStore) latest(name, runID string) *MetricsSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.history[name]
+	if len(h) == 0 || h[len(h)-1].RunID != runID {
+		return nil
+	}
+	sample := h[len(h)-1]
+	return &sample
+}
+
+// samples returns a service's history from since on (all of it for a zero time).
+func (m *metricsStore) samples(name string, since time.Time) []MetricsSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.history[name]
+	i := sort.Search(len(h), func(i int) bool { return !h[i].Time.Before(since) })
+	return append([]MetricsSample(nil), h[i:]...)
+}
+
+// sampleProcesses reads the usage of each pid from /proc, falling back to ps where there is
+// no /proc (macOS: no thread or fd counts). Processes that exited meanwhile are left out.
+func sampleProcesses(pids []int) map[int]procUsage {
+	out := make(map[int]procUsage, len(pids))
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		return psUsage(pids)
+	}
+	pageSize := uint64(os.Getpagesize())
+	for _, pid := range pids {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue
+		}
+		u, ok := parseProcStat(string(data), pageSize)
+		if !ok {
+			continue
+		}
+		if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+			u.fds = len(fds)
+		}
+		out[pid] = u
+	}
+	return out
+}
+
+// parseProcStat reads CPU ticks, thread count and RSS from a /proc/<pid>/stat line.
+func parseProcStat(line string, pageSize uint64) (procUsage, bool) {
+	// The command name is in parentheses and may itself contain spaces or parentheses
+	end := strings.LastIndexByte(line, ')')
+	if end < 0 {
+		return procUsage{}, false
+	}
+	// Fields from state (field 3 in proc(5)) on
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return procUsage{}, false
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	rss, _ := strconv.ParseUint(fields[21], 10, 64)
+	return procUsage{ticks: utime + stime, threads: threads, rss: rss * pageSize}, true
+}
+
+// psUsage samples RSS and accumulated CPU time via ps.
+func psUsage(pids []int) map[int]procUsage {
+	out := make(map[int]procUsage, len(pids))
+	if len(pids) == 0 {
+		return out
+	}
+	list := make([]string, len(pids))
+	for i, pid := range pids {
+		list[i] = strconv.Itoa(pid)
+	}
+	data, err := exec.Command("ps", "-o", "pid=,rss=,time=", "-p", strings.Join(list, ",")).Output()
+	if err != nil && len(data) == 0 {
+		return out
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		rssKB, _ := strconv.ParseUint(fields[1], 10, 64)
+		out[pid] = procUsage{rss: rssKB * 1024, ticks: psCPUTicks(fields[2])}
+	}
+	return out
+}
+
+// psCPUTicks converts ps's cumulative CPU time ([dd-]hh:mm:ss or mm:ss.cc) to clock ticks.
+func psCPUTicks(v string) uint64 {
+	var days float64
+	if d, rest, ok := strings.Cut(v, "-"); ok {
+		days, _ = strconv.ParseFloat(d, 64)
+		v = rest
+	}
+	var secs float64
+	for _, part := range strings.Split(v, ":") {
+		n, _ := strconv.ParseFloat(part, 64)
+		secs = secs*60 + n
+	}
+	return uint64((days*86400 + secs) * clockTicks)
+}
+
+// formatBytes renders a byte count as "512 KB", "1.2 GB", ...
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// SetMetrics sets how often service processes are sampled (0 disables sampling) and how many
+// samples per service are kept.
+func (s *Server) SetMetrics(interval time.Duration, history int) {
+	if history <= 0 {
+		history = DefaultMetricsHistory
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metricsInterval = interval
+	s.metrics = newMetricsStore(history)
+}
+
+// sampleMetrics records one sample for every service whose latest run is alive.
+// Interactive services run without the wrapper, so they have no process tree to follow.
+func (s *Server) sampleMetrics() {
+	s.mu.RLock()
+	specs := s.services
+	store := s.metrics
+	s.mu.RUnlock()
+	procs := processTable()
+	now := time.Now()
+	for _, spec := range specs {
+		if spec.Interactive {
+			continue
+		}
+		runID := latestRunID(logBaseDir, spec.Name)
+		rec, err := readRunRecord(logBaseDir, spec.Name, runID)
+		if err != nil || rec.ExitCode != nil || !isProcessAlive(rec.WrapperPID) {
+			store.idle(spec.Name)
+			continue
+		}
+		store.record(spec.Name, runID, processTree(procs, rec.WrapperPID), now)
+	}
+}
+
+// watchMetrics samples service processes every interval.
+func (s *Server) watchMetrics(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.sampleMetrics()
+		}
+	}
+}
+
+// serviceMetrics summarises samples (newest last) of one service.
+func serviceMetrics(name string, samples []MetricsSample) ServiceMetrics {
+	sm := ServiceMetrics{Service: name}
+	for _, smp := range samples {
+		if smp.CPUPercent > sm.PeakCPUPercent {
+			sm.PeakCPUPercent = smp.CPUPercent
+		}
+		if smp.RSSBytes > sm.PeakRSSBytes {
+			sm.PeakRSSBytes = smp.RSSBytes
+		}
+	}
+	if sm.PeakRSSBytes > 0 {
+		sm.PeakRSS = formatBytes(sm.PeakRSSBytes)
+	}
+	if len(samples) > 0 {
+		latest := samples[len(samples)-1]
+		sm.Latest = &latest
+	}
+	return sm
+}
+
+// handleMetrics returns the latest sample of every running service (GET /metrics).
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	store, interval := s.metrics, s.metricsInterval
+	s.mu.RUnlock()
+	resp := MetricsResponse{Interval: interval.String(), Services: []ServiceMetrics{}}
+	for _, st := range s.Services() {
+		if st.Metrics == nil {
+			continue
+		}
+		// Peaks of the current run only
+		var run []MetricsSample
+		for _, smp := range store.samples(st.Name, time.Time{}) {
+			if smp.RunID == st.RunID {
+				run = append(run, smp)
+			}
+		}
+		resp.Services = append(resp.Services, serviceMetrics(st.Name, run))
+	}
+	sort.SliceStable(resp.Services, func(i, j int) bool {
+		return resp.Services[i].Latest.RSSBytes > resp.Services[j].Latest.RSSBytes
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleServiceMetrics returns a service's sample history (GET /metrics/{service}?since=15m).
+func (s *Server) handleServiceMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Path[len("/metrics/"):]
+	if name == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	s.mu.RLock()
+	store, interval := s.metrics, s.metricsInterval
+	_, known := s.specFor(name)
+	s.mu.RUnlock()
+	if !known {
+		http.Error(w, fmt.Sprintf("Service '%s' not found", name), http.StatusNotFound)
+		return
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid since %q (use e.g. 15m)", v), http.StatusBadRequest)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+	samples := store.samples(name, since)
+	sm := serviceMetrics(name, samples)
+	sm.Interval = interval.String()
+	sm.Samples = samples
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sm)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	// comm with spaces and parentheses, as e.g. "(sd-pam)" or Chrome helpers produce
+	line := "4242 (my (weird) cmd) S 1 4242 4242 0 -1 4194560 1200 0 0 0 150 50 0 0 20 0 12 0 100 123456789 2048 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0"
+	u, ok := parseProcStat(line, 4096)
+	if !ok {
+		t.Fatal("parseProcStat failed")
+	}
+	if u.ticks != 200 || u.threads != 12 || u.rss != 2048*4096 {
+		t.Errorf("parseProcStat = %+v, want ticks 200, threads 12, rss %d", u, 2048*4096)
+	}
+	if _, ok := parseProcStat("garbage", 4096); ok {
+		t.Error("parseProcStat accepted garbage")
+	}
+}
+
+func TestPsCPUTicks(t *testing.T) {
+	for in, want := range map[string]uint64{
+		"0:01.50":    150,
+		"01:02:03":   372300,
+		"1-00:00:00": 8640000,
+		"00:00:00":   0,
+	} {
+		if got := psCPUTicks(in); got != want {
+			t.Errorf("psCPUTicks(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512 B", 2048: "2.0 KB", 8 << 30: "8.0 GB", 1536 << 20: "1.5 GB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestMetricsStoreRecord(t *testing.T) {
+	m := newMetricsStore(2)
+	pids := []int{os.Getpid(), -1} // a pid that doesn't exist is skipped
+	start := time.Now()
+	first := m.record("backend", "run1", pids, start)
+	if first.Processes != 1 || first.RSSBytes == 0 || first.LargestPID != os.Getpid() {
+		t.Fatalf("first sample = %+v", first)
+	}
+	if first.CPUPercent != 0 {
+		t.Errorf("first sample has no baseline, got cpu %.1f", first.CPUPercent)
+	}
+	m.record("backend", "run1", pids, time.Now())
+	last := m.record("backend", "run1", pids, time.Now().Add(time.Millisecond))
+	if got := m.samples("backend", time.Time{}); len(got) != 2 {
+		t.Errorf("history holds %d samples, want the limit 2", len(got))
+	}
+	if l := m.latest("backend", "run1"); l == nil || !l.Time.Equal(last.Time) {
+		t.Errorf("latest = %+v, want the last sample", l)
+	}
+	if m.latest("backend", "run2") != nil {
+		t.Error("latest returned a sample of another run")
+	}
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPISpec is the OpenAPI 3 description of this API, served at GET /openapi.yaml.
+// Keep it in sync when adding or changing endpoints.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(OpenAPISpec)
+}
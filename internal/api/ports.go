@@ -0,0 +1,259 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// CruxServiceEnv is set in the environment of every process crux starts for a service, so a
+// process left behind by an earlier session can be recognised as a stale crux child.
+const CruxServiceEnv = "CRUX_SERVICE"
+
+// PortHolder is the process listening on a TCP port.
+type PortHolder struct {
+	Port        int    `json:"port"`
+	PID         int    `json:"pid,omitempty"` // 0 when the owner isn't visible (another user's process)
+	Command     string `json:"command,omitempty"`
+	CruxService string `json:"crux_service,omitempty"` // CRUX_SERVICE of the holder: started by crux for this service
+	Own         bool   `json:"own"`                    // held by the service's current run
+}
+
+// String describes the holder for warnings ("pid 123 (go run .), crux service backend").
+func (h PortHolder) String() string {
+	if h.PID == 0 {
+		return "an unknown process (not visible to this user)"
+	}
+	s := fmt.Sprintf("pid %d", h.PID)
+	if h.Command != "" {
+		s += " (" + h.Command + ")"
+	}
+	if h.CruxService != "" {
+		s += ", crux service " + h.CruxService
+	}
+	return s
+}
+
+// Kill stops the holder and its children: SIGTERM, then SIGKILL after timeout.
+func (h PortHolder) Kill(timeout time.Duration) error {
+	if h.PID <= 0 {
+		return fmt.Errorf("port %d: holder not known", h.Port)
+	}
+	signalTree(h.PID, syscall.SIGTERM)
+	deadline := time.Now().Add(timeout)
+	for isProcessAlive(h.PID) {
+		if time.Now().After(deadline) {
+			signalTree(h.PID, syscall.SIGKILL)
+			time.Sleep(200 * time.Millisecond)
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if isProcessAlive(h.PID) {
+		return fmt.Errorf("pid %d is still running", h.PID)
+	}
+	return nil
+}
+
+// FindPortHolders returns the listening process for each of ports that is in use. On Linux the
+// socket is matched to its process through /proc; elsewhere lsof is used.
+func FindPortHolders(ports []int) map[int]PortHolder {
+	holders := make(map[int]PortHolder)
+	if len(ports) == 0 {
+		return holders
+	}
+	inodes, ok := listeningInodes(ports)
+	if !ok {
+		for _, port := range ports {
+			if pid, held := lsofListener(port); held {
+				holders[port] = describeHolder(port, pid)
+			}
+		}
+		return holders
+	}
+	if len(inodes) == 0 {
+		return holders
+	}
+	owners := socketOwners(inodes)
+	for inode, port := range inodes {
+		if _, seen := holders[port]; seen && owners[inode] == 0 {
+			continue // keep the visible one when both tcp and tcp6 listen
+		}
+		holders[port] = describeHolder(port, owners[inode])
+	}
+	return holders
+}
+
+// listeningInodes maps the socket inodes of LISTEN sockets on ports (from /proc/net/tcp and
+// tcp6) to their port. ok is false when /proc/net is not available.
+func listeningInodes(ports []int) (map[string]int, bool) {
+	want := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		want[p] = true
+	}
+	inodes := make(map[string]int)
+	found := false
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(table)
+		if err != nil {
+			continue
+		}
+		found = true
+		for port, inode := range parseListeners(bufio.NewScanner(f)) {
+			if want[port] {
+				for _, i := range inode {
+					inodes[i] = port
+				}
+			}
+		}
+		f.Close()
+	}
+	return inodes, found
+}
+
+// parseListeners reads a /proc/net/tcp table and returns the inodes of LISTEN sockets by port.
+func parseListeners(scanner *bufio.Scanner) map[int][]string {
+	const stateListen = "0A"
+	out := make(map[int][]string)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != stateListen {
+			continue
+		}
+		_, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseInt(portHex, 16, 32)
+		if err != nil {
+			continue
+		}
+		out[int(port)] = append(out[int(port)], fields[9])
+	}
+	return out
+}
+
+// socketOwners finds which process has each socket inode open by scanning /proc/<pid>/fd.
+// Processes of other users can't be read and stay unknown.
+func socketOwners(inodes map[string]int) map[string]int {
+	owners := make(map[string]int)
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range procs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, ok := inodes[inode]; ok && owners[inode] == 0 {
+				owners[inode] = pid
+			}
+		}
+		if len(owners) == len(inodes) {
+			break
+		}
+	}
+	return owners
+}
+
+// lsofListener returns the pid listening on port via lsof (macOS).
+func lsofListener(port int) (int, bool) {
+	out, err := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-t").Output()
+	if err != nil {
+		return 0, false
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]))
+	return pid, true
+}
+
+func describeHolder(port, pid int) PortHolder {
+	h := PortHolder{Port: port, PID: pid}
+	if pid > 0 {
+		h.Command = processCommand(pid)
+		h.CruxService = processEnv(pid, CruxServiceEnv)
+	}
+	return h
+}
+
+// processCommand returns a process's command line, shortened for display.
+func processCommand(pid int) string {
+	var cmd string
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		cmd = strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+	} else if out, err := exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output(); err == nil {
+		cmd = strings.TrimSpace(string(out))
+	}
+	if len(cmd) > 80 {
+		cmd = cmd[:77] + "..."
+	}
+	return cmd
+}
+
+// processEnv returns one environment variable of a process ("" if unset or unreadable).
+func processEnv(pid int, key string) string {
+	prefix := key + "="
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid)); err == nil {
+		for _, kv := range strings.Split(string(data), "\x00") {
+			if v, ok := strings.CutPrefix(kv, prefix); ok {
+				return v
+			}
+		}
+		return ""
+	}
+	// macOS: ps shows the environment after the command for the user's own processes
+	out, err := exec.Command("ps", "eww", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	for _, field := range strings.Fields(string(out)) {
+		if v, ok := strings.CutPrefix(field, prefix); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// portHoldersFor lists the holders of ports, marking those inside tree (the current run's
+// processes) as own.
+func portHoldersFor(ports []int, holders map[int]PortHolder, tree []int) []PortHolder {
+	var out []PortHolder
+	for _, port := range ports {
+		h, ok := holders[port]
+		if !ok {
+			continue
+		}
+		for _, pid := range tree {
+			if pid == h.PID {
+				h.Own = true
+				break
+			}
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// foreignHolder returns the first holder known to belong to another process than the run.
+func foreignHolder(holders []PortHolder) (PortHolder, bool) {
+	for _, h := range holders {
+		if h.PID > 0 && !h.Own {
+			return h, true
+		}
+	}
+	return PortHolder{}, false
+}
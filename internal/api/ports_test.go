@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseListeners(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 4343 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 777 1 0000000000000000 100 0 0 10 0
+`
+	got := parseListeners(bufio.NewScanner(strings.NewReader(table)))
+	want := map[int][]string{8080: {"4242"}, 5432: {"777"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseListeners = %v, want %v", got, want)
+	}
+}
+
+func TestFindPortHolders(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	holders := FindPortHolders([]int{port})
+	h, ok := holders[port]
+	if !ok {
+		t.Fatalf("port %d not reported as held: %v", port, holders)
+	}
+	if h.PID != os.Getpid() {
+		t.Errorf("holder pid = %d, want %d (this test)", h.PID, os.Getpid())
+	}
+	ln.Close()
+	if holders := FindPortHolders([]int{port}); len(holders) != 0 {
+		t.Errorf("closed port still held: %v", holders)
+	}
+}
+
+func TestProcessEnv(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	cmd.Env = append(os.Environ(), CruxServiceEnv+"=backend")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer cmd.Process.Kill()
+	// Until the child has exec'd, /proc shows the environment inherited from the test
+	var got string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if got = processEnv(cmd.Process.Pid, CruxServiceEnv); got != "" {
+			break
+		}
+	}
+	if got != "backend" {
+		t.Errorf("processEnv = %q, want backend", got)
+	}
+}
+
+func TestPortHoldersFor(t *testing.T) {
+	holders := map[int]PortHolder{8080: {Port: 8080, PID: 12}, 9090: {Port: 9090, PID: 99}}
+	got := portHoldersFor([]int{8080, 8081, 9090}, holders, []int{10, 12})
+	if len(got) != 2 || !got[0].Own || got[1].Own {
+		t.Fatalf("portHoldersFor = %+v", got)
+	}
+	if h, ok := foreignHolder(got); !ok || h.Port != 9090 {
+		t.Errorf("foreignHolder = %+v, %v", h, ok)
+	}
+}
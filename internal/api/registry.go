@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SessionInfo describes a running crux session. Every session registers itself in
+// SessionRegistryDir so clients (crux-mcp) can find the one for their project.
+type SessionInfo struct {
+	PID        int       `json:"pid"`
+	ConfigPath string    `json:"config_path"`
+	ProjectDir string    `json:"project_dir"` // directory of the config file
+	Port       int       `json:"port"`
+	URL        string    `json:"url"`              // where the API answers locally, e.g. http://127.0.0.1:9876
+	Socket     string    `json:"socket,omitempty"` // Unix socket, if configured
+	Token      string    `json:"token,omitempty"`  // the entry is readable only by the user, like the token file
+	Started    time.Time `json:"started"`
+	Services   []string  `json:"services,omitempty"`
+}
+
+// SessionRegistryDir is where sessions register: ~/.crux/sessions (directory mode 0700).
+func SessionRegistryDir() string {
+	return filepath.Join(filepath.Dir(TokenPath(0)), "sessions")
+}
+
+func sessionFile(dir string, pid int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.json", pid))
+}
+
+// RegisterSession records info in the registry at dir, replacing an older entry for the PID.
+func RegisterSession(dir string, info SessionInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), sessionFile(dir, info.PID))
+}
+
+// UnregisterSession removes the session's entry (on shutdown).
+func UnregisterSession(dir string, pid int) {
+	os.Remove(sessionFile(dir, pid))
+}
+
+// ListSessions returns the registered sessions, newest first. Entries whose process is gone
+// (crux was killed or crashed) are deleted.
+func ListSessions(dir string) ([]SessionInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []SessionInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var info SessionInfo
+		if err := json.Unmarshal(data, &info); err != nil || !isProcessAlive(info.PID) {
+			os.Remove(path)
+			continue
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Started.After(sessions[j].Started) })
+	return sessions, nil
+}
+
+// MatchSession picks the session for workDir: the one whose project directory contains it
+// (the deepest, when projects are nested), else the only session there is.
+func MatchSession(sessions []SessionInfo, workDir string) (SessionInfo, bool) {
+	if workDir != "" {
+		if abs, err := filepath.Abs(workDir); err == nil {
+			workDir = abs
+		}
+		if resolved, err := filepath.EvalSymlinks(workDir); err == nil {
+			workDir = resolved
+		}
+		best, bestLen := -1, 0
+		for i, s := range sessions {
+			project := s.ProjectDir
+			if resolved, err := filepath.EvalSymlinks(project); err == nil {
+				project = resolved
+			}
+			rel, err := filepath.Rel(project, workDir)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if best < 0 || len(project) > bestLen {
+				best, bestLen = i, len(project)
+			}
+		}
+		if best >= 0 {
+			return sessions[best], true
+		}
+	}
+	if len(sessions) == 1 {
+		return sessions[0], true
+	}
+	return SessionInfo{}, false
+}
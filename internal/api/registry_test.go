@@ -0,0 +1,68 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionRegistry(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	now := time.Now()
+	live := SessionInfo{PID: os.Getpid(), ProjectDir: "/work/shop", Port: 9876, Token: "t", Started: now}
+	if err := RegisterSession(dir, live); err != nil {
+		t.Fatal(err)
+	}
+	// An entry left behind by a crux that was killed
+	if err := RegisterSession(dir, SessionInfo{PID: 1 << 30, ProjectDir: "/work/old", Started: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(sessionFile(dir, live.PID)); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("entry mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	sessions, err := ListSessions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].PID != live.PID || sessions[0].Token != "t" {
+		t.Fatalf("ListSessions = %+v", sessions)
+	}
+	if _, err := os.Stat(sessionFile(dir, 1<<30)); !os.IsNotExist(err) {
+		t.Error("stale entry not pruned")
+	}
+
+	UnregisterSession(dir, live.PID)
+	if sessions, _ := ListSessions(dir); len(sessions) != 0 {
+		t.Errorf("after unregister: %+v", sessions)
+	}
+}
+
+func TestMatchSession(t *testing.T) {
+	sessions := []SessionInfo{
+		{PID: 1, ProjectDir: "/work/shop"},
+		{PID: 2, ProjectDir: "/work/shop/admin"},
+		{PID: 3, ProjectDir: "/work/shopify"},
+	}
+	cases := []struct {
+		dir  string
+		want int
+	}{
+		{"/work/shop", 1},
+		{"/work/shop/backend/cmd", 1},
+		{"/work/shop/admin/web", 2},
+		{"/work/shopify", 3},
+		{"/elsewhere", 0},
+		{"", 0},
+	}
+	for _, tc := range cases {
+		got, ok := MatchSession(sessions, tc.dir)
+		if (tc.want == 0) == ok || (ok && got.PID != tc.want) {
+			t.Errorf("MatchSession(%q) = %d, %v; want %d", tc.dir, got.PID, ok, tc.want)
+		}
+	}
+	if got, ok := MatchSession(sessions[:1], "/elsewhere"); !ok || got.PID != 1 {
+		t.Errorf("single session not used as fallback: %d, %v", got.PID, ok)
+	}
+}
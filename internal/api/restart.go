@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReadyTimeout = 60 * time.Second // how long restarts wait for the new run to become ready
+	newRunTimeout       = 10 * time.Second // how long a started service has to write its run record
+)
+
+// RestartResponse is the response for POST /restart/<service> in tab mode
+type RestartResponse struct {
+	CommandResponse
+	RunID         string       `json:"run_id,omitempty"`
+	PreviousRunID string       `json:"previous_run_id,omitempty"`
+	State         ServiceState `json:"state,omitempty"`
+	Ready         bool         `json:"ready"`
+	Duration      string       `json:"duration,omitempty"`
+	LastError     string       `json:"last_error,omitempty"`
+}
+
+// serviceLock returns the mutex that serializes lifecycle operations (restart, batch actions)
+// on one service, so concurrent clients don't interleave stop and start.
+func (s *Server) serviceLock(name string) *sync.Mutex {
+	s.locksMu.Lock()
+	defer s.locksMu.Unlock()
+	if s.serviceLocks == nil {
+		s.serviceLocks = make(map[string]*sync.Mutex)
+	}
+	l, ok := s.serviceLocks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		s.serviceLocks[name] = l
+	}
+	return l
+}
+
+// serviceStatus observes a single service.
+func (s *Server) serviceStatus(name string) (ServiceStatus, bool) {
+	for _, st := range s.Services() {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return ServiceStatus{}, false
+}
+
+// RestartService stops a tab-mode service gracefully, waits for it to exit, starts it again
+// with the same config and waits up to readyTimeout (0 = don't wait) for the new run to be
+// ready or fail.
+func (s *Server) RestartService(name string, readyTimeout time.Duration) RestartResponse {
+	lock := s.serviceLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.restartLocked(name, readyTimeout)
+}
+
+func (s *Server) restartLocked(name string, readyTimeout time.Duration) RestartResponse {
+	start := time.Now()
+	resp := RestartResponse{CommandResponse: CommandResponse{Service: name}}
+	s.mu.RLock()
+	canStart := s.startOneHdl != nil
+	_, known := s.specFor(name)
+	configured := len(s.services) > 0
+	s.mu.RUnlock()
+	if !canStart {
+		resp.Message = "Restart not available (crux must be running with wezterm)"
+		return resp
+	}
+	if configured && !known {
+		resp.Message = fmt.Sprintf("service %q not found in config", name)
+		return resp
+	}
+
+	resp.PreviousRunID = latestRunID(logBaseDir, name)
+	if st, ok := s.serviceStatus(name); ok && st.HasTab {
+		if _, err := s.StopService(name); err != nil {
+			resp.Message = "stop failed: " + err.Error()
+			return resp
+		}
+	}
+	runID, msg, ok := s.startAndWaitRun(name)
+	if !ok {
+		resp.Message = "stopped, but start failed: " + msg
+		return resp
+	}
+	resp.Success = true
+	resp.Message = "Restarted " + name
+	resp.RunID = runID
+
+	st, _ := s.waitForState(name, readyTimeout, StateReady, StateCrashed, StateExited)
+	resp.State = st.State
+	resp.Ready = st.State == StateReady
+	resp.LastError = st.LastError
+	resp.Duration = time.Since(start).Round(100 * time.Millisecond).String()
+	switch {
+	case st.State == StateCrashed || st.State == StateExited:
+		resp.Success = false
+		resp.Message = fmt.Sprintf("Restarted %s, but the new run %s", name, st.State)
+	case readyTimeout > 0 && !resp.Ready:
+		resp.Message = fmt.Sprintf("Restarted %s; not ready after %s (state %s)", name, readyTimeout, st.State)
+	}
+	return resp
+}
+
+// avoidRunIDReuse sleeps into the next second when prev was started this second: run IDs have
+// one-second resolution and a new run must not reuse the old one's files.
+func avoidRunIDReuse(prev string) {
+	if prev == time.Now().Format(runFileLayout) {
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	}
+}
+
+// waitNewRun polls until the service's latest run id differs from prev.
+func waitNewRun(name, prev string, timeout time.Duration) (string, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if id := latestRunID(logBaseDir, name); id != prev {
+			return id, true
+		}
+		if time.Now().After(deadline) {
+			return prev, false
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// waitForState polls a service until it is in one of states or timeout passes, returning
+// the last status observed and whether a target state was reached.
+func (s *Server) waitForState(name string, timeout time.Duration, states ...ServiceState) (ServiceStatus, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		st, _ := s.serviceStatus(name)
+		for _, want := range states {
+			if st.State == want {
+				return st, true
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return st, false
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// parseTimeout reads a ?timeout= duration ("30s"; bare numbers are seconds).
+func parseTimeout(r *http.Request, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get("timeout")
+	if v == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d, nil
+	}
+	var secs int
+	if _, err := fmt.Sscanf(v, "%d", &secs); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid timeout %q (use e.g. 30s or 2m)", v)
+}
+
+// handleRestartTab restarts a tab-mode service (POST /restart/<service>?timeout=60s).
+func (s *Server) handleRestartTab(w http.ResponseWriter, r *http.Request, service string) {
+	timeout, err := parseTimeout(r, defaultReadyTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := s.RestartService(service, timeout)
+	resp.redact(s.redactFor(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// redact masks secrets in the parts of resp taken from logs (the last error line) or
+// built around them.
+func (resp *RestartResponse) redact(red *Redactor) {
+	resp.Message = red.Redact(resp.Message)
+	resp.LastError = red.Redact(resp.LastError)
+}
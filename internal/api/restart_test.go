@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		query string
+		want  time.Duration
+	}{
+		{"", defaultReadyTimeout},
+		{"?timeout=30s", 30 * time.Second},
+		{"?timeout=2m", 2 * time.Minute},
+		{"?timeout=45", 45 * time.Second},
+		{"?timeout=0", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeout(httptest.NewRequest("POST", "/restart/api"+tt.query, nil), defaultReadyTimeout)
+		if err != nil || got != tt.want {
+			t.Errorf("parseTimeout(%q) = %v, %v; want %v", tt.query, got, err, tt.want)
+		}
+	}
+	if _, err := parseTimeout(httptest.NewRequest("POST", "/restart/api?timeout=soon", nil), defaultReadyTimeout); err == nil {
+		t.Error("parseTimeout(soon) accepted")
+	}
+}
+
+// backdateRun moves the start of a service's latest run past readyGrace, so a run without
+// ports counts as ready at once.
+func backdateRun(t *testing.T, service string) {
+	t.Helper()
+	runID := latestRunID(logBaseDir, service)
+	rec, err := readRunRecord(logBaseDir, service, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := fmt.Sprintf("wrapper_pid=%d\nstarted=%d\n", rec.WrapperPID, time.Now().Add(-readyGrace).Unix())
+	if err := os.WriteFile(filepath.Join(logBaseDir, service, runID+".run"), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestartService(t *testing.T) {
+	dir := t.TempDir()
+	const name = "crux-test-restart"
+	newServer := func(start StartOneHandler) (*Server, *fakeTabs) {
+		s := NewServer(0)
+		tabs := newFakeTabs()
+		s.SetTabController(tabs)
+		s.SetServices([]ServiceSpec{{Name: name}})
+		if start != nil {
+			s.SetStartOneHandler(func(service string) (string, error) {
+				tabs.SpawnTab(service, dir, "sh", nil)
+				return start(service)
+			})
+		}
+		return s, tabs
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		s, tabs := newServer(func(service string) (string, error) {
+			startWrapped(t, service, dir, "sleep 300")
+			backdateRun(t, service)
+			return "Started " + service, nil
+		})
+		tabs.SpawnTab(name, dir, "sh", nil)
+		oldPID := startWrapped(t, name, dir, "sleep 300")
+		prev := latestRunID(logBaseDir, name)
+
+		resp := s.RestartService(name, 5*time.Second)
+		if !resp.Success || !resp.Ready || resp.State != StateReady || resp.Message != "Restarted "+name {
+			t.Fatalf("restart = %+v", resp)
+		}
+		if resp.PreviousRunID != prev || resp.RunID == prev || resp.RunID != latestRunID(logBaseDir, name) {
+			t.Errorf("runs: previous %s, new %s (old run %s)", resp.PreviousRunID, resp.RunID, prev)
+		}
+		if isProcessAlive(oldPID) {
+			t.Errorf("old run %d still running", oldPID)
+		}
+		if len(tabs.killed) != 1 || !tabs.open[name] {
+			t.Errorf("tabs: killed %v, open %v", tabs.killed, tabs.open)
+		}
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		s, _ := newServer(func(service string) (string, error) {
+			t.Cleanup(func() { os.RemoveAll(filepath.Join(logBaseDir, service)) })
+			runID := time.Now().Format(runFileLayout)
+			writeRun(t, logBaseDir, service, runID, "starting\npanic: listen tcp :8080 for hunter2: address already in use\n")
+			code := 2
+			writeRecord(t, logBaseDir, service, runID, 0, &code)
+			return "Started " + service, nil
+		})
+		red, _ := NewRedactor(nil, []string{"hunter2"})
+		s.SetRedactor(red, false)
+		rec := httptest.NewRecorder()
+		s.handleRestartTab(rec, httptest.NewRequest("POST", "/restart/"+name+"?timeout=5s", nil), name)
+		var resp RestartResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Success || resp.Ready || resp.State != StateCrashed || !strings.HasSuffix(resp.Message, "but the new run crashed") {
+			t.Fatalf("restart = %+v", resp)
+		}
+		if !strings.Contains(resp.LastError, "address already in use") || strings.Contains(rec.Body.String(), "hunter2") {
+			t.Errorf("last error = %q", resp.LastError)
+		}
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		s, _ := newServer(func(service string) (string, error) {
+			startWrapped(t, service, dir, "sleep 300")
+			return "Started " + service, nil
+		})
+		resp := s.RestartService(name, 200*time.Millisecond)
+		if !resp.Success || resp.Ready || resp.State != StateStarting || !strings.Contains(resp.Message, "not ready after 200ms") {
+			t.Fatalf("restart = %+v", resp)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s, _ := newServer(nil)
+		if resp := s.RestartService(name, 0); resp.Success || !strings.HasPrefix(resp.Message, "Restart not available") {
+			t.Errorf("without a start handler: %+v", resp)
+		}
+		s, _ = newServer(func(string) (string, error) { return "", errors.New("wezterm is gone") })
+		if resp := s.RestartService("nope", 0); resp.Success || resp.Message != `service "nope" not found in config` {
+			t.Errorf("unknown service: %+v", resp)
+		}
+		if resp := s.RestartService(name, 0); resp.Success || resp.Message != "stopped, but start failed: wezterm is gone" {
+			t.Errorf("failed start: %+v", resp)
+		}
+	})
+}
+
+func TestWaitForState(t *testing.T) {
+	s := NewServer(0)
+	s.SetServices([]ServiceSpec{{Name: "crux-test-wait-state"}})
+	start := time.Now()
+	if st, ok := s.waitForState("crux-test-wait-state", time.Second, StatePending); !ok || st.State != StatePending {
+		t.Errorf("pending: %+v, %v", st, ok)
+	}
+	if st, ok := s.waitForState("crux-test-wait-state", 600*time.Millisecond, StateReady, StateCrashed); ok || st.State != StatePending {
+		t.Errorf("ready: %+v, %v", st, ok)
+	}
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("waited %s, want the 600ms timeout", elapsed)
+	}
+}
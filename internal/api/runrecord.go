@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunRecord is what the wezterm wrapper writes to /tmp/crux-logs/<service>/<run>.run:
+// the wrapper's PID when the run starts, and exit code/time when the command ends.
+type RunRecord struct {
+	ID         string
+	WrapperPID int
+	Started    time.Time
+	ExitCode   *int
+	Exited     time.Time
+}
+
+// readRunRecord parses a run record. Missing files return an error; unknown keys are ignored.
+func readRunRecord(baseDir, service, runID string) (*RunRecord, error) {
+	f, err := os.Open(filepath.Join(baseDir, service, runID+".run"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rec := &RunRecord{ID: runID}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(val, 10, 64)
+		switch key {
+		case "wrapper_pid":
+			rec.WrapperPID = int(n)
+		case "started":
+			rec.Started = time.Unix(n, 0)
+		case "exit_code":
+			code := int(n)
+			rec.ExitCode = &code
+		case "exited":
+			rec.Exited = time.Unix(n, 0)
+		}
+	}
+	if rec.Started.IsZero() {
+		if t, err := time.ParseInLocation(runFileLayout, runID, time.Local); err == nil {
+			rec.Started = t
+		}
+	}
+	return rec, scanner.Err()
+}
+
+// latestRunID returns the run that latest.log points at ("" if the service never ran).
+func latestRunID(baseDir, service string) string {
+	target, err := os.Readlink(filepath.Join(baseDir, service, "latest.log"))
+	if err != nil {
+		runs := logRunFiles(baseDir, service)
+		if len(runs) == 0 {
+			return ""
+		}
+		target = runs[len(runs)-1]
+	}
+	return strings.TrimSuffix(filepath.Base(target), ".log")
+}
+
+// runIDsSince returns run IDs of a service that started at or after t.
+func runIDsSince(baseDir, service string, t time.Time) []string {
+	var ids []string
+	for _, f := range logRunFiles(baseDir, service) {
+		id := strings.TrimSuffix(filepath.Base(f), ".log")
+		started, err := time.ParseInLocation(runFileLayout, id, time.Local)
+		if err == nil && !started.Before(t.Truncate(time.Second)) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// procEntry is one row of the process table
+type procEntry struct {
+	PID  int
+	PPID int
+	Comm string
+}
+
+// processTable lists all processes via ps (works on macOS and Linux).
+func processTable() []procEntry {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,comm=").Output()
+	if err != nil {
+		return nil
+	}
+	var table []procEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		table = append(table, procEntry{PID: pid, PPID: ppid, Comm: filepath.Base(strings.Join(fields[2:], " "))})
+	}
+	return table
+}
+
+// servicePID finds the service's own process: the wrapper's child that isn't the tee logger.
+func servicePID(table []procEntry, wrapperPID int) int {
+	for _, p := range table {
+		if p.PPID == wrapperPID && p.Comm != "tee" {
+			return p.PID
+		}
+	}
+	return 0
+}
+
+// RunInfo is one run of a service in GET /runs/<service>
+type RunInfo struct {
+	ID       string    `json:"id"`
+	Started  time.Time `json:"started"`
+	Size     int64     `json:"size"`     // log size in bytes
+	Modified time.Time `json:"modified"` // last write to the log
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Latest   bool      `json:"latest,omitempty"`
+}
+
+// RunsResponse is the response for GET /runs/<service>
+type RunsResponse struct {
+	Service string    `json:"service"`
+	Runs    []RunInfo `json:"runs"` // newest first
+}
+
+// listRuns returns the logged runs of a service, newest first.
+func listRuns(baseDir, service string) []RunInfo {
+	files := logRunFiles(baseDir, service)
+	latest := latestRunID(baseDir, service)
+	runs := make([]RunInfo, 0, len(files))
+	for i := len(files) - 1; i >= 0; i-- {
+		id := strings.TrimSuffix(filepath.Base(files[i]), ".log")
+		run := RunInfo{ID: id, Latest: id == latest}
+		if info, err := os.Stat(files[i]); err == nil {
+			run.Size = info.Size()
+			run.Modified = info.ModTime()
+		}
+		if rec, err := readRunRecord(baseDir, service, id); err == nil {
+			run.Started = rec.Started
+			run.ExitCode = rec.ExitCode
+		} else if t, err := time.ParseInLocation(runFileLayout, id, time.Local); err == nil {
+			run.Started = t
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// handleRuns lists a service's runs with log size and exit code (GET /runs/<service>).
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	service := r.URL.Path[len("/runs/"):]
+	if service == "" {
+		http.Error(w, "Service name required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(service, "/") || strings.Contains(service, "..") {
+		http.Error(w, "Invalid service name", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RunsResponse{Service: service, Runs: listRuns(logBaseDir, service)})
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -28,6 +30,17 @@ type StatusResponse struct {
 	Workers      []WorkerInfo `json:"workers"`
 }
 
+// TabsResponse is the response for GET /tabs
+type TabsResponse struct {
+	Tabs   []TabInfo `json:"tabs"`
+	Uptime string    `json:"uptime"`
+}
+
+// HealthResponse is the response for GET /health
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
 // CommandResponse is the response for action endpoints
 type CommandResponse struct {
 	Success bool   `json:"success"`
@@ -63,22 +76,53 @@ type StartOneHandler func(serviceName string) (string, error)
 
 // Server is the HTTP API server for crux control
 type Server struct {
-	port           int
-	workers        []Worker
-	tabCtrl        TabController // for Wezterm mode - MCP uses this via API
-	startOneHdl    StartOneHandler
-	startTime      time.Time
-	mu             sync.RWMutex
-	server         *http.Server
-	onShutdown     func() // callback when shutdown is requested
+	port            int
+	workers         []Worker
+	tabCtrl         TabController // for Wezterm mode - MCP uses this via API
+	startOneHdl     StartOneHandler
+	startTime       time.Time
+	mu              sync.RWMutex
+	server          *http.Server
+	onShutdown      func() // callback when shutdown is requested
+	redactor        *Redactor
+	allowRaw        bool
+	services        []ServiceSpec
+	tasks           []TaskSpec
+	monitor         *ServiceMonitor
+	events          *EventBus
+	done            chan struct{} // closed by Stop to end background watchers
+	host            string        // TCP bind host (default 127.0.0.1)
+	socketPath      string        // optional Unix socket (no token needed)
+	socketServer    *http.Server
+	token           string // required on TCP requests when set
+	locksMu         sync.Mutex
+	serviceLocks    map[string]*sync.Mutex // per-service lifecycle locks (see serviceLock)
+	metrics         *metricsStore
+	metricsInterval time.Duration // 0 = don't sample
+	configPath      string        // config file the session was started from (GET /config)
+	configReloader  ConfigReloader
+	configMu        sync.Mutex      // serializes config edits and file checks (watchConfig)
+	configSeen      configFileState // file content last loaded or written by the session
+	execAllow       []string        // POST /exec allowlist (empty: exec off)
+	execTimeout     time.Duration   // default POST /exec timeout
 }
 
 // NewServer creates a new API server
 func NewServer(port int) *Server {
+	now := time.Now()
+	events := NewEventBus()
+	monitor := NewServiceMonitor(logBaseDir, now)
+	monitor.events = events
 	return &Server{
 		port:      port,
 		workers:   make([]Worker, 0),
-		startTime: time.Now(),
+		startTime: now,
+		monitor:   monitor,
+		events:    events,
+		done:      make(chan struct{}),
+
+		metrics:         newMetricsStore(DefaultMetricsHistory),
+		metricsInterval: DefaultMetricsInterval,
 	}
 }
 
@@ -108,12 +152,20 @@ func (s *Server) SetStartOneHandler(fn StartOneHandler) {
 	s.startOneHdl = fn
 }
 
-// Start starts the HTTP server
-func (s *Server) Start() error {
+// Handler returns the API as served over TCP (token auth applied when a token is set).
+func (s *Server) Handler() http.Handler {
+	return s.requireToken(s.routes())
+}
+
+func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	// Status endpoint
+	// Status endpoints
 	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/services", s.handleServices)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/metrics/", s.handleServiceMetrics)
 
 	// Reload endpoints
 	mux.HandleFunc("/reload", s.handleReloadAll)
@@ -137,18 +189,78 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/logfile/", s.handleLogfile)
 	mux.HandleFunc("/focus/", s.handleFocus)
 	mux.HandleFunc("/start-one/", s.handleStartOne)
+	mux.HandleFunc("/actions", s.handleActions)
+	mux.HandleFunc("/wait", s.handleWait)
+	mux.HandleFunc("/wait/", s.handleWait)
+	mux.HandleFunc("/tasks", s.handleTasks)
+	mux.HandleFunc("/tasks/", s.handleRunTask)
+	mux.HandleFunc("/exec/", s.handleExec)
+	mux.HandleFunc("/service-actions", s.handleServiceActions)
+	mux.HandleFunc("/service-actions/", s.handleServiceActions)
+	mux.HandleFunc("/timeline", s.handleTimeline)
+	mux.HandleFunc("/logdiff/", s.handleLogdiff)
+	mux.HandleFunc("/runs/", s.handleRuns)
+	mux.HandleFunc("/config", s.handleConfig)
+	mux.HandleFunc("/config/", s.handleConfig)
+
+	// API description
+	mux.HandleFunc("/openapi.yaml", s.handleOpenAPI)
+
+	return mux
+}
+
+// Start starts the HTTP server
+func (s *Server) Start() error {
+	mux := s.routes()
+	go s.watchServices(2*time.Second, s.done)
+	go s.watchConfig(configPollInterval, s.done)
 
+	s.mu.RLock()
+	host, socketPath := s.host, s.socketPath
+	metricsInterval := s.metricsInterval
+	s.mu.RUnlock()
+	if metricsInterval > 0 {
+		go s.watchMetrics(metricsInterval, s.done)
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(s.port))
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: mux,
+		Addr:    addr,
+		Handler: s.requireToken(mux),
+	}
+
+	if socketPath != "" {
+		os.Remove(socketPath) // stale socket from a previous session
+		ln, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return fmt.Errorf("listen on %s: %w", socketPath, err)
+		}
+		if err := os.Chmod(socketPath, 0600); err != nil {
+			ln.Close()
+			return err
+		}
+		s.socketServer = &http.Server{Handler: mux}
+		go s.socketServer.Serve(ln)
+		fmt.Printf("🌐 API server listening on unix:%s\n", socketPath)
 	}
 
-	fmt.Printf("🌐 API server starting on http://localhost:%d\n", s.port)
+	fmt.Printf("🌐 API server starting on http://%s\n", addr)
 	return s.server.ListenAndServe()
 }
 
 // Stop stops the HTTP server
 func (s *Server) Stop() error {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	if s.socketServer != nil {
+		s.socketServer.Close()
+		os.Remove(s.socketPath)
+	}
 	if s.server != nil {
 		return s.server.Close()
 	}
@@ -162,7 +274,7 @@ func (s *Server) GetPort() int {
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
 }
 
 // Tab-mode handlers (used by MCP - no wezterm knowledge in MCP)
@@ -184,9 +296,9 @@ func (s *Server) handleTabs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"tabs":   tabs,
-		"uptime": time.Since(s.startTime).Round(time.Second).String(),
+	json.NewEncoder(w).Encode(TabsResponse{
+		Tabs:   tabs,
+		Uptime: time.Since(s.startTime).Round(time.Second).String(),
 	})
 }
 
@@ -214,7 +326,7 @@ func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Tab controller not available", http.StatusServiceUnavailable)
 		return
 	}
-	err := tc.Send(service, body.Text)
+	err := s.sendInput(tc, service, body.Text)
 	resp := CommandResponse{Success: err == nil, Service: service, Message: "Sent"}
 	if err != nil {
 		resp.Message = err.Error()
@@ -223,6 +335,20 @@ func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// sendInput types text into a tab and publishes input.sent.
+func (s *Server) sendInput(tc TabController, service, text string) error {
+	if err := tc.Send(service, text); err != nil {
+		return err
+	}
+	// Only single keystrokes (r, R, q) are echoed; longer input may be a password typed into a prompt
+	data := map[string]interface{}{"length": len(text)}
+	if len(strings.TrimSpace(text)) <= 1 {
+		data["text"] = text
+	}
+	s.events.Publish(EventInputSent, service, data)
+	return nil
+}
+
 func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -242,6 +368,16 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	format, err := parseLogFormat(r, FormatRaw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jq, err := parseJSONLogQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	s.mu.RLock()
 	tc := s.tabCtrl
 	s.mu.RUnlock()
@@ -249,13 +385,19 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Tab controller not available", http.StatusServiceUnavailable)
 		return
 	}
-	content, err := tc.GetLogs(service, lines)
+	fetch := lines
+	if jq.Filtering() {
+		fetch = 1000 // filter over the whole allowed scrollback, then tail
+	}
+	content, err := tc.GetLogs(service, fetch)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write([]byte(content))
+	if jq.Active() {
+		content = tailLines(jq.Apply(content), lines)
+	}
+	s.writeLogText(w, r, content, format)
 }
 
 func (s *Server) handleLogfile(w http.ResponseWriter, r *http.Request) {
@@ -271,17 +413,33 @@ func (s *Server) handleLogfile(w http.ResponseWriter, r *http.Request) {
 			lines = parsed
 		}
 	}
-	content, err := handleLogfilePath(path, run, lines)
+	format, err := parseLogFormat(r, FormatRaw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jq, err := parseJSONLogQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fetch := lines
+	if jq.Filtering() {
+		fetch = math.MaxInt32 // filter the whole run, then tail
+	}
+	content, err := handleLogfilePath(path, run, fetch)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write([]byte(content))
+	if jq.Active() {
+		content = tailLines(jq.Apply(content), lines)
+	}
+	s.writeLogText(w, r, content, format)
 }
 
 func handleLogfilePath(service, run string, lines int) (string, error) {
-	baseDir := "/tmp/crux-logs"
+	baseDir := logBaseDir
 	if service == "list" || service == "" {
 		return listLogServices(baseDir), nil
 	}
@@ -325,7 +483,8 @@ func listLogServices(baseDir string) string {
 	return out.String()
 }
 
-func listLogRuns(baseDir, service string) string {
+// logRunFiles returns a service's run log paths, oldest first (latest.log symlink excluded).
+func logRunFiles(baseDir, service string) []string {
 	svcDir := baseDir + "/" + service
 	logs, _ := filepath.Glob(svcDir + "/*.log")
 	var realLogs []string
@@ -334,6 +493,11 @@ func listLogRuns(baseDir, service string) string {
 			realLogs = append(realLogs, l)
 		}
 	}
+	return realLogs
+}
+
+func listLogRuns(baseDir, service string) string {
+	realLogs := logRunFiles(baseDir, service)
 	if len(realLogs) == 0 {
 		return "No log files for " + service
 	}
@@ -559,10 +723,15 @@ func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	worker := s.findWorker(service)
+	tabMode := s.tabCtrl != nil
+	s.mu.RUnlock()
+
 	if worker == nil {
+		if tabMode {
+			s.handleRestartTab(w, r, service)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Service '%s' not found", service), http.StatusNotFound)
 		return
 	}
@@ -617,9 +786,10 @@ func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	worker := s.findWorker(service)
+	tc := s.tabCtrl
+	s.mu.RUnlock()
+
 	if worker != nil {
 		err := worker.SendCommand("q")
 		resp := CommandResponse{
@@ -634,13 +804,13 @@ func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(resp)
 		return
 	}
-	// Tab mode: use tab controller to kill the pane
-	if s.tabCtrl != nil {
-		err := s.tabCtrl.KillTab(service)
+	// Tab mode: stop the process gracefully (stop_signal/stop_command), then close the pane
+	if tc != nil {
+		msg, err := s.StopService(service)
 		resp := CommandResponse{
 			Success: err == nil,
 			Service: service,
-			Message: "Tab closed",
+			Message: msg,
 		}
 		if err != nil {
 			resp.Message = err.Error()
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Kinds of service action
+const (
+	ActionKindSend = "send" // type text into the service's tab
+	ActionKindExec = "exec" // run a command in the service's workdir and env
+	ActionKindTask = "task" // run a configured task
+)
+
+// ServiceAction is a named operation from a service's actions: section (reload, clear_cache,
+// reseed). Exactly one of Send, Exec and Task is set.
+type ServiceAction struct {
+	Name        string
+	Description string
+	Send        string // text typed into the tab, e.g. "r"
+	Exec        string // command line, split like POST /exec but not subject to exec.allow
+	Task        string // name of a configured task
+}
+
+// Kind returns what the action does and its argument (the text, command line or task name).
+func (a ServiceAction) Kind() (kind, target string) {
+	switch {
+	case a.Exec != "":
+		return ActionKindExec, a.Exec
+	case a.Task != "":
+		return ActionKindTask, a.Task
+	default:
+		return ActionKindSend, a.Send
+	}
+}
+
+// ServiceActionInfo is one entry of GET /service-actions
+type ServiceActionInfo struct {
+	Service     string `json:"service"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Kind        string `json:"kind"`   // send, exec or task
+	Target      string `json:"target"` // text sent, command line or task name
+}
+
+// ServiceActionsResponse is the response for GET /service-actions
+type ServiceActionsResponse struct {
+	Actions []ServiceActionInfo `json:"actions"`
+}
+
+// ServiceActionResult is the outcome of POST /service-actions/<service>/<action>.
+type ServiceActionResult struct {
+	Service   string `json:"service"`
+	Action    string `json:"action"`
+	Kind      string `json:"kind"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message,omitempty"`
+	ExitCode  *int   `json:"exit_code,omitempty"` // exec and task only
+	RunID     string `json:"run_id,omitempty"`
+	LogPath   string `json:"log_path,omitempty"`
+	Duration  string `json:"duration"`
+	Output    string `json:"output,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// errActionNotFound marks an action the service doesn't declare (404)
+var errActionNotFound = errors.New("action not found")
+
+// ServiceActions lists the actions of every service, in config order.
+func (s *Server) ServiceActions() []ServiceActionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	actions := []ServiceActionInfo{}
+	for _, spec := range s.services {
+		for _, a := range spec.Actions {
+			kind, target := a.Kind()
+			actions = append(actions, ServiceActionInfo{Service: spec.Name, Name: a.Name, Description: a.Description, Kind: kind, Target: target})
+		}
+	}
+	return actions
+}
+
+// RunServiceAction runs one of a service's configured actions and returns when it is done.
+// Exec actions run like POST /exec (logged to exec-<service>, exec.timeout applies) but need no
+// exec.allow entry: the config declared them. Task actions run the task like POST /tasks.
+func (s *Server) RunServiceAction(ctx context.Context, service, name string) (ServiceActionResult, error) {
+	s.mu.RLock()
+	spec, known := s.specFor(service)
+	tc := s.tabCtrl
+	timeout := s.execTimeout
+	s.mu.RUnlock()
+	if !known {
+		return ServiceActionResult{}, fmt.Errorf("%w: %s", errServiceNotInConfig, service)
+	}
+	var action *ServiceAction
+	for i := range spec.Actions {
+		if spec.Actions[i].Name == name {
+			action = &spec.Actions[i]
+			break
+		}
+	}
+	if action == nil {
+		return ServiceActionResult{}, fmt.Errorf("%w: %s has no action %q", errActionNotFound, service, name)
+	}
+	kind, target := action.Kind()
+	res := ServiceActionResult{Service: service, Action: name, Kind: kind}
+
+	switch kind {
+	case ActionKindSend:
+		if tc == nil {
+			return res, errTabsUnavailable
+		}
+		start := time.Now()
+		err := s.sendInput(tc, service, target)
+		res.Success, res.Message = err == nil, "Sent"
+		if err != nil {
+			res.Message = err.Error()
+		}
+		res.Duration = time.Since(start).Round(time.Millisecond).String()
+	case ActionKindExec:
+		argv, err := SplitCommandLine(target)
+		if err != nil {
+			return res, err
+		}
+		if len(argv) == 0 {
+			return res, fmt.Errorf("action %s: empty command", name)
+		}
+		if timeout <= 0 {
+			timeout = DefaultExecTimeout
+		}
+		out := s.execIn(ctx, spec, target, argv, timeout)
+		res.Success, res.Message, res.ExitCode = out.Success, out.Message, &out.ExitCode
+		res.RunID, res.LogPath, res.Duration = out.RunID, out.LogPath, out.Duration
+		res.Output, res.Truncated = out.Output, out.Truncated
+	case ActionKindTask:
+		// Like POST /tasks: a client that gives up must not kill a half-done task
+		out, err := s.RunTask(context.WithoutCancel(ctx), target)
+		if err != nil {
+			return res, err
+		}
+		res.Success, res.Message, res.ExitCode = out.Success, out.Message, &out.ExitCode
+		res.RunID, res.LogPath, res.Duration = out.RunID, out.LogPath, out.Duration
+		res.Output, res.Truncated = out.Output, out.Truncated
+	}
+	return res, nil
+}
+
+// handleServiceActions lists actions (GET /service-actions) or runs one
+// (POST /service-actions/<service>/<action>).
+func (s *Server) handleServiceActions(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/service-actions"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ServiceActionsResponse{Actions: s.ServiceActions()})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	service, name, ok := strings.Cut(rest, "/")
+	if !ok || service == "" || name == "" || strings.Contains(name, "/") {
+		http.Error(w, "Use /service-actions/<service>/<action>", http.StatusBadRequest)
+		return
+	}
+	res, err := s.RunServiceAction(r.Context(), service, name)
+	switch {
+	case errors.Is(err, errServiceNotInConfig), errors.Is(err, errActionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errTabsUnavailable):
+		http.Error(w, "Tab controller not available", http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, errTaskRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	red := s.redactFor(r)
+	res.Output = red.Redact(res.Output)
+	res.Message = red.Redact(res.Message)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
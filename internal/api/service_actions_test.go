@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServiceActions(t *testing.T) {
+	s := NewServer(0)
+	s.SetServices([]ServiceSpec{
+		{Name: "crux-test-actions", WorkDir: t.TempDir(), Actions: []ServiceAction{
+			{Name: "fail", Exec: "sh -c 'echo broken; exit 3'"},
+			{Name: "reload", Description: "Hot reload", Send: "r"},
+			{Name: "reseed", Task: "crux-test-seed"},
+		}},
+		{Name: "web"},
+	})
+	s.SetTasks([]TaskSpec{{Name: "crux-test-seed", Command: "echo", Args: []string{"seeded"}}})
+	t.Cleanup(func() {
+		os.RemoveAll(filepath.Join(logBaseDir, ExecLogName("crux-test-actions")))
+		os.RemoveAll(filepath.Join(logBaseDir, TaskLogName("crux-test-seed")))
+	})
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/service-actions")
+	var list ServiceActionsResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Actions) != 3 {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	if got := list.Actions[1]; got != (ServiceActionInfo{Service: "crux-test-actions", Name: "reload", Description: "Hot reload", Kind: ActionKindSend, Target: "r"}) {
+		t.Errorf("reload = %+v", got)
+	}
+
+	// exec actions don't need exec.allow: the config declared them
+	w = serve(http.MethodPost, "/service-actions/crux-test-actions/fail")
+	var res ServiceActionResult
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || res.Success || res.Kind != ActionKindExec || res.ExitCode == nil || *res.ExitCode != 3 || res.Output != "broken\n" {
+		t.Fatalf("fail: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(http.MethodPost, "/service-actions/crux-test-actions/reseed")
+	res = ServiceActionResult{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || !res.Success || res.Kind != ActionKindTask || res.Output != "seeded\n" || res.RunID == "" {
+		t.Fatalf("reseed: %d %s", w.Code, w.Body)
+	}
+
+	for target, code := range map[string]int{
+		"/service-actions/crux-test-actions/reload": http.StatusServiceUnavailable, // no tab controller
+		"/service-actions/crux-test-actions/nope":   http.StatusNotFound,
+		"/service-actions/nope/reload":              http.StatusNotFound,
+		"/service-actions/web":                      http.StatusBadRequest,
+	} {
+		if w := serve(http.MethodPost, target); w.Code != code {
+			t.Errorf("POST %s: %d %s, want %d", target, w.Code, w.Body, code)
+		}
+	}
+}
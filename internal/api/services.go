@@ -0,0 +1,422 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceState is a service's lifecycle state as reported by GET /services
+type ServiceState string
+
+const (
+	StatePending  ServiceState = "pending"  // configured, not started in this session
+	StateStarting ServiceState = "starting" // process alive, declared ports not yet listening
+	StateReady    ServiceState = "ready"    // process alive and ports listening (or past the start grace period)
+	StateCrashed  ServiceState = "crashed"  // exited non-zero, or died without recording an exit
+	StateExited   ServiceState = "exited"   // exited with code 0
+	StateStopped  ServiceState = "stopped"  // stopped through crux (/stop/<service>)
+)
+
+// readyGrace is how long a service without declared ports must stay up to count as ready
+const readyGrace = 3 * time.Second
+
+// notReadyAfter is how long a run may stay starting before service.not_ready is published
+const notReadyAfter = defaultReadyTimeout
+
+// ServiceSpec is what the API needs to know about a configured service
+type ServiceSpec struct {
+	Name        string
+	Ports       []int
+	Interactive bool
+	Groups      []string // selectable as a group in POST /actions
+	Stop        StopPolicy
+	WorkDir     string          // where POST /exec runs commands (empty: crux's working directory)
+	Env         []string        // KEY=value with $VAR expanded, added to crux's environment for /exec
+	Actions     []ServiceAction // from actions:, sorted by name
+}
+
+// ServiceStatus is one entry of GET /services
+type ServiceStatus struct {
+	Name         string         `json:"name"`
+	State        ServiceState   `json:"state"`
+	StateSince   time.Time      `json:"state_since"`
+	PID          int            `json:"pid,omitempty"`
+	WrapperPID   int            `json:"wrapper_pid,omitempty"`
+	ExitCode     *int           `json:"exit_code,omitempty"`
+	RestartCount int            `json:"restart_count"`
+	StartedAt    *time.Time     `json:"started_at,omitempty"`
+	Uptime       string         `json:"uptime,omitempty"`
+	Ports        []int          `json:"ports,omitempty"`
+	PortHolders  []PortHolder   `json:"port_holders,omitempty"` // who listens on the declared ports
+	Metrics      *MetricsSample `json:"metrics,omitempty"`      // latest CPU/memory sample of the running process tree
+	RunID        string         `json:"run_id,omitempty"`
+	LastError    string         `json:"last_error,omitempty"`
+	Interactive  bool           `json:"interactive,omitempty"`
+	HasTab       bool           `json:"has_tab"`
+	PaneID       string         `json:"pane_id,omitempty"`
+	LogPath      string         `json:"log_path,omitempty"`
+}
+
+// ServicesResponse is the response for GET /services
+type ServicesResponse struct {
+	Services []ServiceStatus `json:"services"`
+	Uptime   string          `json:"uptime"`
+}
+
+// trackedService is the state machine's memory for one service
+type trackedService struct {
+	state    ServiceState
+	since    time.Time
+	runID    string
+	stopped  bool   // set by /stop until a new run appears
+	notReady string // run for which service.not_ready was published
+}
+
+// ServiceMonitor derives service states from tabs and wrapper run records and keeps
+// per-service state across observations (so "ready" sticks for a run, and transitions
+// have a time).
+type ServiceMonitor struct {
+	baseDir      string
+	sessionStart time.Time
+	mu           sync.Mutex
+	tracked      map[string]*trackedService
+	events       *EventBus // transitions are published here (nil = not published)
+}
+
+// NewServiceMonitor creates a monitor reading run records under baseDir.
+func NewServiceMonitor(baseDir string, sessionStart time.Time) *ServiceMonitor {
+	return &ServiceMonitor{
+		baseDir:      baseDir,
+		sessionStart: sessionStart,
+		tracked:      make(map[string]*trackedService),
+	}
+}
+
+// MarkStopped records that crux itself stopped the service, so its exit isn't reported as a crash.
+func (m *ServiceMonitor) MarkStopped(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.track(name)
+	t.stopped = true
+	t.runID = latestRunID(m.baseDir, name) // a later run clears the flag
+}
+
+func (m *ServiceMonitor) track(name string) *trackedService {
+	t, ok := m.tracked[name]
+	if !ok {
+		t = &trackedService{state: StatePending, since: m.sessionStart}
+		m.tracked[name] = t
+	}
+	return t
+}
+
+// Observe computes the current status of every service. tabs may be nil when no tab
+// controller is available.
+func (m *ServiceMonitor) Observe(specs []ServiceSpec, tabs []TabInfo) []ServiceStatus {
+	tabByName := make(map[string]TabInfo, len(tabs))
+	for _, t := range tabs {
+		tabByName[t.Name] = t
+	}
+	procs := processTable()
+	now := time.Now()
+	var ports []int
+	for _, spec := range specs {
+		ports = append(ports, spec.Ports...)
+	}
+	holders := FindPortHolders(ports)
+	// Dial before locking: a slow connect must not hold up MarkStopped and other observers
+	listening := listeningPorts(ports)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ServiceStatus, 0, len(specs))
+	for _, spec := range specs {
+		tab, hasTab := tabByName[spec.Name]
+		st := ServiceStatus{
+			Name:        spec.Name,
+			Ports:       spec.Ports,
+			Interactive: spec.Interactive,
+			HasTab:      hasTab,
+			PaneID:      tab.PaneID,
+		}
+		t := m.track(spec.Name)
+		runs := runIDsSince(m.baseDir, spec.Name, m.sessionStart)
+		if len(runs) > 1 {
+			st.RestartCount = len(runs) - 1
+		}
+		st.RunID = latestRunID(m.baseDir, spec.Name)
+		if st.RunID != "" {
+			st.LogPath = filepath.Join(m.baseDir, spec.Name, "latest.log")
+		}
+		if st.RunID != t.runID {
+			t.stopped = false
+		}
+
+		next := m.observeOne(spec, &st, t, hasTab, len(runs) > 0, procs, holders, listening, now)
+		if len(spec.Ports) > 0 && st.PortHolders == nil {
+			st.PortHolders = portHoldersFor(spec.Ports, holders, nil)
+		}
+		if next != t.state || st.RunID != t.runID {
+			m.publishTransition(t, next, &st)
+			t.state = next
+			t.since = now
+			t.runID = st.RunID
+		} else if next == StateStarting && t.notReady != st.RunID && now.Sub(t.since) >= notReadyAfter {
+			m.publishNotReady(now.Sub(t.since), &st)
+			t.notReady = st.RunID
+		}
+		st.State = t.state
+		st.StateSince = t.since
+		out = append(out, st)
+	}
+	return out
+}
+
+// publishTransition emits events for a change from t's state/run to next/st.RunID.
+func (m *ServiceMonitor) publishTransition(t *trackedService, next ServiceState, st *ServiceStatus) {
+	if m.events == nil {
+		return
+	}
+	if st.RunID != t.runID && next != StatePending && next != StateStopped {
+		m.events.Publish(EventServiceSpawned, st.Name, map[string]interface{}{"run_id": st.RunID})
+		if t.runID != "" {
+			m.events.Publish(EventServiceRestarted, st.Name, map[string]interface{}{
+				"run_id": st.RunID, "previous_run_id": t.runID, "restart_count": st.RestartCount,
+			})
+		}
+	}
+	if next == t.state {
+		return
+	}
+	switch next {
+	case StateReady:
+		data := map[string]interface{}{"run_id": st.RunID}
+		if st.StartedAt != nil {
+			data["startup"] = time.Since(*st.StartedAt).Round(time.Millisecond).String()
+		}
+		m.events.Publish(EventServiceReady, st.Name, data)
+	case StateCrashed, StateExited:
+		data := map[string]interface{}{"run_id": st.RunID, "state": string(next)}
+		if st.ExitCode != nil {
+			data["exit_code"] = *st.ExitCode
+		}
+		if st.LastError != "" {
+			data["last_error"] = st.LastError
+		}
+		m.events.Publish(EventServiceExited, st.Name, data)
+	case StateStopped:
+		m.events.Publish(EventServiceStopped, st.Name, map[string]interface{}{"run_id": st.RunID})
+	}
+}
+
+// publishNotReady reports a run whose readiness check (its ports) still fails after waiting.
+func (m *ServiceMonitor) publishNotReady(waited time.Duration, st *ServiceStatus) {
+	if m.events == nil {
+		return
+	}
+	data := map[string]interface{}{"run_id": st.RunID, "waited": waited.Round(time.Second).String()}
+	if len(st.Ports) > 0 {
+		data["ports"] = st.Ports
+	}
+	if st.LastError != "" {
+		data["last_error"] = st.LastError
+	}
+	m.events.Publish(EventServiceNotReady, st.Name, data)
+}
+
+// observeOne fills process details into st and returns the state the service is in now.
+// listening holds the declared ports that accepted a connection.
+func (m *ServiceMonitor) observeOne(spec ServiceSpec, st *ServiceStatus, t *trackedService, hasTab, ranThisSession bool, procs []procEntry, holders map[int]PortHolder, listening map[int]bool, now time.Time) ServiceState {
+	if spec.Interactive {
+		// Interactive services run without the wrapper, so the tab is all we can see
+		switch {
+		case hasTab:
+			return StateReady
+		case t.stopped:
+			return StateStopped
+		case t.state == StatePending:
+			return StatePending
+		}
+		return StateExited
+	}
+	if !ranThisSession {
+		if t.stopped {
+			return StateStopped
+		}
+		return StatePending
+	}
+	rec, err := readRunRecord(m.baseDir, spec.Name, st.RunID)
+	if err != nil {
+		// Run started before the wrapper wrote records; fall back to the tab
+		if hasTab {
+			return StateReady
+		}
+		return StateExited
+	}
+	st.WrapperPID = rec.WrapperPID
+	st.ExitCode = rec.ExitCode
+	if !rec.Started.IsZero() {
+		started := rec.Started
+		st.StartedAt = &started
+	}
+	if rec.ExitCode != nil || !isProcessAlive(rec.WrapperPID) {
+		st.LastError = lastErrorLine(filepath.Join(m.baseDir, spec.Name, st.RunID+".log"))
+		switch {
+		case t.stopped:
+			return StateStopped
+		case rec.ExitCode != nil && *rec.ExitCode == 0:
+			return StateExited
+		}
+		return StateCrashed
+	}
+
+	st.PID = servicePID(procs, rec.WrapperPID)
+	st.Uptime = now.Sub(rec.Started).Round(time.Second).String()
+	st.LastError = lastErrorLine(filepath.Join(m.baseDir, spec.Name, st.RunID+".log"))
+	if len(spec.Ports) > 0 {
+		st.PortHolders = portHoldersFor(spec.Ports, holders, processTree(procs, rec.WrapperPID))
+	}
+	if t.state == StateReady && t.runID == st.RunID {
+		return StateReady // ready sticks for the lifetime of a run
+	}
+	if len(spec.Ports) > 0 {
+		// A port answering for someone else (a leftover from an earlier session) isn't ready
+		if h, taken := foreignHolder(st.PortHolders); taken {
+			st.LastError = fmt.Sprintf("port %d is held by %s", h.Port, h)
+			return StateStarting
+		}
+		for _, p := range spec.Ports {
+			if !listening[p] {
+				return StateStarting
+			}
+		}
+		return StateReady
+	}
+	if now.Sub(rec.Started) >= readyGrace {
+		return StateReady
+	}
+	return StateStarting
+}
+
+// listeningPorts returns the ports that accept TCP connections on localhost.
+func listeningPorts(ports []int) map[int]bool {
+	listening := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		if _, done := listening[p]; done {
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", p), 200*time.Millisecond)
+		listening[p] = err == nil
+		if err == nil {
+			conn.Close()
+		}
+	}
+	return listening
+}
+
+// lastErrorLine returns the last error-looking line in the tail of a run log.
+func lastErrorLine(logPath string) string {
+	const tailBytes = 16 * 1024
+	f, err := os.Open(logPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	offset := info.Size() - tailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return ""
+	}
+	lines := strings.Split(renderPlain(string(buf)), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if l := strings.TrimSpace(lines[i]); l != "" && errorLineRe.MatchString(l) {
+			if len(l) > 300 {
+				l = l[:300] + "..."
+			}
+			return l
+		}
+	}
+	return ""
+}
+
+// SetServices sets the configured services reported by GET /services
+func (s *Server) SetServices(specs []ServiceSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = specs
+}
+
+// Services returns the current status of all configured services (tab names are used
+// when no services were configured, e.g. tab-only sessions).
+func (s *Server) Services() []ServiceStatus {
+	s.mu.RLock()
+	specs := s.services
+	tc := s.tabCtrl
+	s.mu.RUnlock()
+
+	var tabs []TabInfo
+	if tc != nil {
+		tabs, _ = tc.ListTabs()
+	}
+	if len(specs) == 0 {
+		for _, t := range tabs {
+			specs = append(specs, ServiceSpec{Name: t.Name})
+		}
+	}
+	statuses := s.monitor.Observe(specs, tabs)
+	s.mu.RLock()
+	store := s.metrics
+	s.mu.RUnlock()
+	for i, st := range statuses {
+		if st.State == StateStarting || st.State == StateReady {
+			statuses[i].Metrics = store.latest(st.Name, st.RunID)
+		}
+	}
+	return statuses
+}
+
+// watchServices observes services periodically so state transitions reach the event bus
+// even when nobody is polling /services.
+func (s *Server) watchServices(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.Services()
+		}
+	}
+}
+
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	services := s.Services()
+	red := s.redactFor(r)
+	for i := range services {
+		services[i].LastError = red.Redact(services[i].LastError)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ServicesResponse{
+		Services: services,
+		Uptime:   time.Since(s.startTime).Round(time.Second).String(),
+	})
+}
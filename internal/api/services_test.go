@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeRecord writes the wrapper's .run record for a run.
+func writeRecord(t *testing.T, baseDir, service, runID string, wrapperPID int, exitCode *int) {
+	t.Helper()
+	record := fmt.Sprintf("wrapper_pid=%d\nstarted=%d\n", wrapperPID, time.Now().Unix())
+	if exitCode != nil {
+		record += fmt.Sprintf("exit_code=%d\nexited=%d\n", *exitCode, time.Now().Unix())
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, service, runID+".run"), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceMonitorTransitions(t *testing.T) {
+	base := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() // not listening until the run "binds" it below
+
+	start := time.Now().Add(-time.Minute)
+	m := NewServiceMonitor(base, start)
+	m.events = NewEventBus()
+	specs := []ServiceSpec{{Name: "api", Ports: []int{port}}}
+	observe := func(want ServiceState) ServiceStatus {
+		t.Helper()
+		st := m.Observe(specs, []TabInfo{{Name: "api"}})[0]
+		if st.State != want {
+			t.Fatalf("state = %s (last error %q), want %s", st.State, st.LastError, want)
+		}
+		return st
+	}
+	run := func(offset time.Duration) string {
+		return start.Add(offset).Format(runFileLayout)
+	}
+	code := func(n int) *int { return &n }
+
+	observe(StatePending)
+
+	run1 := run(10 * time.Second)
+	writeRun(t, base, "api", run1, "booting\n")
+	writeRecord(t, base, "api", run1, os.Getpid(), nil)
+	if st := observe(StateStarting); st.RunID != run1 || st.WrapperPID != os.Getpid() {
+		t.Errorf("starting status = %+v", st)
+	}
+
+	ln, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Skipf("port %d taken meanwhile: %v", port, err)
+	}
+	observe(StateReady)
+	ln.Close()
+	observe(StateReady) // ready sticks for the run
+
+	appendFile(t, filepath.Join(base, "api", run1+".log"), "panic: assignment to entry in nil map\n")
+	writeRecord(t, base, "api", run1, os.Getpid(), code(2))
+	if st := observe(StateCrashed); *st.ExitCode != 2 || st.LastError != "panic: assignment to entry in nil map" {
+		t.Errorf("crashed status = %+v", st)
+	}
+
+	run2 := run(20 * time.Second)
+	writeRun(t, base, "api", run2, "done\n")
+	writeRecord(t, base, "api", run2, os.Getpid(), code(0))
+	if st := observe(StateExited); st.RestartCount != 1 {
+		t.Errorf("restart count = %d, want 1", st.RestartCount)
+	}
+
+	run3 := run(30 * time.Second)
+	writeRun(t, base, "api", run3, "serving\n")
+	writeRecord(t, base, "api", run3, os.Getpid(), nil)
+	observe(StateStarting)
+	m.MarkStopped("api")
+	writeRecord(t, base, "api", run3, os.Getpid(), code(143))
+	observe(StateStopped) // stopped through crux: not a crash
+
+	var got []string
+	for _, ev := range m.events.Since(0) {
+		got = append(got, ev.Type)
+		if ev.Type == EventServiceExited {
+			got[len(got)-1] += ":" + ev.Data["state"].(string)
+		}
+	}
+	want := []string{
+		EventServiceSpawned, EventServiceReady, EventServiceExited + ":crashed",
+		EventServiceSpawned, EventServiceRestarted, EventServiceExited + ":exited",
+		EventServiceSpawned, EventServiceRestarted, EventServiceStopped,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q\nwant %q", got, want)
+	}
+}
+
+func TestServiceMonitorInteractive(t *testing.T) {
+	m := NewServiceMonitor(t.TempDir(), time.Now())
+	specs := []ServiceSpec{{Name: "shell", Interactive: true}}
+	if st := m.Observe(specs, nil)[0]; st.State != StatePending {
+		t.Fatalf("before the tab: %s", st.State)
+	}
+	if st := m.Observe(specs, []TabInfo{{Name: "shell"}})[0]; st.State != StateReady {
+		t.Fatalf("with a tab: %s", st.State)
+	}
+	if st := m.Observe(specs, nil)[0]; st.State != StateExited {
+		t.Fatalf("tab closed: %s", st.State)
+	}
+}
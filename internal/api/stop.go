@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults for StopPolicy
+const (
+	DefaultStopSignal  = syscall.SIGTERM
+	DefaultStopTimeout = 10 * time.Second
+)
+
+// StopPolicy is how a service is asked to exit before its tab is closed.
+type StopPolicy struct {
+	Signal  syscall.Signal // sent to the service process tree (default SIGTERM)
+	Timeout time.Duration  // how long to wait before SIGKILL (default 10s)
+	Command string         // optional shell command that stops the service, run instead of the signal
+	WorkDir string         // where Command runs
+}
+
+// stopSignals maps config names to signals for ParseSignal
+var stopSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"HUP":  syscall.SIGHUP,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// ParseSignal parses a signal name such as SIGTERM, TERM or sigint ("" = DefaultStopSignal).
+func ParseSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return DefaultStopSignal, nil
+	}
+	sig, ok := stopSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %q (use TERM, INT, QUIT, HUP, KILL, USR1 or USR2)", name)
+	}
+	return sig, nil
+}
+
+func signalName(sig syscall.Signal) string {
+	for name, s := range stopSignals {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return sig.String()
+}
+
+// processTree returns pid and all its descendants in the process table.
+func processTree(table []procEntry, pid int) []int {
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		for _, p := range table {
+			if p.PPID == tree[i] {
+				tree = append(tree, p.PID)
+			}
+		}
+	}
+	return tree
+}
+
+// StopService stops one service gracefully: stop_command or stop_signal, wait up to the
+// timeout for the run to exit, SIGKILL what is left, then close the tab. Returns a summary.
+func (s *Server) StopService(name string) (string, error) {
+	s.mu.RLock()
+	tc := s.tabCtrl
+	spec, _ := s.specFor(name)
+	s.mu.RUnlock()
+	if tc == nil {
+		return "", fmt.Errorf("tab controller not available")
+	}
+	s.monitor.MarkStopped(name)
+
+	summary := s.stopProcess(spec)
+	if err := tc.KillTab(name); err != nil {
+		if summary == "" {
+			return "", err
+		}
+		return summary + " (tab: " + err.Error() + ")", nil
+	}
+	if summary == "" {
+		return "Tab closed", nil
+	}
+	return summary + ", tab closed", nil
+}
+
+// StopAll stops every configured service in reverse config order, logging progress to stdout.
+// Services don't declare dependencies on each other (depends_on is only for tasks), so the start
+// order is the only dependency order there is: a service listed later may need earlier ones.
+// Dependencies (postgres, redis) are left running.
+func (s *Server) StopAll() {
+	s.mu.RLock()
+	specs := append([]ServiceSpec(nil), s.services...)
+	tc := s.tabCtrl
+	s.mu.RUnlock()
+	if tc == nil {
+		return
+	}
+	open := make(map[string]bool)
+	if tabs, err := tc.ListTabs(); err == nil {
+		for _, t := range tabs {
+			open[t.Name] = true
+		}
+	}
+	for i := len(specs) - 1; i >= 0; i-- {
+		if !open[specs[i].Name] {
+			continue
+		}
+		msg, err := s.StopService(specs[i].Name)
+		if err != nil {
+			fmt.Printf("  ⚠️  %s: %v\n", specs[i].Name, err)
+		} else {
+			fmt.Printf("  ⏹  %s: %s\n", specs[i].Name, msg)
+		}
+	}
+}
+
+// specFor returns the configured spec for a service (zero spec with the name if unknown). Caller holds s.mu.
+func (s *Server) specFor(name string) (ServiceSpec, bool) {
+	return specFrom(s.services, name)
+}
+
+func specFrom(specs []ServiceSpec, name string) (ServiceSpec, bool) {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return ServiceSpec{Name: name}, false
+}
+
+// stopProcess asks the service's current run to exit and waits for it. It returns "" when there is
+// no running wrapped process to stop (interactive services, already exited).
+func (s *Server) stopProcess(spec ServiceSpec) string {
+	policy := spec.Stop
+	if policy.Signal == 0 {
+		policy.Signal = DefaultStopSignal
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = DefaultStopTimeout
+	}
+	start := time.Now()
+
+	if spec.Interactive {
+		// No wrapper run record, so no PID: only stop_command can stop it before the tab closes
+		if policy.Command == "" {
+			return ""
+		}
+		if err := runStopCommand(policy); err != nil {
+			return "stop_command failed: " + err.Error()
+		}
+		return fmt.Sprintf("stop_command ran in %s", time.Since(start).Round(100*time.Millisecond))
+	}
+
+	runID := latestRunID(logBaseDir, spec.Name)
+	rec, err := readRunRecord(logBaseDir, spec.Name, runID)
+	if err != nil || rec.ExitCode != nil || !isProcessAlive(rec.WrapperPID) {
+		return ""
+	}
+	pid := servicePID(processTable(), rec.WrapperPID)
+	if pid == 0 {
+		return ""
+	}
+
+	how := signalName(policy.Signal)
+	if policy.Command != "" {
+		how = "stop_command"
+		if err := runStopCommand(policy); err != nil {
+			how = "stop_command failed (" + err.Error() + "), " + signalName(policy.Signal)
+			signalTree(pid, policy.Signal)
+		}
+	} else {
+		signalTree(pid, policy.Signal)
+	}
+	if waitExit(spec.Name, runID, pid, time.Until(start.Add(policy.Timeout))) {
+		return fmt.Sprintf("%s, exited in %s", how, time.Since(start).Round(100*time.Millisecond))
+	}
+	signalTree(pid, syscall.SIGKILL)
+	waitExit(spec.Name, runID, pid, 2*time.Second)
+	return fmt.Sprintf("%s, killed after %s timeout", how, policy.Timeout)
+}
+
+// runStopCommand runs a stop_command through the shell, bounded by the stop timeout.
+func runStopCommand(policy StopPolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", policy.Command)
+	cmd.Dir = policy.WorkDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// signalTree sends sig to pid and its descendants (e.g. the binary started by `go run`).
+func signalTree(pid int, sig syscall.Signal) {
+	for _, p := range processTree(processTable(), pid) {
+		syscall.Kill(p, sig)
+	}
+}
+
+// waitExit polls until the service process is gone or the wrapper recorded an exit code.
+func waitExit(service, runID string, pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !isProcessAlive(pid) {
+			return true
+		}
+		if rec, err := readRunRecord(logBaseDir, service, runID); err == nil && rec.ExitCode != nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeTabs is an in-memory TabController: a tab per open name, closed tabs recorded in order
+type fakeTabs struct {
+	mu     sync.Mutex
+	open   map[string]bool
+	killed []string
+}
+
+func newFakeTabs(names ...string) *fakeTabs {
+	f := &fakeTabs{open: make(map[string]bool)}
+	for _, name := range names {
+		f.open[name] = true
+	}
+	return f
+}
+
+func (f *fakeTabs) ListTabs() ([]TabInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tabs []TabInfo
+	for name := range f.open {
+		tabs = append(tabs, TabInfo{Name: name})
+	}
+	sort.Slice(tabs, func(i, j int) bool { return tabs[i].Name < tabs[j].Name })
+	return tabs, nil
+}
+func (f *fakeTabs) Send(service, text string) error                   { return nil }
+func (f *fakeTabs) GetLogs(service string, lines int) (string, error) { return "", nil }
+func (f *fakeTabs) Focus(service string) error                        { return nil }
+func (f *fakeTabs) SpawnTab(title, workDir, command string, args []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.open[title] = true
+	return nil
+}
+func (f *fakeTabs) KillTab(service string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.open, service)
+	f.killed = append(f.killed, service)
+	return nil
+}
+
+// startWrapped runs script under sh like the log wrapper does (the service is the shell's
+// child) and writes the run record for it under logBaseDir. It returns the service's PID.
+func startWrapped(t *testing.T, service, dir, script string) int {
+	t.Helper()
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(logBaseDir, service)) })
+	wrapper := exec.Command("sh", "-c", script+"; true")
+	wrapper.Dir = dir
+	if err := wrapper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go wrapper.Wait()
+	t.Cleanup(func() { signalTree(wrapper.Process.Pid, syscall.SIGKILL) })
+
+	runID := time.Now().Format(runFileLayout)
+	writeRun(t, logBaseDir, service, runID, "")
+	writeRecord(t, logBaseDir, service, runID, wrapper.Process.Pid, nil)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if pid := servicePID(processTable(), wrapper.Process.Pid); pid != 0 {
+			return pid
+		}
+	}
+	t.Fatalf("%s: the service process never started", service)
+	return 0
+}
+
+func TestParseSignal(t *testing.T) {
+	for in, want := range map[string]syscall.Signal{
+		"":        syscall.SIGTERM,
+		"SIGINT":  syscall.SIGINT,
+		"term":    syscall.SIGTERM,
+		"sigQuit": syscall.SIGQUIT,
+	} {
+		got, err := ParseSignal(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSignal(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseSignal("SIGFOO"); err == nil {
+		t.Error("ParseSignal(SIGFOO) should fail")
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	table := []procEntry{
+		{PID: 10, PPID: 1, Comm: "bash"},
+		{PID: 11, PPID: 10, Comm: "go"},
+		{PID: 12, PPID: 10, Comm: "tee"},
+		{PID: 13, PPID: 11, Comm: "server"},
+		{PID: 14, PPID: 13, Comm: "worker"},
+		{PID: 20, PPID: 1, Comm: "other"},
+	}
+	got := processTree(table, 11)
+	want := []int{11, 13, 14}
+	if len(got) != len(want) {
+		t.Fatalf("processTree = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("processTree = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestStopService(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		script string
+		stop   StopPolicy
+		want   string // summary prefix
+	}{
+		{"crux-test-stop-signal", "sleep 300", StopPolicy{}, "SIGTERM, exited in "},
+		{"crux-test-stop-int", "sleep 300", StopPolicy{Signal: syscall.SIGINT}, "SIGINT, exited in "},
+		// TERM only kills the sleeps; the loop goes on until SIGKILL
+		{"crux-test-stop-kill", `sh -c 'trap "" TERM; while :; do sleep 0.1; done'`, StopPolicy{Timeout: 500 * time.Millisecond}, "SIGTERM, killed after 500ms timeout"},
+		{"crux-test-stop-command", "while [ ! -f stop ]; do sleep 0.1; done", StopPolicy{Command: "touch stop", WorkDir: dir}, "stop_command, exited in "},
+		{"crux-test-stop-failed", "sleep 300", StopPolicy{Command: "echo nope; exit 1", WorkDir: dir}, "stop_command failed (exit status 1: nope), SIGTERM, exited in "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pid := startWrapped(t, tt.name, dir, tt.script)
+			s := NewServer(0)
+			tabs := newFakeTabs(tt.name)
+			s.SetTabController(tabs)
+			s.SetServices([]ServiceSpec{{Name: tt.name, Stop: tt.stop}})
+
+			msg, err := s.StopService(tt.name)
+			if err != nil || !strings.HasPrefix(msg, tt.want) || !strings.HasSuffix(msg, ", tab closed") {
+				t.Fatalf("StopService = %q, %v; want %q...", msg, err, tt.want)
+			}
+			if isProcessAlive(pid) {
+				t.Errorf("service process %d still running", pid)
+			}
+			if len(tabs.killed) != 1 {
+				t.Errorf("tabs closed: %v", tabs.killed)
+			}
+		})
+	}
+}
+
+func TestStopAllOrder(t *testing.T) {
+	s := NewServer(0)
+	tabs := newFakeTabs("db-migrator", "api", "web")
+	s.SetTabController(tabs)
+	s.SetServices([]ServiceSpec{{Name: "db-migrator"}, {Name: "api"}, {Name: "worker"}, {Name: "web"}})
+	s.StopAll()
+	if want := []string{"web", "api", "db-migrator"}; strings.Join(tabs.killed, ",") != strings.Join(want, ",") {
+		t.Errorf("stopped %v, want %v", tabs.killed, want)
+	}
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultTaskTimeout bounds a task run unless the task sets its own timeout
+const DefaultTaskTimeout = 10 * time.Minute
+
+// taskOutputLimit is how much of a task's output (the tail) is returned to API clients
+const taskOutputLimit = 32 * 1024
+
+// taskKeepRuns is how many task logs are kept per task (same as the service wrapper)
+const taskKeepRuns = 10
+
+// TaskSpec is a one-off command from the config's tasks: section (migrate, seed, codegen...).
+type TaskSpec struct {
+	Name        string
+	Description string
+	Command     string
+	Args        []string
+	WorkDir     string
+	Env         []string // KEY=value, added to crux's environment
+	Requires    []TaskRequirement
+	Timeout     time.Duration // default DefaultTaskTimeout
+	LogName     string        // log directory under /tmp/crux-logs (default TaskLogName(Name))
+}
+
+// TaskRequirement is something that must be up before a task runs: a dependency (Check is its
+// check command) or a service (Check is empty; the service must be ready).
+type TaskRequirement struct {
+	Name  string
+	Check string
+}
+
+// TaskResult is the outcome of a task run (POST /tasks/<name>)
+type TaskResult struct {
+	Task      string `json:"task"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message,omitempty"` // why it did not run or did not finish
+	ExitCode  int    `json:"exit_code"`         // -1 when the command could not start or was killed
+	RunID     string `json:"run_id,omitempty"`
+	LogPath   string `json:"log_path,omitempty"`
+	Duration  string `json:"duration"`
+	Output    string `json:"output"`              // combined stdout/stderr (tail when truncated)
+	Truncated bool   `json:"truncated,omitempty"` // output is the last 32KB only
+}
+
+// TaskInfo is one entry of GET /tasks
+type TaskInfo struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Command      string   `json:"command"`
+	DependsOn    []string `json:"depends_on,omitempty"`
+	Running      bool     `json:"running"`
+	LastRunID    string   `json:"last_run_id,omitempty"`
+	LastExitCode *int     `json:"last_exit_code,omitempty"`
+}
+
+// TasksResponse is the response for GET /tasks
+type TasksResponse struct {
+	Tasks []TaskInfo `json:"tasks"`
+}
+
+// TaskLogName is the directory under /tmp/crux-logs a task logs to, so its runs can be read
+// with /logfile and /timeline like a service's.
+func TaskLogName(task string) string {
+	return "task-" + task
+}
+
+// CommandLine renders the task command for display.
+func (t TaskSpec) CommandLine() string {
+	parts := []string{t.Command}
+	for _, arg := range t.Args {
+		if strings.ContainsAny(arg, " \t\"'") {
+			arg = "'" + arg + "'"
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// CheckTaskRequirements returns an error naming the first requirement that is not up.
+// serviceState reports the state of a service requirement.
+func CheckTaskRequirements(spec TaskSpec, serviceState func(name string) (ServiceState, error)) error {
+	for _, req := range spec.Requires {
+		if req.Check != "" {
+			if err := exec.Command("sh", "-c", req.Check).Run(); err != nil {
+				return fmt.Errorf("dependency %s is not running (check: %s)", req.Name, req.Check)
+			}
+			continue
+		}
+		state, err := serviceState(req.Name)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", req.Name, err)
+		}
+		if state != StateReady {
+			return fmt.Errorf("service %s is %s, not ready", req.Name, state)
+		}
+	}
+	return nil
+}
+
+// RunTask runs a task to completion (or its timeout), logging like the service wrapper does to
+// /tmp/crux-logs/task-<name>/<run>.log with a .run record and latest.log. live, if not nil, also
+// receives the output as it is produced. Requirements are not checked here.
+func RunTask(ctx context.Context, spec TaskSpec, live io.Writer) TaskResult {
+	start := time.Now()
+	res := TaskResult{Task: spec.Name, ExitCode: -1}
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTaskTimeout
+	}
+	finish := func() TaskResult {
+		res.Duration = time.Since(start).Round(100 * time.Millisecond).String()
+		return res
+	}
+
+	name := spec.LogName
+	if name == "" {
+		name = TaskLogName(spec.Name)
+	}
+	logDir := filepath.Join(logBaseDir, name)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		res.Message = err.Error()
+		return finish()
+	}
+	avoidRunIDReuse(latestRunID(logBaseDir, name))
+	res.RunID = time.Now().Format(runFileLayout)
+	res.LogPath = filepath.Join(logDir, res.RunID+".log")
+	logFile, err := os.Create(res.LogPath)
+	if err != nil {
+		res.Message = err.Error()
+		return finish()
+	}
+	defer logFile.Close()
+	latest := filepath.Join(logDir, "latest.log")
+	os.Remove(latest)
+	os.Symlink(res.LogPath, latest)
+	pruneTaskRuns(logDir)
+
+	fmt.Fprintf(logFile, "=== crux task: %s ===\nCommand: %s\nStarted: %s\nLog: %s\n================================\n",
+		spec.Name, spec.CommandLine(), start.Format(time.UnixDate), res.LogPath)
+	tail := &tailBuffer{limit: taskOutputLimit}
+	writers := []io.Writer{logFile, tail}
+	if live != nil {
+		writers = append(writers, live)
+	}
+	out := &lockedWriter{w: io.MultiWriter(writers...)}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, spec.Command, spec.Args...)
+	cmd.Dir = spec.WorkDir
+	cmd.Env = append(os.Environ(), spec.Env...)
+	cmd.Stdout, cmd.Stderr = out, out
+	// Own process group, so a timeout also kills what the command started (go run, npm scripts)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+
+	runFile := filepath.Join(logDir, res.RunID+".run")
+	if err := cmd.Start(); err != nil {
+		res.Message = "failed to start: " + err.Error()
+		fmt.Fprintf(logFile, "%s\n", res.Message)
+		return finish()
+	}
+	os.WriteFile(runFile, []byte(fmt.Sprintf("run=%s\nwrapper_pid=%d\nstarted=%d\n", res.RunID, cmd.Process.Pid, start.Unix())), 0644)
+	err = cmd.Wait()
+
+	var exitErr *exec.ExitError
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded:
+		res.Message = fmt.Sprintf("timed out after %s", timeout)
+	case ctx.Err() != nil:
+		res.Message = "canceled"
+	case err == nil:
+		res.ExitCode = 0
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	default:
+		res.Message = err.Error()
+	}
+	res.Success = res.ExitCode == 0 && res.Message == ""
+	if f, err := os.OpenFile(runFile, os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		fmt.Fprintf(f, "exit_code=%d\nexited=%d\n", res.ExitCode, time.Now().Unix())
+		f.Close()
+	}
+	if res.Message != "" {
+		fmt.Fprintf(logFile, "\n=== crux: %s ===\n", res.Message)
+	}
+	fmt.Fprintf(logFile, "\n=== Exited with code %d at %s ===\n", res.ExitCode, time.Now().Format(time.UnixDate))
+	res.Output, res.Truncated = tail.String(), tail.truncated
+	return finish()
+}
+
+// pruneTaskRuns keeps the newest taskKeepRuns logs (and run records) in a task's log dir.
+func pruneTaskRuns(dir string) {
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	var runs []string
+	for _, l := range logs {
+		if filepath.Base(l) != "latest.log" {
+			runs = append(runs, l)
+		}
+	}
+	sort.Strings(runs) // run ids sort by time
+	for i := 0; i < len(runs)-taskKeepRuns; i++ {
+		os.Remove(runs[i])
+		os.Remove(strings.TrimSuffix(runs[i], ".log") + ".run")
+	}
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string { return string(t.buf) }
+
+// lockedWriter serializes writes from the stdout and stderr copiers.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// SetTasks sets the tasks runnable through POST /tasks/<name>
+func (s *Server) SetTasks(tasks []TaskSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = tasks
+}
+
+func (s *Server) taskFor(name string) (TaskSpec, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tasks {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return TaskSpec{}, false
+}
+
+// errTaskRunning is returned by RunTask when the task is already running
+var errTaskRunning = errors.New("task is already running")
+
+// RunTask runs a configured task after checking its requirements. Only one run of a task
+// happens at a time; a second request gets errTaskRunning.
+func (s *Server) RunTask(ctx context.Context, name string) (TaskResult, error) {
+	spec, ok := s.taskFor(name)
+	if !ok {
+		return TaskResult{}, fmt.Errorf("task %q not found in config", name)
+	}
+	lock := s.serviceLock("task:" + name)
+	if !lock.TryLock() {
+		return TaskResult{}, errTaskRunning
+	}
+	defer lock.Unlock()
+
+	err := CheckTaskRequirements(spec, func(svc string) (ServiceState, error) {
+		st, ok := s.serviceStatus(svc)
+		if !ok {
+			return "", fmt.Errorf("not in config")
+		}
+		return st.State, nil
+	})
+	if err != nil {
+		return TaskResult{Task: name, ExitCode: -1, Message: err.Error(), Duration: "0s"}, nil
+	}
+
+	s.events.Publish(EventTaskStarted, name, map[string]interface{}{"command": spec.CommandLine()})
+	res := RunTask(ctx, spec, nil)
+	data := map[string]interface{}{"exit_code": res.ExitCode, "run_id": res.RunID, "duration": res.Duration}
+	if res.Message != "" {
+		data["message"] = res.Message
+	}
+	s.events.Publish(EventTaskFinished, name, data)
+	return res, nil
+}
+
+// handleTasks lists configured tasks (GET /tasks).
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	tasks := append([]TaskSpec(nil), s.tasks...)
+	s.mu.RUnlock()
+
+	resp := TasksResponse{Tasks: make([]TaskInfo, 0, len(tasks))}
+	for _, t := range tasks {
+		info := TaskInfo{Name: t.Name, Description: t.Description, Command: t.CommandLine()}
+		for _, req := range t.Requires {
+			info.DependsOn = append(info.DependsOn, req.Name)
+		}
+		lock := s.serviceLock("task:" + t.Name)
+		if lock.TryLock() {
+			lock.Unlock()
+		} else {
+			info.Running = true
+		}
+		logName := TaskLogName(t.Name)
+		if info.LastRunID = latestRunID(logBaseDir, logName); info.LastRunID != "" {
+			if rec, err := readRunRecord(logBaseDir, logName, info.LastRunID); err == nil {
+				info.LastExitCode = rec.ExitCode
+			}
+		}
+		resp.Tasks = append(resp.Tasks, info)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleRunTask runs a task and responds when it finishes (POST /tasks/<name>).
+func (s *Server) handleRunTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Path[len("/tasks/"):]
+	if name == "" {
+		http.Error(w, "Task name required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.taskFor(name); !ok {
+		http.Error(w, fmt.Sprintf("Task '%s' not found", name), http.StatusNotFound)
+		return
+	}
+	// Not tied to the request: a client that gives up must not kill a half-done migration
+	res, err := s.RunTask(context.Background(), name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if red := s.redactFor(r); red != nil {
+		res.Output = red.Redact(res.Output)
+		res.Message = red.Redact(res.Message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTask(t *testing.T) {
+	spec := TaskSpec{
+		Name:    "crux-test-task",
+		Command: "sh",
+		Args:    []string{"-c", `echo "hello $WHO"; echo oops >&2; exit 3`},
+		Env:     []string{"WHO=tasks"},
+	}
+	dir := filepath.Join(logBaseDir, TaskLogName(spec.Name))
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	res := RunTask(context.Background(), spec, nil)
+	if res.Success || res.ExitCode != 3 || res.Message != "" {
+		t.Fatalf("result = %+v, want exit code 3", res)
+	}
+	if res.Output != "hello tasks\noops\n" {
+		t.Errorf("output = %q", res.Output)
+	}
+	rec, err := readRunRecord(logBaseDir, TaskLogName(spec.Name), res.RunID)
+	if err != nil || rec.ExitCode == nil || *rec.ExitCode != 3 {
+		t.Fatalf("run record = %+v, %v", rec, err)
+	}
+	if got := latestRunID(logBaseDir, TaskLogName(spec.Name)); got != res.RunID {
+		t.Errorf("latest run = %q, want %q", got, res.RunID)
+	}
+	data, _ := os.ReadFile(res.LogPath)
+	if !strings.Contains(string(data), "=== Exited with code 3") {
+		t.Errorf("log missing exit line:\n%s", data)
+	}
+}
+
+func TestRunTask_Timeout(t *testing.T) {
+	spec := TaskSpec{Name: "crux-test-timeout", Command: "sh", Args: []string{"-c", "sleep 5 & wait"}, Timeout: 300 * time.Millisecond}
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(logBaseDir, TaskLogName(spec.Name))) })
+
+	start := time.Now()
+	res := RunTask(context.Background(), spec, nil)
+	if res.Success || !strings.Contains(res.Message, "timed out") || res.ExitCode != -1 {
+		t.Fatalf("result = %+v, want timeout", res)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("took %s; the process group should have been killed", time.Since(start))
+	}
+}
+
+func TestCheckTaskRequirements(t *testing.T) {
+	states := map[string]ServiceState{"api": StateReady, "web": StateStarting}
+	lookup := func(name string) (ServiceState, error) { return states[name], nil }
+
+	ok := TaskSpec{Requires: []TaskRequirement{{Name: "fs", Check: "true"}, {Name: "api"}}}
+	if err := CheckTaskRequirements(ok, lookup); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, req := range []TaskRequirement{{Name: "db", Check: "false"}, {Name: "web"}} {
+		err := CheckTaskRequirements(TaskSpec{Requires: []TaskRequirement{req}}, lookup)
+		if err == nil || !strings.Contains(err.Error(), req.Name) {
+			t.Errorf("requirement %+v: err = %v", req, err)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{limit: 5}
+	b.Write([]byte("abc"))
+	b.Write([]byte("defg"))
+	if b.String() != "cdefg" || !b.truncated {
+		t.Errorf("tail = %q, truncated = %v", b.String(), b.truncated)
+	}
+}
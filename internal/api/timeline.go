@@ -0,0 +1,278 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logBaseDir is where the wezterm wrapper persists service output
+const logBaseDir = "/tmp/crux-logs"
+
+// runFileLayout is the timestamp format the wrapper uses for run file names
+const runFileLayout = "2006-01-02_150405"
+
+var (
+	// isoTimeRe matches ISO-8601 / RFC3339-ish timestamps (2024-02-11T14:30:22.123Z, 2024-02-11 14:30:22)
+	isoTimeRe = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`)
+	// clockTimeRe matches a bare wall clock (14:30:22 or 14:30:22.123), dated by the run file
+	clockTimeRe = regexp.MustCompile(`\b(\d{2}):(\d{2}):(\d{2})(?:[.,](\d{1,9}))?\b`)
+)
+
+// TimelineLine is one log line placed on the merged timeline
+type TimelineLine struct {
+	Time    time.Time
+	Service string
+	Text    string // in the requested format: escaped HTML for html
+}
+
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var services []string
+	for _, name := range strings.Split(q.Get("services"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			services = append(services, name)
+		}
+	}
+	since := time.Now().Add(-5 * time.Minute)
+	if v := q.Get("since"); v != "" {
+		parsed, err := parseSince(v, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	lines := 200
+	if n := q.Get("lines"); n != "" {
+		if parsed, err := strconv.Atoi(n); err == nil && parsed > 0 {
+			lines = parsed
+			if lines > 1000 {
+				lines = 1000
+			}
+		}
+	}
+
+	format, err := parseLogFormat(r, FormatPlain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	red := s.redactFor(r)
+	entries, skipped, err := buildTimeline(logBaseDir, services, since, format, red)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if len(entries) > lines {
+		entries = entries[len(entries)-lines:]
+	}
+	var note string
+	if len(skipped) > 0 {
+		w.Header().Set("X-Crux-Skipped", strings.Join(skipped, ","))
+		note = fmt.Sprintf("(no logs for %s)\n", strings.Join(skipped, ", "))
+	}
+	if format == FormatHTML {
+		// Lines were redacted before rendering; markup would hide secrets from the redactor
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<pre class="crux-log">` + formatTimeline(entries, true) + html.EscapeString(note) + "</pre>\n"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(red.Redact(formatTimeline(entries, false) + note)))
+}
+
+// parseSince accepts a duration ("2m", "90s") relative to now, or an absolute RFC3339 time.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q (use a duration like 2m or an RFC3339 time)", v)
+}
+
+// buildTimeline reads every run file touched since the cutoff for the given services
+// (all services with logs if none are given) and merges their lines in time order.
+// Works purely on persisted run files, so crashed and closed services are included.
+// Except for raw, each file is rendered (escape codes, \r progress) before splitting into lines;
+// html lines are redacted with red first, other formats are left for the caller to redact.
+// Named services without logs are skipped and returned; it is an error only if none has logs.
+func buildTimeline(baseDir string, services []string, since time.Time, format string, red *Redactor) ([]TimelineLine, []string, error) {
+	if len(services) == 0 {
+		entries, err := os.ReadDir(baseDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("no crux logs found in %s", baseDir)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				services = append(services, e.Name())
+			}
+		}
+	}
+	var all []TimelineLine
+	var skipped []string
+	for _, svc := range services {
+		runs, err := runFilesSince(baseDir, svc, since)
+		if err != nil {
+			skipped = append(skipped, svc)
+			continue
+		}
+		for _, run := range runs {
+			lines, err := timestampRunFile(svc, run, format, red)
+			if err != nil {
+				continue
+			}
+			for _, l := range lines {
+				if !l.Time.Before(since) {
+					all = append(all, l)
+				}
+			}
+		}
+	}
+	if len(services) > 0 && len(skipped) == len(services) {
+		return nil, nil, fmt.Errorf("no logs for %s", strings.Join(skipped, ", "))
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	return all, skipped, nil
+}
+
+// runFilesSince returns a service's run files (oldest first) that were written after the cutoff.
+func runFilesSince(baseDir, service string, since time.Time) ([]string, error) {
+	svcDir := filepath.Join(baseDir, service)
+	if _, err := os.Stat(svcDir); err != nil {
+		return nil, fmt.Errorf("no logs for %s", service)
+	}
+	logs, _ := filepath.Glob(svcDir + "/*.log")
+	var runs []string
+	for _, l := range logs {
+		if filepath.Base(l) == "latest.log" {
+			continue
+		}
+		info, err := os.Stat(l)
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		runs = append(runs, l)
+	}
+	sort.Strings(runs) // timestamped names sort chronologically
+	return runs, nil
+}
+
+// timestampRunFile assigns a time to every line of a run file. Lines carrying their own
+// timestamp use it; the rest inherit the previous line's time, starting from the run start
+// encoded in the file name. Times are read from the plain text, whatever the format.
+func timestampRunFile(service, path, format string, red *Redactor) ([]TimelineLine, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plain, texts []string
+	switch format {
+	case FormatRaw:
+		plain = strings.Split(strings.TrimRight(string(raw), "\n"), "\n")
+		texts = plain
+	case FormatHTML:
+		sc := newScreen()
+		sc.feed(red.Redact(string(raw)))
+		plain, texts = sc.plainLines(), sc.htmlLines()
+	default:
+		sc := newScreen()
+		sc.feed(string(raw))
+		plain = sc.plainLines()
+		texts = plain
+	}
+	for len(plain) > 1 && plain[len(plain)-1] == "" {
+		plain, texts = plain[:len(plain)-1], texts[:len(texts)-1]
+	}
+	info, _ := os.Stat(path)
+	runStart, err := time.ParseInLocation(runFileLayout, strings.TrimSuffix(filepath.Base(path), ".log"), time.Local)
+	if err != nil && info != nil {
+		runStart = info.ModTime()
+	}
+	current := runStart
+	var out []TimelineLine
+	for i, text := range texts {
+		if t, ok := lineTime(plain[i], current); ok {
+			current = t
+		}
+		out = append(out, TimelineLine{Time: current, Service: service, Text: text})
+	}
+	return out, nil
+}
+
+// lineTime extracts a timestamp from a log line. Bare clock times take the date of ref
+// and roll over to the next day if they would go backwards past midnight.
+func lineTime(text string, ref time.Time) (time.Time, bool) {
+	if m := isoTimeRe.FindString(text); m != "" {
+		m = strings.Replace(m, ",", ".", 1)
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z0700"} {
+			if t, err := time.Parse(layout, m); err == nil {
+				return t, true
+			}
+		}
+		m = strings.Replace(m, " ", "T", 1)
+		if t, err := time.ParseInLocation("2006-01-02T15:04:05.999999999", m, time.Local); err == nil {
+			return t, true
+		}
+	}
+	if m := clockTimeRe.FindStringSubmatch(text); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		min, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.Atoi(m[3])
+		if h > 23 || min > 59 || sec > 59 {
+			return time.Time{}, false
+		}
+		var nsec int
+		if m[4] != "" {
+			frac := (m[4] + "000000000")[:9]
+			nsec, _ = strconv.Atoi(frac)
+		}
+		ref = ref.Local()
+		t := time.Date(ref.Year(), ref.Month(), ref.Day(), h, min, sec, nsec, time.Local)
+		if t.Before(ref.Add(-12 * time.Hour)) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// formatTimeline renders merged lines as "HH:MM:SS.mmm [service] text" with aligned service names.
+// With asHTML set the texts are markup already and only the prefix is escaped.
+func formatTimeline(entries []TimelineLine, asHTML bool) string {
+	if len(entries) == 0 {
+		return "No log lines in the requested window.\n"
+	}
+	width := 0
+	for _, e := range entries {
+		if len(e.Service) > width {
+			width = len(e.Service)
+		}
+	}
+	var out strings.Builder
+	for _, e := range entries {
+		prefix := fmt.Sprintf("%s [%-*s] ", e.Time.Local().Format("15:04:05.000"), width, e.Service)
+		if asHTML {
+			prefix = html.EscapeString(prefix)
+		}
+		out.WriteString(prefix + e.Text + "\n")
+	}
+	return out.String()
+}
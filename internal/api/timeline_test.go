@@ -0,0 +1,113 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 2, 11, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2m", now.Add(-2 * time.Minute)},
+		{"-90s", now.Add(-90 * time.Second)},
+		{"2024-02-11T14:00:00Z", time.Date(2024, 2, 11, 14, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got, err := parseSince(tt.in, now); err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Error("parseSince(yesterday) accepted")
+	}
+}
+
+func TestLineTime(t *testing.T) {
+	ref := time.Date(2024, 2, 11, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		text string
+		ref  time.Time
+		want time.Time // zero: no timestamp
+	}{
+		{"2024-02-11T14:30:22.123Z GET /health", ref, time.Date(2024, 2, 11, 14, 30, 22, 123e6, time.UTC)},
+		{"2024-02-11T14:30:22+02:00 started", ref, time.Date(2024, 2, 11, 12, 30, 22, 0, time.UTC)},
+		{"2024-02-11 14:30:22 INFO ready", ref, time.Date(2024, 2, 11, 14, 30, 22, 0, time.Local)},
+		{"2024-02-11 14:30:22,5 INFO ready", ref, time.Date(2024, 2, 11, 14, 30, 22, 5e8, time.Local)},
+		{"[14:30:22.25] build done", ref, time.Date(2024, 2, 11, 14, 30, 22, 25e7, time.Local)},
+		{"00:00:01 after midnight", time.Date(2024, 2, 11, 23, 59, 0, 0, time.Local), time.Date(2024, 2, 12, 0, 0, 1, 0, time.Local)},
+		{"25:61:00 not a time", ref, time.Time{}},
+		{"version 1.2.3", ref, time.Time{}},
+	}
+	for _, tt := range tests {
+		got, ok := lineTime(tt.text, tt.ref)
+		if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("lineTime(%q) = %v, %v; want %v", tt.text, got, ok, tt.want)
+		}
+	}
+}
+
+func TestBuildTimeline(t *testing.T) {
+	dir := t.TempDir()
+	write := func(service, name, data string) string {
+		path := filepath.Join(dir, service, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("api", "2024-02-11_100000.log", "10:00:01 api start\nno timestamp\n\x1b[32m10:00:05\x1b[0m api ready\n")
+	write("api", "latest.log", "10:00:02 duplicate of the latest run\n")
+	old := write("api", "2024-02-11_080000.log", "08:00:00 old run\n")
+	write("web", "2024-02-11_100002.log", "10:00:03 web start\n")
+	since := time.Date(2024, 2, 11, 9, 0, 0, 0, time.Local)
+	if err := os.Chtimes(old, since.Add(-time.Hour), since.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, skipped, err := buildTimeline(dir, []string{"api", "web", "nope"}, since, FormatPlain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Service+": "+e.Text)
+	}
+	want := []string{"api: 10:00:01 api start", "api: no timestamp", "web: 10:00:03 web start", "api: 10:00:05 api ready"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("timeline = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(skipped, []string{"nope"}) {
+		t.Errorf("skipped = %q, want [nope]", skipped)
+	}
+
+	if entries, _, err := buildTimeline(dir, nil, since, FormatPlain, nil); err != nil || len(entries) != 4 {
+		t.Errorf("all services: %d entries, %v", len(entries), err)
+	}
+	if _, _, err := buildTimeline(dir, []string{"nope"}, since, FormatPlain, nil); err == nil {
+		t.Error("timeline of services without logs succeeded")
+	}
+
+	// html keeps colors, redacts before rendering and still reads times through escape codes
+	write("web", "2024-02-11_100010.log", "\x1b[31m10:00:04 token hunter2\x1b[0m\n")
+	red, _ := NewRedactor(nil, []string{"hunter2"})
+	entries, _, err = buildTimeline(dir, []string{"web"}, since, FormatHTML, red)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("html: %+v, %v", entries, err)
+	}
+	if e := entries[1]; e.Text != `<span style="color:#cd3131">10:00:04 token ****</span>` || e.Time.Second() != 4 {
+		t.Errorf("html line = %+v", e)
+	}
+	if got := formatTimeline(entries[1:], true); !strings.HasSuffix(got, "[web] <span style=\"color:#cd3131\">10:00:04 token ****</span>\n") {
+		t.Errorf("formatTimeline = %q", got)
+	}
+}
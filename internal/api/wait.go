@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxWaitTimeout caps POST /wait so a forgotten call doesn't hold a connection for hours
+const maxWaitTimeout = 10 * time.Minute
+
+// WaitRequest is the body of POST /wait/<service>. Every condition given must hold; the call
+// returns as soon as they all do, or when Timeout passes.
+type WaitRequest struct {
+	Pattern   string       `json:"pattern,omitempty"`    // regex matched against log lines (escape codes stripped)
+	FromStart bool         `json:"from_start,omitempty"` // also match lines already in the current run's log (default: only new output)
+	State     ServiceState `json:"state,omitempty"`      // wait until the service is in this state
+	URL       string       `json:"url,omitempty"`        // wait until a GET answers with a status below 400
+	Timeout   string       `json:"timeout,omitempty"`    // e.g. "30s" (default 60s, max 10m)
+}
+
+// WaitResponse is the outcome of POST /wait/<service>.
+type WaitResponse struct {
+	Success    bool         `json:"success"`
+	Service    string       `json:"service,omitempty"`
+	Message    string       `json:"message"`
+	Line       string       `json:"line,omitempty"`        // the log line that matched pattern
+	RunID      string       `json:"run_id,omitempty"`      // run the line was found in
+	State      ServiceState `json:"state,omitempty"`       // last observed state
+	HTTPStatus int          `json:"http_status,omitempty"` // last probe status (0 if it didn't connect)
+	TimedOut   bool         `json:"timed_out,omitempty"`
+	Elapsed    string       `json:"elapsed"`
+}
+
+// logTail reads lines appended to a service's latest log, switching to the new file when a
+// new run starts.
+type logTail struct {
+	baseDir, service string
+	runID            string
+	offset           int64
+	partial          string
+}
+
+// newLogTail starts at the end of the current run's log, or at its beginning with fromStart.
+func newLogTail(baseDir, service string, fromStart bool) *logTail {
+	t := &logTail{baseDir: baseDir, service: service, runID: latestRunID(baseDir, service)}
+	if !fromStart && t.runID != "" {
+		if info, err := os.Stat(t.path()); err == nil {
+			t.offset = info.Size()
+		}
+	}
+	return t
+}
+
+func (t *logTail) path() string {
+	return filepath.Join(t.baseDir, t.service, t.runID+".log")
+}
+
+// next returns the complete lines written since the last call.
+func (t *logTail) next() []string {
+	if id := latestRunID(t.baseDir, t.service); id != t.runID {
+		t.runID, t.offset, t.partial = id, 0, "" // restarted: read the new run from the top
+	}
+	if t.runID == "" {
+		return nil
+	}
+	f, err := os.Open(t.path())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(f, 4<<20))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	t.offset += int64(len(data))
+	text := t.partial + string(data)
+	end := strings.LastIndexByte(text, '\n')
+	if end < 0 {
+		t.partial = text
+		return nil
+	}
+	t.partial = text[end+1:]
+	return strings.Split(text[:end], "\n")
+}
+
+// probeURL reports the status of a GET to url (0 when it doesn't connect).
+func probeURL(ctx context.Context, url string) int {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// Wait blocks until the conditions of req hold for service, the timeout passes or ctx ends.
+// Waiting on a pattern or URL gives up early when the service crashes or exits meanwhile.
+func (s *Server) Wait(ctx context.Context, service string, req WaitRequest) (WaitResponse, error) {
+	timeout := defaultReadyTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return WaitResponse{}, fmt.Errorf("invalid timeout %q (use e.g. 30s or 2m)", req.Timeout)
+		}
+		timeout = min(d, maxWaitTimeout)
+	}
+	if req.Pattern == "" && req.State == "" && req.URL == "" {
+		return WaitResponse{}, fmt.Errorf("pattern, state or url required")
+	}
+	switch req.State {
+	case "", StatePending, StateStarting, StateReady, StateCrashed, StateExited, StateStopped:
+	default:
+		return WaitResponse{}, fmt.Errorf("unknown state %q", req.State)
+	}
+	if service == "" && (req.Pattern != "" || req.State != "") {
+		return WaitResponse{}, fmt.Errorf("service required for pattern and state")
+	}
+	var re *regexp.Regexp
+	if req.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(req.Pattern); err != nil {
+			return WaitResponse{}, fmt.Errorf("invalid pattern: %v", err)
+		}
+	}
+	var tail *logTail
+	if service != "" {
+		s.mu.RLock()
+		spec, known := s.specFor(service)
+		configured := len(s.services) > 0
+		s.mu.RUnlock()
+		if configured && !known {
+			return WaitResponse{}, fmt.Errorf("service %q not found in config", service)
+		}
+		if re != nil && spec.Interactive {
+			return WaitResponse{}, fmt.Errorf("%s is interactive and has no log file to match; wait for state or url instead", service)
+		}
+		if re != nil {
+			tail = newLogTail(logBaseDir, service, req.FromStart)
+		}
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	resp := WaitResponse{Service: service}
+	matched, stateOK, urlOK := re == nil, req.State == "", req.URL == ""
+	var lastState ServiceState
+	var nextState, nextProbe time.Time
+	for {
+		now := time.Now()
+		if !matched {
+			for _, line := range tail.next() {
+				if line = strings.TrimSpace(renderPlain(line)); re.MatchString(line) {
+					if len(line) > 500 {
+						line = line[:500] + "..."
+					}
+					matched, resp.Line, resp.RunID = true, line, tail.runID
+					break
+				}
+			}
+		}
+		// Status is comparatively expensive (ps, port checks), so poll it less often
+		if service != "" && !now.Before(nextState) {
+			nextState = now.Add(500 * time.Millisecond)
+			st, _ := s.serviceStatus(service)
+			resp.State = st.State
+			if !stateOK && st.State == req.State {
+				stateOK = true
+			}
+			// A run that ends while we wait won't print the line or answer the probe
+			ended := st.State == StateCrashed || st.State == StateExited || st.State == StateStopped
+			wasRunning := lastState == StateStarting || lastState == StateReady
+			if ended && wasRunning && st.State != req.State {
+				resp.Message = fmt.Sprintf("%s %s while waiting", service, st.State)
+				if st.LastError != "" {
+					resp.Message += ": " + st.LastError
+				}
+				break
+			}
+			lastState = st.State
+		}
+		if !urlOK && !now.Before(nextProbe) {
+			nextProbe = now.Add(500 * time.Millisecond)
+			resp.HTTPStatus = probeURL(ctx, req.URL)
+			urlOK = resp.HTTPStatus > 0 && resp.HTTPStatus < 400
+		}
+		if matched && stateOK && urlOK {
+			resp.Success = true
+			break
+		}
+		if now.After(deadline) {
+			resp.TimedOut = true
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	resp.Elapsed = time.Since(start).Round(100 * time.Millisecond).String()
+	if resp.Message != "" {
+		return resp, nil
+	}
+	var missing []string
+	if !matched {
+		missing = append(missing, fmt.Sprintf("no line matched %q", req.Pattern))
+	}
+	if !stateOK {
+		missing = append(missing, fmt.Sprintf("state is %s, not %s", resp.State, req.State))
+	}
+	if !urlOK {
+		missing = append(missing, fmt.Sprintf("%s answered %d", req.URL, resp.HTTPStatus))
+		if resp.HTTPStatus == 0 {
+			missing[len(missing)-1] = req.URL + " not reachable"
+		}
+	}
+	if resp.Success {
+		resp.Message = "conditions met after " + resp.Elapsed
+	} else {
+		resp.Message = fmt.Sprintf("timed out after %s: %s", timeout, strings.Join(missing, "; "))
+	}
+	return resp, nil
+}
+
+// handleWait waits for a log pattern, state or URL (POST /wait/<service>, or /wait for a URL only).
+func (s *Server) handleWait(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	service := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/wait"), "/")
+	var req WaitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.State = ServiceState(strings.ToLower(string(req.State)))
+	resp, err := s.Wait(r.Context(), service, req)
+	if r.Context().Err() != nil {
+		return // client went away
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.Line = s.redactFor(r).Redact(resp.Line)
+	resp.Message = s.redactFor(r).Redact(resp.Message)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeRun creates a run log (and makes it latest) for service under baseDir.
+func writeRun(t *testing.T, baseDir, service, runID, content string) string {
+	t.Helper()
+	dir := filepath.Join(baseDir, service)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, runID+".log")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "latest.log"))
+	if err := os.Symlink(runID+".log", filepath.Join(dir, "latest.log")); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(text)
+}
+
+func TestLogTail(t *testing.T) {
+	base := t.TempDir()
+	path := writeRun(t, base, "web", "2024-01-01_100000", "old line\n")
+
+	tail := newLogTail(base, "web", false)
+	if got := tail.next(); got != nil {
+		t.Fatalf("new tail returned existing lines %q", got)
+	}
+	appendFile(t, path, "compiled\nhalf")
+	if got := tail.next(); !reflect.DeepEqual(got, []string{"compiled"}) {
+		t.Fatalf("next = %q, want [compiled]", got)
+	}
+	appendFile(t, path, " a line\n")
+	if got := tail.next(); !reflect.DeepEqual(got, []string{"half a line"}) {
+		t.Fatalf("next = %q, want the completed partial line", got)
+	}
+	// A restart switches to the new run and reads it from the top
+	writeRun(t, base, "web", "2024-01-01_100500", "booting\n")
+	if got := tail.next(); !reflect.DeepEqual(got, []string{"booting"}) || tail.runID != "2024-01-01_100500" {
+		t.Fatalf("after restart next = %q (run %s)", got, tail.runID)
+	}
+
+	if got := newLogTail(base, "web", true).next(); !reflect.DeepEqual(got, []string{"booting"}) {
+		t.Fatalf("fromStart tail = %q", got)
+	}
+}
+
+func TestWaitPattern(t *testing.T) {
+	const service = "crux-wait-test"
+	t.Cleanup(func() { os.RemoveAll(filepath.Join(logBaseDir, service)) })
+	runID := time.Now().Format(runFileLayout)
+	path := writeRun(t, logBaseDir, service, runID, "Compiling...\n")
+	record := fmt.Sprintf("wrapper_pid=%d\nstarted=%d\n", os.Getpid(), time.Now().Unix())
+	if err := os.WriteFile(filepath.Join(logBaseDir, service, runID+".run"), []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(0)
+	s.SetServices([]ServiceSpec{{Name: service}})
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		appendFile(t, path, "\x1b[32mReloaded 3 of 120 libraries\x1b[0m in 412ms\n")
+	}()
+	resp, err := s.Wait(context.Background(), service, WaitRequest{Pattern: `Reloaded \d+ of`, Timeout: "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Line != "Reloaded 3 of 120 libraries in 412ms" || resp.RunID != runID {
+		t.Fatalf("Wait = %+v", resp)
+	}
+
+	resp, err = s.Wait(context.Background(), service, WaitRequest{Pattern: "never printed", Timeout: "300ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || !resp.TimedOut || !strings.Contains(resp.Message, "no line matched") {
+		t.Fatalf("Wait for a missing line = %+v", resp)
+	}
+
+	if _, err := s.Wait(context.Background(), "nope", WaitRequest{Pattern: "x"}); err == nil {
+		t.Error("Wait on an unknown service succeeded")
+	}
+	if _, err := s.Wait(context.Background(), service, WaitRequest{Pattern: "("}); err == nil {
+		t.Error("Wait accepted an invalid regex")
+	}
+}
+
+func TestWaitURL(t *testing.T) {
+	ready := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-ready:
+		default:
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	time.AfterFunc(600*time.Millisecond, func() { close(ready) })
+
+	resp, err := NewServer(0).Wait(context.Background(), "", WaitRequest{URL: ts.URL, Timeout: "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.HTTPStatus != http.StatusOK {
+		t.Fatalf("Wait = %+v", resp)
+	}
+}
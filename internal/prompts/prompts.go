@@ -0,0 +1,11 @@
+// Package prompts holds the agent instructions shared by `crux prompt` and the crux-mcp
+// write_config prompt.
+package prompts
+
+import _ "embed"
+
+// Setup tells an agent how to analyse a project and write its crux config.yaml: find the
+// real run scripts, add dependencies and emulators, then start crux and use the MCP tools.
+//
+//go:embed setup.md
+var Setup string
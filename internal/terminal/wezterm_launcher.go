@@ -115,22 +115,68 @@ func (w *WeztermLauncher) IsAvailable() bool {
 
 // Spawn implements TerminalLauncher interface - spawns a new tab
 func (w *WeztermLauncher) Spawn(name string, workDir string, command string, args []string) error {
-	_, err := w.SpawnTab(name, workDir, command, args, false)
+	_, err := w.SpawnTab(name, workDir, command, args, nil, false)
 	return err
 }
 
+// shellQuote quotes s as one word for sh, so the shell neither splits nor expands it.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellWord quotes s only when it holds something the shell would interpret.
+func shellWord(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return shellQuote(s)
+}
+
+// envNameChars are the characters of a portable environment variable name
+const envNameChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_"
+
+// writeEnvFile writes env (KEY=value pairs) as export lines to a new 0600 file for the
+// spawned shell to source and delete, so values stay out of argv (ps) and the log.
+// It returns "" when env is empty.
+func writeEnvFile(env []string) (string, error) {
+	if len(env) == 0 {
+		return "", nil
+	}
+	var b strings.Builder
+	for _, kv := range env {
+		key, val, _ := strings.Cut(kv, "=")
+		if key == "" || strings.Trim(key, envNameChars) != "" || key[0] >= '0' && key[0] <= '9' {
+			return "", fmt.Errorf("invalid environment variable name %q", key)
+		}
+		b.WriteString("export " + key + "=" + shellQuote(val) + "\n")
+	}
+	f, err := os.CreateTemp("", "crux-env-*.sh")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(b.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
 // wrapCommand wraps a command to log output and keep terminal open on failure
 // Logs to /tmp/crux-logs/<service>/<timestamp>.log with symlink to latest.log
-func wrapCommand(name string, command string, args []string) (string, []string) {
+// envFile (from writeEnvFile, may be empty) is sourced and removed before the command runs.
+func wrapCommand(name string, command string, args []string, envFile string) (string, []string) {
 	// Build the original command string
-	fullCmd := command
+	fullCmd := shellWord(command)
 	for _, arg := range args {
-		// Quote args with spaces
-		if strings.Contains(arg, " ") {
-			fullCmd += fmt.Sprintf(" '%s'", arg)
-		} else {
-			fullCmd += " " + arg
-		}
+		fullCmd += " " + shellWord(arg)
+	}
+	sourceEnv := ""
+	if envFile != "" {
+		sourceEnv = fmt.Sprintf(". %s && rm -f %s", shellQuote(envFile), shellQuote(envFile))
 	}
 
 	// Log directory structure: /tmp/crux-logs/<service>/
@@ -138,7 +184,7 @@ func wrapCommand(name string, command string, args []string) (string, []string)
 
 	// Wrapper script:
 	// 1. Create log directory
-	// 2. Create timestamped log file
+	// 2. Create timestamped log file and run record (<timestamp>.run: wrapper PID, start/exit)
 	// 3. Symlink latest.log to current log
 	// 4. Clean up old logs (keep last 10)
 	// 5. Run command with tee
@@ -149,22 +195,36 @@ LOG_DIR="%s"
 mkdir -p "$LOG_DIR"
 TIMESTAMP=$(date +%%Y-%%m-%%d_%%H%%M%%S)
 LOG_FILE="$LOG_DIR/$TIMESTAMP.log"
+RUN_FILE="$LOG_DIR/$TIMESTAMP.run"
+
+# Marks the service's processes, so leftovers from this run can be recognised later
+export CRUX_SERVICE="%s"
+
+# Service env: read from a file so values stay out of ps and the log
+%s
+
+# Run record (read by crux /services)
+echo "run=$TIMESTAMP" > "$RUN_FILE"
+echo "wrapper_pid=$$" >> "$RUN_FILE"
+echo "started=$(date +%%s)" >> "$RUN_FILE"
 
 # Symlink latest.log
 rm -f "$LOG_DIR/latest.log"
 ln -s "$LOG_FILE" "$LOG_DIR/latest.log"
 
-# Clean old logs (keep last 10)
-ls -t "$LOG_DIR"/*.log 2>/dev/null | grep -v latest.log | tail -n +11 | xargs rm -f 2>/dev/null
+# Clean old logs and their run records (keep last 10)
+ls -t "$LOG_DIR"/*.log 2>/dev/null | grep -v latest.log | tail -n +11 | while read -r OLD; do rm -f "$OLD" "${OLD%%.log}.run"; done
 
 # Run with logging
 echo "=== crux: %s ===" | tee "$LOG_FILE"
-echo "Command: %s" | tee -a "$LOG_FILE"
+echo %s | tee -a "$LOG_FILE"
 echo "Started: $(date)" | tee -a "$LOG_FILE"
 echo "Log: $LOG_FILE" | tee -a "$LOG_FILE"
 echo "================================" | tee -a "$LOG_FILE"
 %s 2>&1 | tee -a "$LOG_FILE"
 EXIT_CODE=${PIPESTATUS[0]}
+echo "exit_code=$EXIT_CODE" >> "$RUN_FILE"
+echo "exited=$(date +%%s)" >> "$RUN_FILE"
 echo "" | tee -a "$LOG_FILE"
 echo "=== Exited with code $EXIT_CODE at $(date) ===" | tee -a "$LOG_FILE"
 if [ $EXIT_CODE -ne 0 ]; then
@@ -173,24 +233,37 @@ if [ $EXIT_CODE -ne 0 ]; then
   echo "Press Enter to close this tab..."
   read
 fi
-`, logDir, name, fullCmd, fullCmd)
+`, logDir, name, sourceEnv, name, shellQuote("Command: "+fullCmd), fullCmd)
 
 	return "/bin/bash", []string{"-c", wrapper}
 }
 
-// prepareSpawnCommand returns the effective command for a service mode.
-// Interactive services run directly in the terminal TTY with no wrapper.
-func prepareSpawnCommand(title string, command string, args []string, interactive bool) (string, []string) {
+// prepareSpawnCommand returns the effective command for a service mode and the env file it
+// reads (removed by the spawned shell; the caller removes it if spawning fails).
+// Interactive services run directly in the terminal TTY with no wrapper (only CRUX_SERVICE is set).
+func prepareSpawnCommand(title string, command string, args []string, env []string, interactive bool) (string, []string, string, error) {
+	envFile, err := writeEnvFile(env)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("service env: %w", err)
+	}
 	if interactive {
-		return command, args
+		direct := append([]string{"CRUX_SERVICE=" + title, command}, args...)
+		if envFile == "" {
+			return "env", direct, "", nil
+		}
+		return "/bin/bash", append([]string{"-c", `. "$0" && rm -f "$0" && exec env "$@"`, envFile}, direct...), envFile, nil
 	}
-	return wrapCommand(title, command, args)
+	spawnCmd, spawnArgs := wrapCommand(title, command, args, envFile)
+	return spawnCmd, spawnArgs, envFile, nil
 }
 
 // OpenWindow opens a new Wezterm window with a command
 // Uses 'wezterm start' which launches the GUI
-func (w *WeztermLauncher) OpenWindow(title string, workDir string, command string, args []string, interactive bool) (string, error) {
-	spawnCmd, spawnArgs := prepareSpawnCommand(title, command, args, interactive)
+func (w *WeztermLauncher) OpenWindow(title string, workDir string, command string, args []string, env []string, interactive bool) (string, error) {
+	spawnCmd, spawnArgs, envFile, err := prepareSpawnCommand(title, command, args, env, interactive)
+	if err != nil {
+		return "", err
+	}
 
 	cmdArgs := []string{"start"}
 
@@ -203,8 +276,9 @@ func (w *WeztermLauncher) OpenWindow(title string, workDir string, command strin
 	cmdArgs = append(cmdArgs, spawnArgs...)
 
 	cmd := exec.Command("wezterm", cmdArgs...)
-	err := cmd.Start()
+	err = cmd.Start()
 	if err != nil {
+		os.Remove(envFile)
 		return "", fmt.Errorf("failed to open wezterm window: %w", err)
 	}
 
@@ -313,8 +387,11 @@ func GetFirstPaneID() (string, error) {
 }
 
 // SpawnTabInWindow spawns a new tab in a specific window. Prefer over SpawnTabInPane when we know the window.
-func SpawnTabInWindow(windowID string, title string, workDir string, command string, args []string, interactive bool) (string, error) {
-	spawnCmd, spawnArgs := prepareSpawnCommand(title, command, args, interactive)
+func SpawnTabInWindow(windowID string, title string, workDir string, command string, args []string, env []string, interactive bool) (string, error) {
+	spawnCmd, spawnArgs, envFile, err := prepareSpawnCommand(title, command, args, env, interactive)
+	if err != nil {
+		return "", err
+	}
 	cmdArgs := []string{"cli", "spawn", "--window-id", windowID}
 	if workDir != "" {
 		cmdArgs = append(cmdArgs, "--cwd", workDir)
@@ -335,13 +412,17 @@ func SpawnTabInWindow(windowID string, title string, workDir string, command str
 		lastErr = err
 		time.Sleep(500 * time.Millisecond)
 	}
+	os.Remove(envFile)
 	return "", fmt.Errorf("failed to spawn wezterm tab: %w", lastErr)
 }
 
 // SpawnTabInPane spawns a new tab in an existing Wezterm window by pane ID.
 // Use GetFirstPaneID() to get a pane when attaching to the current window.
-func SpawnTabInPane(anchorPaneID string, title string, workDir string, command string, args []string, interactive bool) (string, error) {
-	spawnCmd, spawnArgs := prepareSpawnCommand(title, command, args, interactive)
+func SpawnTabInPane(anchorPaneID string, title string, workDir string, command string, args []string, env []string, interactive bool) (string, error) {
+	spawnCmd, spawnArgs, envFile, err := prepareSpawnCommand(title, command, args, env, interactive)
+	if err != nil {
+		return "", err
+	}
 	cmdArgs := []string{"cli", "spawn", "--pane-id", anchorPaneID}
 	if workDir != "" {
 		cmdArgs = append(cmdArgs, "--cwd", workDir)
@@ -362,20 +443,21 @@ func SpawnTabInPane(anchorPaneID string, title string, workDir string, command s
 		lastErr = err
 		time.Sleep(500 * time.Millisecond)
 	}
+	os.Remove(envFile)
 	return "", fmt.Errorf("failed to spawn wezterm tab: %w", lastErr)
 }
 
 // SpawnTab spawns a new tab in the existing Wezterm window
-func (w *WeztermLauncher) SpawnTab(title string, workDir string, command string, args []string, interactive bool) (string, error) {
+func (w *WeztermLauncher) SpawnTab(title string, workDir string, command string, args []string, env []string, interactive bool) (string, error) {
 	if w.firstPaneID == "" && w.firstWindowID == "" {
 		return "", fmt.Errorf("no anchor pane (start crux normally first, or use crux start-one with wezterm already open)")
 	}
 	var newPaneID string
 	var err error
 	if w.firstWindowID != "" && w.firstWindowID != "0" {
-		newPaneID, err = SpawnTabInWindow(w.firstWindowID, title, workDir, command, args, interactive)
+		newPaneID, err = SpawnTabInWindow(w.firstWindowID, title, workDir, command, args, env, interactive)
 	} else {
-		newPaneID, err = SpawnTabInPane(w.firstPaneID, title, workDir, command, args, interactive)
+		newPaneID, err = SpawnTabInPane(w.firstPaneID, title, workDir, command, args, env, interactive)
 	}
 	if err != nil {
 		return "", err
@@ -491,7 +573,7 @@ func (w *WeztermLauncher) StartWithTabs(services []ServiceDef) error {
 		workDir = cwd
 	}
 
-	paneID, err := w.OpenWindow(first.Name, workDir, first.Command, first.Args, first.Interactive)
+	paneID, err := w.OpenWindow(first.Name, workDir, first.Command, first.Args, first.Env, first.Interactive)
 	if err != nil {
 		return fmt.Errorf("failed to open window for %s: %w", first.Name, err)
 	}
@@ -508,7 +590,7 @@ func (w *WeztermLauncher) StartWithTabs(services []ServiceDef) error {
 			workDir = cwd
 		}
 
-		paneID, err := w.SpawnTab(svc.Name, workDir, svc.Command, svc.Args, svc.Interactive)
+		paneID, err := w.SpawnTab(svc.Name, workDir, svc.Command, svc.Args, svc.Env, svc.Interactive)
 		if err != nil {
 			return fmt.Errorf("failed to spawn tab for %s: %w", svc.Name, err)
 		}
@@ -530,6 +612,7 @@ type ServiceDef struct {
 	Name        string
 	Command     string
 	Args        []string
+	Env         []string // KEY=value pairs, passed through a file (see writeEnvFile)
 	WorkDir     string
 	Interactive bool
 }
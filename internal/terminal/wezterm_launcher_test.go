@@ -0,0 +1,66 @@
+package terminal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWrapCommandEnv(t *testing.T) {
+	dir := t.TempDir()
+	logDir := "/tmp/crux-logs/crux-test-env"
+	t.Cleanup(func() { os.RemoveAll(logDir) })
+	value := `it's $HOME and $(touch pwned)`
+
+	for _, interactive := range []bool{false, true} {
+		os.RemoveAll(logDir)
+		spawnCmd, spawnArgs, envFile, err := prepareSpawnCommand("crux-test-env", "printenv", []string{"SECRET"}, []string{"SECRET=" + value}, interactive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(envFile); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("env file %s: %v %v", envFile, info, err)
+		}
+		for _, arg := range spawnArgs {
+			if strings.Contains(arg, "touch pwned") {
+				t.Errorf("interactive=%v: env value in argv: %q", interactive, arg)
+			}
+		}
+		cmd := exec.Command(spawnCmd, spawnArgs...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("interactive=%v: %v\n%s", interactive, err, out)
+		}
+		if !strings.Contains(string(out), value+"\n") {
+			t.Errorf("interactive=%v: output %q lacks the literal value", interactive, out)
+		}
+		if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+			t.Errorf("interactive=%v: env file left behind: %v", interactive, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+			t.Fatalf("interactive=%v: env value was run by the shell", interactive)
+		}
+		if interactive {
+			continue
+		}
+		log, err := os.ReadFile(filepath.Join(logDir, "latest.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(string(log), value) != 1 || !strings.Contains(string(log), "Command: printenv SECRET\n") {
+			t.Errorf("log shows the value outside the command's output:\n%s", log)
+		}
+	}
+}
+
+func TestWriteEnvFileRejectsNames(t *testing.T) {
+	for _, kv := range []string{"=x", "1A=x", "A B=x", "A;touch x=y"} {
+		if path, err := writeEnvFile([]string{kv}); err == nil {
+			os.Remove(path)
+			t.Errorf("%q accepted", kv)
+		}
+	}
+}
@@ -14,10 +14,14 @@ go build -o /tmp/crux-mcp-test ./cmd/mcp
 /tmp/crux-test --version
 echo ""
 
+# API calls need the per-session token crux writes on startup
+TOKEN_FILE="$HOME/.crux/api-9876.token"
+auth() { echo "Authorization: Bearer $(cat "$TOKEN_FILE" 2>/dev/null)"; }
+
 # Kill any existing crux on 9876 so we can bind
 if curl -s -o /dev/null -w "%{http_code}" http://localhost:9876/health 2>/dev/null | grep -q 200; then
   echo "Stopping existing crux on 9876..."
-  curl -s -X POST http://localhost:9876/stop 2>/dev/null || true
+  curl -s -X POST -H "$(auth)" http://localhost:9876/stop 2>/dev/null || true
   sleep 2
 fi
 
@@ -49,7 +53,7 @@ fi
 
 echo ""
 echo "=== 1. GET /tabs ==="
-TABS=$(curl -s http://localhost:9876/tabs)
+TABS=$(curl -s -H "$(auth)" http://localhost:9876/tabs)
 echo "$TABS"
 if ! echo "$TABS" | grep -q '"tabs"'; then
   echo "  FAIL: expected tabs in response"
@@ -60,7 +64,7 @@ echo "  OK"
 echo ""
 
 echo "=== 2. POST /stop/backend (kill tab) ==="
-STOP_RESULT=$(curl -s -X POST http://localhost:9876/stop/backend -H "Content-Type: application/json")
+STOP_RESULT=$(curl -s -X POST -H "$(auth)" http://localhost:9876/stop/backend -H "Content-Type: application/json")
 echo "$STOP_RESULT"
 if echo "$STOP_RESULT" | grep -q '"success":true'; then
   echo "  OK: backend tab killed"
@@ -73,12 +77,12 @@ sleep 1
 echo ""
 
 echo "=== 3. GET /tabs (after kill) ==="
-curl -s http://localhost:9876/tabs | head -20
+curl -s -H "$(auth)" http://localhost:9876/tabs | head -20
 echo ""
 echo ""
 
 echo "=== 4. POST /start-one/backend (restart) ==="
-START_RESULT=$(curl -s -X POST http://localhost:9876/start-one/backend -H "Content-Type: application/json")
+START_RESULT=$(curl -s -X POST -H "$(auth)" http://localhost:9876/start-one/backend -H "Content-Type: application/json")
 echo "$START_RESULT"
 if echo "$START_RESULT" | grep -q '"success":true'; then
   echo "  OK: backend started"
@@ -91,8 +95,8 @@ sleep 1
 echo ""
 
 echo "=== 5. Reload backend (POST /stop/backend then POST /start-one/backend) ==="
-RELOAD_KILL=$(curl -s -X POST http://localhost:9876/stop/backend)
-RELOAD_START=$(curl -s -X POST http://localhost:9876/start-one/backend)
+RELOAD_KILL=$(curl -s -X POST -H "$(auth)" http://localhost:9876/stop/backend)
+RELOAD_START=$(curl -s -X POST -H "$(auth)" http://localhost:9876/start-one/backend)
 if echo "$RELOAD_KILL" | grep -q '"success":true' && echo "$RELOAD_START" | grep -q '"success":true'; then
   echo "  OK: reload (kill + start_one) succeeded"
 else
@@ -104,7 +108,7 @@ sleep 1
 echo ""
 
 echo "=== 6. POST /send/backend (hot reload key) ==="
-SEND_RESULT=$(curl -s -X POST http://localhost:9876/send/backend -H "Content-Type: application/json" -d '{"text":"r"}')
+SEND_RESULT=$(curl -s -X POST -H "$(auth)" http://localhost:9876/send/backend -H "Content-Type: application/json" -d '{"text":"r"}')
 echo "$SEND_RESULT"
 if echo "$SEND_RESULT" | grep -q '"success":true'; then
   echo "  OK: send r to backend"
@@ -116,7 +120,7 @@ fi
 echo ""
 
 echo "=== 7. Shutdown (POST /stop) ==="
-curl -s -X POST http://localhost:9876/stop
+curl -s -X POST -H "$(auth)" http://localhost:9876/stop
 sleep 2
 if kill -0 $CRUX_PID 2>/dev/null; then
   kill $CRUX_PID 2>/dev/null || true